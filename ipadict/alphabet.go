@@ -0,0 +1,73 @@
+// File path: tipatools/ipadict/alphabet.go
+
+package main
+
+// Transliteration of exported dictionaries (--export-alphabet).
+//
+// The tables live in package alphabet, shared with phonetize. A
+// pronunciation with a symbol missing from the table of the target
+// alphabet is dropped from the export rather than passed through, and the
+// symbols are reported.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"ipadict/alphabet"
+)
+
+// alphabetReport counts unmappable symbols met while converting a
+// dictionary.
+type alphabetReport struct {
+	Dropped  int            // word/pronunciation pairs dropped
+	Symbols  map[string]int // unmappable symbol -> occurrences
+	Examples map[string]string
+}
+
+// convertEntries transliterates every pronunciation of entries to a. Pairs
+// with unmappable symbols are dropped and reported.
+func convertEntries(a *alphabet.Alphabet, entries map[string][]string) (map[string][]string, alphabetReport) {
+	report := alphabetReport{Symbols: make(map[string]int), Examples: make(map[string]string)}
+	out := make(map[string][]string, len(entries))
+	for word, prons := range entries {
+		var converted []string
+		for _, pron := range prons {
+			c, bad := a.Convert(pron)
+			if len(bad) > 0 {
+				report.Dropped++
+				for _, sym := range bad {
+					report.Symbols[sym]++
+					if _, ok := report.Examples[sym]; !ok {
+						report.Examples[sym] = word + " /" + pron + "/"
+					}
+				}
+				continue
+			}
+			converted = append(converted, c)
+		}
+		if len(converted) > 0 {
+			out[word] = converted
+		}
+	}
+	return out, report
+}
+
+// String renders the report, most frequent symbols first.
+func (r alphabetReport) String() string {
+	symbols := make([]string, 0, len(r.Symbols))
+	for sym := range r.Symbols {
+		symbols = append(symbols, sym)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if r.Symbols[symbols[i]] != r.Symbols[symbols[j]] {
+			return r.Symbols[symbols[i]] > r.Symbols[symbols[j]]
+		}
+		return symbols[i] < symbols[j]
+	})
+	var b strings.Builder
+	for _, sym := range symbols {
+		fmt.Fprintf(&b, "  %q (U+%04X): %d, e.g. %s\n", sym, []rune(sym)[0], r.Symbols[sym], r.Examples[sym])
+	}
+	return b.String()
+}
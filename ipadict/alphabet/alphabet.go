@@ -0,0 +1,260 @@
+// File path: tipatools/ipadict/alphabet/alphabet.go
+
+// Package alphabet transliterates IPA into the ASCII phone alphabets shared
+// by ipadict (--export-alphabet) and phonetize (--alphabet).
+//
+// Kaldi, MFA and older TTS engines expect X-SAMPA, ARPAbet or Kirshenbaum
+// rather than IPA. Each alphabet is a table from IPA sequences (single
+// symbols, diacritics, diphthongs, affricates) to target symbols, applied by
+// greedy longest match. Symbols missing from the table are reported as
+// unmappable instead of being passed through silently.
+package alphabet
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Alphabet is a target phone alphabet.
+type Alphabet struct {
+	Name      string
+	Table     map[string]string // IPA sequence -> target symbol
+	Ignore    string            // IPA symbols dropped without being reported
+	Separator string            // written between target symbols
+	Langs     []string          // languages whose phone set the alphabet covers; empty for any
+	Stress    bool              // ARPAbet-style stress digits on vowels instead of stress marks
+	Vowels    map[string]bool   // target vowels, for Stress
+
+	maxKey int // longest Table key, in runes
+}
+
+// precomposed maps precomposed letters found in IPA transcriptions to their
+// base letter and combining diacritic, so that the tables only need the
+// combining form.
+var precomposed = map[rune]string{
+	'ã': "ã",
+	'ẽ': "ẽ",
+	'ĩ': "ĩ",
+	'õ': "õ",
+	'ũ': "ũ",
+	'ỹ': "ỹ",
+}
+
+// xsampaTable maps IPA to X-SAMPA.
+var xsampaTable = map[string]string{
+	// Pulmonic consonants.
+	"p": "p", "b": "b", "t": "t", "d": "d", "ʈ": "t`", "ɖ": "d`",
+	"c": "c", "ɟ": "J\\", "k": "k", "g": "g", "ɡ": "g", "q": "q", "ɢ": "G\\", "ʔ": "?",
+	"m": "m", "ɱ": "F", "n": "n", "ɳ": "n`", "ɲ": "J", "ŋ": "N", "ɴ": "N\\",
+	"ʙ": "B\\", "r": "r", "ʀ": "R\\", "ɾ": "4", "ɽ": "r`",
+	"ɸ": "p\\", "β": "B", "f": "f", "v": "v", "θ": "T", "ð": "D",
+	"s": "s", "z": "z", "ʃ": "S", "ʒ": "Z", "ʂ": "s`", "ʐ": "z`",
+	"ç": "C", "ʝ": "j\\", "x": "x", "ɣ": "G", "χ": "X", "ʁ": "R",
+	"ħ": "X\\", "ʕ": "?\\", "h": "h", "ɦ": "h\\", "ɬ": "K", "ɮ": "K\\",
+	"ʋ": "P", "ɹ": "r\\", "ɻ": "r\\`", "j": "j", "ɰ": "M\\",
+	"l": "l", "ɭ": "l`", "ʎ": "L", "ʟ": "L\\", "ɺ": "l\\", "ɫ": "5",
+	// Other consonants.
+	"w": "w", "ʍ": "W", "ɥ": "H", "ʜ": "H\\", "ʢ": "<\\", "ʡ": ">\\",
+	"ɕ": "s\\", "ʑ": "z\\", "ɧ": "x\\",
+	"ʘ": "O\\", "ǀ": "|\\", "ǃ": "!\\", "ǂ": "=\\", "ǁ": "|\\|\\",
+	"ɓ": "b_<", "ɗ": "d_<", "ʄ": "J\\_<", "ɠ": "g_<", "ʛ": "G\\_<",
+	"ʧ": "tS", "ʤ": "dZ", "ʦ": "ts", "ʣ": "dz",
+	// Vowels.
+	"i": "i", "y": "y", "ɨ": "1", "ʉ": "}", "ɯ": "M", "u": "u",
+	"ɪ": "I", "ʏ": "Y", "ʊ": "U",
+	"e": "e", "ø": "2", "ɘ": "@\\", "ɵ": "8", "ɤ": "7", "o": "o",
+	"ə": "@", "ɚ": "@`",
+	"ɛ": "E", "œ": "9", "ɜ": "3", "ɝ": "3`", "ɞ": "3\\", "ʌ": "V", "ɔ": "O",
+	"æ": "{", "ɐ": "6",
+	"a": "a", "ɶ": "&", "ɑ": "A", "ɒ": "Q",
+	// Suprasegmentals.
+	"ˈ": "\"", "ˌ": "%", "ː": ":", "ˑ": ":\\", ".": ".", "‿": "-\\",
+	"|": "|", "‖": "||", " ": " ",
+	// Diacritics and modifiers.
+	"̃": "~", "̥": "_0", "̊": "_0", "̬": "_v", "ʰ": "_h",
+	"̤": "_t", "̰": "_k", "̼": "_N", "̪": "_d", "̺": "_a",
+	"̻": "_m", "̹": "_O", "̜": "_c", "̟": "_+", "̠": "_-",
+	"̈": "_\"", "̽": "_x", "̩": "=", "̍": "=", "̯": "_^",
+	"˞": "`", "ʷ": "_w", "ʲ": "'", "ˠ": "_G", "ˤ": "_?\\", "̴": "_e",
+	"̝": "_r", "̞": "_o", "̘": "_A", "̙": "_q", "̚": "_}",
+	"ⁿ": "_n", "ˡ": "_l", "ʼ": "_>", "͡": "_", "͜": "_",
+}
+
+// kirshenbaumTable maps IPA to Kirshenbaum (ASCII-IPA).
+var kirshenbaumTable = map[string]string{
+	// Pulmonic consonants.
+	"p": "p", "b": "b", "t": "t", "d": "d", "ʈ": "t.", "ɖ": "d.",
+	"c": "c", "ɟ": "J", "k": "k", "g": "g", "ɡ": "g", "q": "q", "ɢ": "G", "ʔ": "?",
+	"m": "m", "ɱ": "M", "n": "n", "ɳ": "n.", "ɲ": "n^", "ŋ": "N", "ɴ": "n\"",
+	"ʙ": "b<trl>", "r": "r<trl>", "ʀ": "r\"", "ɾ": "*", "ɽ": "*.",
+	"ɸ": "P", "β": "B", "f": "f", "v": "v", "θ": "T", "ð": "D",
+	"s": "s", "z": "z", "ʃ": "S", "ʒ": "Z", "ʂ": "s.", "ʐ": "z.",
+	"ç": "C", "ʝ": "C<vcd>", "x": "x", "ɣ": "Q", "χ": "X", "ʁ": "g\"",
+	"ħ": "H", "ʕ": "H<vcd>", "h": "h", "ɦ": "h<?>", "ɬ": "s<lat>", "ɮ": "z<lat>",
+	"ʋ": "r<lbd>", "ɹ": "r", "ɻ": "r.", "j": "j", "ɰ": "j<vel>",
+	"l": "l", "ɭ": "l.", "ʎ": "l^", "ʟ": "L",
+	// Other consonants.
+	"w": "w", "ʍ": "w<vls>", "ɥ": "j<rnd>",
+	"ʧ": "tS", "ʤ": "dZ",
+	// Vowels.
+	"i": "i", "y": "y", "ɨ": "i\"", "ʉ": "u\"", "ɯ": "u-", "u": "u",
+	"ɪ": "I", "ʏ": "I.", "ʊ": "U",
+	"e": "e", "ø": "Y", "ɘ": "@<umd>", "ɵ": "@.", "ɤ": "o-", "o": "o",
+	"ə": "@", "ɚ": "R",
+	"ɛ": "E", "œ": "W", "ɜ": "V\"", "ɞ": "O\"", "ʌ": "V", "ɔ": "O",
+	"æ": "&", "ɐ": "&\"",
+	"a": "a", "ɶ": "a.", "ɑ": "A", "ɒ": "A.",
+	// Suprasegmentals.
+	"ˈ": "'", "ˌ": ",", "ː": ":", ".": ".", " ": " ",
+	// Diacritics and modifiers.
+	"̃": "~", "̥": "<o>", "̊": "<o>", "ʰ": "<h>", "̩": "-",
+	"ʷ": "<w>", "ʲ": ";", "ˠ": "<vel>", "ˤ": "<H>", "̪": "[",
+	"ʼ": "`", "͡": "", "͜": "",
+}
+
+// arpabetTable maps English IPA to ARPAbet (CMU dictionary phone set).
+var arpabetTable = map[string]string{
+	// Vowels and diphthongs.
+	"ɑ": "AA", "ɒ": "AA", "a": "AA", "æ": "AE", "ʌ": "AH", "ə": "AH", "ɐ": "AH",
+	"ɔ": "AO", "aʊ": "AW", "aɪ": "AY", "ɛ": "EH", "e": "EY", "eɪ": "EY",
+	"ɝ": "ER", "ɚ": "ER", "ɜ": "ER", "ɜɹ": "ER", "əɹ": "ER",
+	"ɪ": "IH", "i": "IY", "o": "OW", "oʊ": "OW", "əʊ": "OW", "ɔɪ": "OY",
+	"ʊ": "UH", "u": "UW",
+	// Consonants.
+	"b": "B", "tʃ": "CH", "t͡ʃ": "CH", "ʧ": "CH", "d": "D", "ð": "DH",
+	"ɾ": "DX", "f": "F", "g": "G", "ɡ": "G", "h": "HH", "dʒ": "JH", "d͡ʒ": "JH",
+	"ʤ": "JH", "k": "K", "l": "L", "ɫ": "L", "l̩": "EL", "m": "M", "m̩": "EM",
+	"n": "N", "n̩": "EN", "ŋ": "NG", "p": "P", "ʔ": "Q", "ɹ": "R", "r": "R",
+	"s": "S", "ʃ": "SH", "t": "T", "θ": "TH", "v": "V", "w": "W", "ʍ": "W",
+	"j": "Y", "z": "Z", "ʒ": "ZH",
+}
+
+// arpabetVowels are the ARPAbet symbols that carry a stress digit.
+var arpabetVowels = map[string]bool{
+	"AA": true, "AE": true, "AH": true, "AO": true, "AW": true, "AY": true,
+	"EH": true, "ER": true, "EY": true, "IH": true, "IY": true, "OW": true,
+	"OY": true, "UH": true, "UW": true,
+}
+
+// alphabets lists the supported target alphabets by name.
+var alphabets = map[string]*Alphabet{
+	"x-sampa":     {Name: "x-sampa", Table: xsampaTable},
+	"kirshenbaum": {Name: "kirshenbaum", Table: kirshenbaumTable},
+	"arpabet": {
+		Name:      "arpabet",
+		Table:     arpabetTable,
+		Ignore:    "ː.‿ʰ ͡",
+		Separator: " ",
+		Langs:     []string{"en"},
+		Stress:    true,
+		Vowels:    arpabetVowels,
+	},
+}
+
+// The longest keys are computed once, before any alphabet is shared by
+// concurrent conversions.
+func init() {
+	for _, a := range alphabets {
+		for k := range a.Table {
+			a.maxKey = max(a.maxKey, len([]rune(k)))
+		}
+	}
+}
+
+// Canonical returns the canonical name of an alphabet given on the command
+// line: "" for IPA, or the name of a known alphabet.
+func Canonical(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "ipa":
+		return ""
+	case "xsampa":
+		return "x-sampa"
+	case "ascii-ipa":
+		return "kirshenbaum"
+	}
+	return name
+}
+
+// Lookup returns the alphabet called name for pronunciations in language
+// lang. "ipa" (or "") returns nil: no conversion.
+func Lookup(name, lang string) (*Alphabet, error) {
+	name = Canonical(name)
+	if name == "" {
+		return nil, nil
+	}
+	a, ok := alphabets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown alphabet %q (must be \"ipa\", \"x-sampa\", \"arpabet\" or \"kirshenbaum\")", name)
+	}
+	if len(a.Langs) > 0 && !containsFold(a.Langs, lang) {
+		return nil, fmt.Errorf("alphabet %s only covers the phone set of %s, not %q", a.Name, strings.Join(a.Langs, ", "), lang)
+	}
+	return a, nil
+}
+
+// containsFold reports whether list contains s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Convert transliterates an IPA string. It returns the converted string and
+// the IPA symbols that have no mapping, which are copied to the output
+// unchanged.
+func (a *Alphabet) Convert(ipa string) (string, []string) {
+	var src []rune
+	for _, r := range ipa {
+		if d, ok := precomposed[r]; ok {
+			src = append(src, []rune(d)...)
+		} else {
+			src = append(src, r)
+		}
+	}
+
+	var out []string
+	var unmappable []string
+	stress := ""
+	for i := 0; i < len(src); {
+		if a.Stress && (src[i] == 'ˈ' || src[i] == 'ˌ') {
+			stress = "1"
+			if src[i] == 'ˌ' {
+				stress = "2"
+			}
+			i++
+			continue
+		}
+		matched := 0
+		for l := min(a.maxKey, len(src)-i); l > 0; l-- {
+			sym, ok := a.Table[string(src[i:i+l])]
+			if !ok {
+				continue
+			}
+			if a.Stress && a.Vowels[sym] {
+				if stress == "" {
+					stress = "0"
+				}
+				sym += stress
+				stress = ""
+			}
+			if sym != "" {
+				out = append(out, sym)
+			}
+			matched = l
+			break
+		}
+		if matched == 0 {
+			if !strings.ContainsRune(a.Ignore, src[i]) {
+				unmappable = append(unmappable, string(src[i]))
+				out = append(out, string(src[i]))
+			}
+			matched = 1
+		}
+		i += matched
+	}
+	return strings.Join(out, a.Separator), unmappable
+}
@@ -0,0 +1,90 @@
+// File path: tipatools/ipadict/alphabet/alphabet_test.go
+
+package alphabet
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	tests := map[string]string{
+		"ipa":       "",
+		" IPA ":     "",
+		"xsampa":    "x-sampa",
+		"X-SAMPA":   "x-sampa",
+		"ascii-ipa": "kirshenbaum",
+		"arpabet":   "arpabet",
+	}
+	for name, want := range tests {
+		if got := Canonical(name); got != want {
+			t.Errorf("Canonical(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if a, err := Lookup("ipa", "fr"); a != nil || err != nil {
+		t.Errorf("Lookup(ipa) = %v, %v", a, err)
+	}
+	if a, err := Lookup("xsampa", "fr"); err != nil || a.Name != "x-sampa" {
+		t.Errorf("Lookup(xsampa) = %v, %v", a, err)
+	}
+	if _, err := Lookup("arpabet", "EN"); err != nil {
+		t.Errorf("Lookup(arpabet, EN): %v", err)
+	}
+	if _, err := Lookup("arpabet", "fr"); err == nil {
+		t.Error("arpabet accepted for French")
+	}
+	if _, err := Lookup("klingon", "fr"); err == nil {
+		t.Error("unknown alphabet accepted")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		alphabet, ipa, want string
+		unmappable          []string
+	}{
+		{"x-sampa", "ʃa", "Sa", nil},
+		{"x-sampa", "bɔ̃ʒuʁ", "bO~ZuR", nil},
+		{"x-sampa", "ʃjɛ̃", "SjE~", nil},
+		{"x-sampa", "pã", "pa~", nil}, // precomposed ã
+		{"kirshenbaum", "ʃa", "Sa", nil},
+		{"arpabet", "ˈhɛloʊ", "HH EH1 L OW0", nil},
+		{"arpabet", "ˌtʃiːz", "CH IY2 Z", nil},
+		{"arpabet", "ʁa", "ʁ AA0", []string{"ʁ"}},
+	}
+	for _, tt := range tests {
+		a, err := Lookup(tt.alphabet, "en")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, unmappable := a.Convert(tt.ipa)
+		if got != tt.want || !reflect.DeepEqual(unmappable, tt.unmappable) {
+			t.Errorf("%s.Convert(%q) = %q, %q; want %q, %q", tt.alphabet, tt.ipa, got, unmappable, tt.want, tt.unmappable)
+		}
+	}
+}
+
+// TestConvertConcurrent converts with shared alphabets from several
+// goroutines; run with -race.
+func TestConvertConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, name := range []string{"x-sampa", "kirshenbaum", "arpabet"} {
+				a, err := Lookup(name, "en")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				a.Convert("tʃiːz")
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,568 @@
+// File path: tipatools/ipadict/anomalies.go
+
+package main
+
+// Phonotactic anomaly report ("ipadict anomalies DICT").
+//
+// Wiktionary transcriptions contain typos: stray Latin letters, swapped
+// symbols, impossible clusters. The report learns two models from the
+// dictionary itself (one language per run) and ranks word/pronunciation
+// pairs by how badly they fit:
+//
+//   - a phone n-gram model, smoothed by interpolation with lower orders.
+//     Each pair is scored leave-one-out (its own n-grams are removed from
+//     the counts), so a cluster that only occurs in the pair being scored
+//     is not vouched for by the pair itself. The phonotactic cost is the
+//     average surprise in bits per phone.
+//   - a grapheme/phoneme aligner: letters are aligned to phones (with
+//     silent letters and inserted phones) and the letter-to-phone
+//     probabilities are re-estimated from the alignments a few times. The
+//     alignment cost is the average cost in bits per link, also scored
+//     leave-one-out.
+//
+// Both costs are turned into z-scores and summed, so the top of the list
+// holds the pairs that are unusual on both counts:
+//
+//	<word>\t<IPA>\t<score>\t<phonotactic>\t<alignment>\t<worst n-gram>\t<worst link>
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+	"golang.org/x/text/unicode/norm"
+
+	"ipadict/phone"
+	"ipadict/remote"
+)
+
+// boundaryPhone pads phone sequences at word boundaries.
+const boundaryPhone = "#"
+
+// Smoothing and training constants.
+const (
+	ngramPrior  = 1.0  // weight of the lower-order estimate in the n-gram model
+	alignPrior  = 0.1  // additive smoothing of letter/phone counts
+	alignSilent = 0.25 // initial weight of a silent letter
+	alignPasses = 3    // re-estimation passes of the aligner
+)
+
+// Defaults and limits of the command-line flags.
+const (
+	defaultTop    = 100
+	defaultNgramN = 3
+	maxNgramOrder = 6
+)
+
+// gramSeparator joins the phones of an n-gram count key.
+const gramSeparator = "\x1f"
+
+// silentGrapheme is the phone of a silent letter in the aligner counts.
+const silentGrapheme = ""
+
+// ngramModel is a phone n-gram model with interpolated smoothing.
+type ngramModel struct {
+	order   int
+	counts  map[string]int // n-gram -> occurrences, for every order 1..n
+	context map[string]int // history -> occurrences as a history
+	total   int            // unigram occurrences
+	vocab   map[string]bool
+}
+
+// newNgramModel returns an empty model of the given order.
+func newNgramModel(order int) *ngramModel {
+	return &ngramModel{
+		order:   order,
+		counts:  make(map[string]int),
+		context: make(map[string]int),
+		vocab:   make(map[string]bool),
+	}
+}
+
+// grams calls fn for every history/phone pair of seq, padded with word
+// boundaries, at every order.
+func (m *ngramModel) grams(seq []string, fn func(hist []string, w string)) {
+	padded := make([]string, 0, len(seq)+m.order)
+	for i := 1; i < m.order; i++ {
+		padded = append(padded, boundaryPhone)
+	}
+	padded = append(padded, seq...)
+	padded = append(padded, boundaryPhone)
+	for i := m.order - 1; i < len(padded); i++ {
+		for k := 1; k <= m.order; k++ {
+			fn(padded[i-k+1:i], padded[i])
+		}
+	}
+}
+
+// add counts the n-grams of seq.
+func (m *ngramModel) add(seq []string) {
+	m.grams(seq, func(hist []string, w string) {
+		m.counts[joinGram(hist, w)]++
+		if len(hist) == 0 {
+			m.total++
+			m.vocab[w] = true
+		} else {
+			m.context[strings.Join(hist, gramSeparator)]++
+		}
+	})
+}
+
+// joinGram returns the count key of hist followed by w.
+func joinGram(hist []string, w string) string {
+	if len(hist) == 0 {
+		return w
+	}
+	return strings.Join(hist, gramSeparator) + gramSeparator + w
+}
+
+// surprise scores seq leave-one-out. It returns the average surprise in
+// bits per phone (boundary included) and the most surprising n-gram.
+func (m *ngramModel) surprise(seq []string) (float64, string) {
+	self := newNgramModel(m.order)
+	self.add(seq)
+
+	var sum, worst float64
+	var worstGram string
+	n := 0
+	m.grams(seq, func(hist []string, w string) {
+		if len(hist) != m.order-1 {
+			return
+		}
+		bits := -math.Log2(m.prob(hist, w, self))
+		sum += bits
+		n++
+		if bits > worst {
+			worst = bits
+			worstGram = strings.Join(append(append([]string(nil), hist...), w), " ")
+		}
+	})
+	if n == 0 {
+		return 0, ""
+	}
+	return sum / float64(n), worstGram
+}
+
+// prob returns P(w | hist) with the counts of self removed, interpolating
+// each order with the next lower one.
+func (m *ngramModel) prob(hist []string, w string, self *ngramModel) float64 {
+	if len(hist) == 0 {
+		c := m.counts[w] - self.counts[w]
+		return (float64(c) + 1) / float64(m.total-self.total+len(m.vocab)+1)
+	}
+	lower := m.prob(hist[1:], w, self)
+	key := strings.Join(hist, gramSeparator)
+	c := m.counts[joinGram(hist, w)] - self.counts[joinGram(hist, w)]
+	ch := m.context[key] - self.context[key]
+	return (float64(c) + ngramPrior*lower) / (float64(ch) + ngramPrior)
+}
+
+// aligner scores grapheme/phoneme correspondences.
+type aligner struct {
+	sub     map[string]map[string]float64 // letter -> phone (or silentGrapheme) -> count
+	letters map[string]float64            // letter -> count
+	ins     map[string]float64            // phone -> insertions
+	insSum  float64
+	units   float64 // letters aligned
+	phones  map[string]bool
+}
+
+// newAligner returns an aligner initialized from letter/phone
+// co-occurrence in pairs.
+func newAligner(pairs []anomalyPair) *aligner {
+	a := &aligner{
+		sub:     make(map[string]map[string]float64),
+		letters: make(map[string]float64),
+		ins:     make(map[string]float64),
+		phones:  make(map[string]bool),
+	}
+	for _, p := range pairs {
+		for _, ph := range p.Phones {
+			a.phones[ph] = true
+		}
+		for _, l := range p.Letters {
+			for _, ph := range p.Phones {
+				a.count(l, ph, 1/float64(len(p.Phones)))
+			}
+			a.count(l, silentGrapheme, alignSilent)
+		}
+	}
+	return a
+}
+
+// count adds w to the letter/phone count.
+func (a *aligner) count(letter, ph string, w float64) {
+	if a.sub[letter] == nil {
+		a.sub[letter] = make(map[string]float64)
+	}
+	a.sub[letter][ph] += w
+	a.letters[letter] += w
+	a.units += w
+}
+
+// cost returns the cost in bits of letter realized as ph (silentGrapheme
+// for a silent letter), with the counts of self removed. self may be nil.
+func (a *aligner) cost(letter, ph string, self *aligner) float64 {
+	v := float64(len(a.phones) + 1)
+	c := a.sub[letter][ph] - self.subCount(letter, ph)
+	n := a.letters[letter] - self.letterCount(letter)
+	return -math.Log2((c + alignPrior) / (n + alignPrior*v))
+}
+
+// insertCost returns the cost in bits of a phone with no letter, with the
+// counts of self removed. self may be nil.
+func (a *aligner) insertCost(ph string, self *aligner) float64 {
+	v := float64(len(a.phones))
+	ins := a.insSum - self.insertions()
+	units := a.units - self.alignedLetters()
+	pInsert := (ins + 1) / (units + ins + 1)
+	return -math.Log2(pInsert) - math.Log2((a.ins[ph]-self.insertCount(ph)+alignPrior)/(ins+alignPrior*v))
+}
+
+// Count accessors that accept a nil aligner.
+
+func (a *aligner) subCount(letter, ph string) float64 {
+	if a == nil {
+		return 0
+	}
+	return a.sub[letter][ph]
+}
+
+func (a *aligner) letterCount(letter string) float64 {
+	if a == nil {
+		return 0
+	}
+	return a.letters[letter]
+}
+
+func (a *aligner) insertCount(ph string) float64 {
+	if a == nil {
+		return 0
+	}
+	return a.ins[ph]
+}
+
+func (a *aligner) insertions() float64 {
+	if a == nil {
+		return 0
+	}
+	return a.insSum
+}
+
+func (a *aligner) alignedLetters() float64 {
+	if a == nil {
+		return 0
+	}
+	return a.units
+}
+
+// alignLink is one step of an alignment; Letter or Phone is empty for a
+// silent letter or an inserted phone.
+type alignLink struct {
+	Letter, Phone string
+	Cost          float64
+}
+
+// align returns the cheapest alignment of letters with phones.
+func (a *aligner) align(letters, phones []string) []alignLink {
+	n, m := len(letters), len(phones)
+	cost := make([][]float64, n+1)
+	back := make([][]byte, n+1)
+	for i := range cost {
+		cost[i] = make([]float64, m+1)
+		back[i] = make([]byte, m+1)
+	}
+	for i := 0; i <= n; i++ {
+		for j := 0; j <= m; j++ {
+			if i == 0 && j == 0 {
+				continue
+			}
+			best := math.Inf(1)
+			if i > 0 && j > 0 {
+				if c := cost[i-1][j-1] + a.cost(letters[i-1], phones[j-1], nil); c < best {
+					best, back[i][j] = c, 's'
+				}
+			}
+			if i > 0 {
+				if c := cost[i-1][j] + a.cost(letters[i-1], silentGrapheme, nil); c < best {
+					best, back[i][j] = c, 'd'
+				}
+			}
+			if j > 0 {
+				if c := cost[i][j-1] + a.insertCost(phones[j-1], nil); c < best {
+					best, back[i][j] = c, 'i'
+				}
+			}
+			cost[i][j] = best
+		}
+	}
+
+	var links []alignLink
+	for i, j := n, m; i > 0 || j > 0; {
+		switch back[i][j] {
+		case 's':
+			links = append(links, alignLink{letters[i-1], phones[j-1], a.cost(letters[i-1], phones[j-1], nil)})
+			i, j = i-1, j-1
+		case 'd':
+			links = append(links, alignLink{letters[i-1], "", a.cost(letters[i-1], silentGrapheme, nil)})
+			i--
+		default:
+			links = append(links, alignLink{"", phones[j-1], a.insertCost(phones[j-1], nil)})
+			j--
+		}
+	}
+	for l, r := 0, len(links)-1; l < r; l, r = l+1, r-1 {
+		links[l], links[r] = links[r], links[l]
+	}
+	return links
+}
+
+// train re-estimates the letter/phone counts from the current best
+// alignments of pairs.
+func (a *aligner) train(pairs []anomalyPair) {
+	next := &aligner{
+		sub:     make(map[string]map[string]float64),
+		letters: make(map[string]float64),
+		ins:     make(map[string]float64),
+		phones:  a.phones,
+	}
+	for _, p := range pairs {
+		next.addLinks(a.align(p.Letters, p.Phones))
+	}
+	*a = *next
+}
+
+// addLinks counts the links of an alignment.
+func (a *aligner) addLinks(links []alignLink) {
+	for _, link := range links {
+		if link.Letter == "" {
+			a.ins[link.Phone]++
+			a.insSum++
+			continue
+		}
+		a.count(link.Letter, link.Phone, 1)
+	}
+}
+
+// surprise scores an alignment leave-one-out. It returns the average cost
+// in bits per link and the most costly link.
+func (a *aligner) surprise(links []alignLink) (float64, string) {
+	self := &aligner{
+		sub:     make(map[string]map[string]float64),
+		letters: make(map[string]float64),
+		ins:     make(map[string]float64),
+	}
+	self.addLinks(links)
+
+	var sum float64
+	worst, worstLink := -1.0, ""
+	for _, link := range links {
+		var bits float64
+		if link.Letter == "" {
+			bits = a.insertCost(link.Phone, self)
+		} else {
+			bits = a.cost(link.Letter, link.Phone, self)
+		}
+		sum += bits
+		if bits > worst {
+			worst, worstLink = bits, formatLink(link)
+		}
+	}
+	if len(links) == 0 {
+		return 0, ""
+	}
+	return sum / float64(len(links)), worstLink
+}
+
+// anomalyPair is a word/pronunciation pair with its scores.
+type anomalyPair struct {
+	Word, Pron  string
+	Letters     []string
+	Phones      []string
+	Phonotactic float64 // bits per phone
+	Alignment   float64 // bits per alignment link
+	Score       float64 // sum of the z-scores of both costs
+	WorstGram   string
+	WorstLink   string
+}
+
+// graphemes returns the lowercase letters of word, one per rune in NFC.
+func graphemes(word string) []string {
+	var letters []string
+	for _, r := range norm.NFC.String(strings.ToLower(word)) {
+		if unicode.IsLetter(r) {
+			letters = append(letters, string(r))
+		}
+	}
+	return letters
+}
+
+// scoreAnomalies builds both models from entries and returns the scored
+// pairs, most anomalous first.
+func scoreAnomalies(entries map[string][]string, order int) []anomalyPair {
+	var pairs []anomalyPair
+	model := newNgramModel(order)
+	for word, prons := range entries {
+		for _, pron := range prons {
+			phones := phone.Segment(pron)
+			if len(phones) == 0 {
+				continue
+			}
+			model.add(phones)
+			pairs = append(pairs, anomalyPair{Word: word, Pron: pron, Letters: graphemes(word), Phones: phones})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Word != pairs[j].Word {
+			return pairs[i].Word < pairs[j].Word
+		}
+		return pairs[i].Pron < pairs[j].Pron
+	})
+
+	al := newAligner(pairs)
+	for i := 0; i < alignPasses; i++ {
+		al.train(pairs)
+	}
+
+	for i := range pairs {
+		p := &pairs[i]
+		p.Phonotactic, p.WorstGram = model.surprise(p.Phones)
+		if len(p.Letters) == 0 {
+			continue
+		}
+		p.Alignment, p.WorstLink = al.surprise(al.align(p.Letters, p.Phones))
+	}
+
+	phonMean, phonStd := meanStd(pairs, func(p anomalyPair) float64 { return p.Phonotactic })
+	alignMean, alignStd := meanStd(pairs, func(p anomalyPair) float64 { return p.Alignment })
+	for i := range pairs {
+		pairs[i].Score = zScore(pairs[i].Phonotactic, phonMean, phonStd) +
+			zScore(pairs[i].Alignment, alignMean, alignStd)
+	}
+	return pairs
+}
+
+// formatLink renders an alignment link as "letter→phone", with "∅" for a
+// silent letter or an inserted phone.
+func formatLink(link alignLink) string {
+	l, p := link.Letter, link.Phone
+	if l == "" {
+		l = "∅"
+	}
+	if p == "" {
+		p = "∅"
+	}
+	return l + "→" + p
+}
+
+// meanStd returns the mean and standard deviation of f over pairs.
+func meanStd(pairs []anomalyPair, f func(anomalyPair) float64) (float64, float64) {
+	if len(pairs) == 0 {
+		return 0, 0
+	}
+	var sum, sq float64
+	for _, p := range pairs {
+		sum += f(p)
+	}
+	mean := sum / float64(len(pairs))
+	for _, p := range pairs {
+		d := f(p) - mean
+		sq += d * d
+	}
+	return mean, math.Sqrt(sq / float64(len(pairs)))
+}
+
+// zScore returns the number of standard deviations v is above mean.
+func zScore(v, mean, std float64) float64 {
+	if std == 0 {
+		return 0
+	}
+	return (v - mean) / std
+}
+
+// sortAnomalies orders pairs by decreasing cost of the given kind:
+// "score", "phonotactic" or "alignment".
+func sortAnomalies(pairs []anomalyPair, by string) {
+	key := func(p anomalyPair) float64 {
+		switch by {
+		case "phonotactic":
+			return p.Phonotactic
+		case "alignment":
+			return p.Alignment
+		}
+		return p.Score
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return key(pairs[i]) > key(pairs[j])
+	})
+}
+
+// writeAnomalies prints the first top pairs (all when top is 0).
+func writeAnomalies(w io.Writer, pairs []anomalyPair, top int) error {
+	if top > 0 && len(pairs) > top {
+		pairs = pairs[:top]
+	}
+	format := func(f float64) string { return strconv.FormatFloat(f, 'f', 2, 64) }
+	bw := bufio.NewWriter(w)
+	for _, p := range pairs {
+		fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			p.Word, p.Pron, format(p.Score), format(p.Phonotactic), format(p.Alignment), p.WorstGram, p.WorstLink)
+	}
+	return bw.Flush()
+}
+
+// runAnomalies implements "ipadict anomalies [flags] DICT [DICT ...]".
+func runAnomalies(args []string) error {
+	fs := flag.NewFlagSet("ipadict anomalies", flag.ContinueOnError)
+	top := fs.Int("top", defaultTop, "number of pairs to print (0 for all)")
+	order := fs.Int("order", defaultNgramN, "phone n-gram order")
+	sortBy := fs.String("sort", "score", "ranking: score, phonotactic or alignment")
+	cacheDir := fs.String("cache-dir", remote.DefaultCacheDir(), "cache directory for dictionaries loaded over HTTP/HTTPS")
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		printUsage(os.Stderr)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printUsage(os.Stdout)
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: ipadict anomalies [--top N] [--order N] [--sort score|phonotactic|alignment] [--cache-dir DIR] DICT [DICT ...]")
+	}
+	if *top < 0 {
+		return fmt.Errorf("invalid --top value %d (must be >= 0)", *top)
+	}
+	if *order < 1 || *order > maxNgramOrder {
+		return fmt.Errorf("invalid --order value %d (must be between 1 and %d)", *order, maxNgramOrder)
+	}
+	switch *sortBy {
+	case "score", "phonotactic", "alignment":
+	default:
+		return fmt.Errorf("invalid --sort value %q (must be \"score\", \"phonotactic\" or \"alignment\")", *sortBy)
+	}
+
+	rep := phono.NewRepresentation()
+	if err := loadDictionaries(rep, phono.MergeModeAppend, *cacheDir, fs.Args()...); err != nil {
+		return err
+	}
+	pairs := scoreAnomalies(rep.Entries, *order)
+	sortAnomalies(pairs, *sortBy)
+	if err := writeAnomalies(os.Stdout, pairs, *top); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Scored word/pron pairs: %d (phone %d-gram model, alignment passes: %d)\n",
+		len(pairs), *order, alignPasses)
+	return nil
+}
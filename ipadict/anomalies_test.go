@@ -0,0 +1,91 @@
+// File path: tipatools/ipadict/anomalies_test.go
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// anomalyDict is a small regular dictionary with one pronunciation that
+// belongs to another word.
+var anomalyDict = map[string][]string{
+	"ami": {"ami"}, "amie": {"ami"}, "bal": {"bal"}, "banane": {"banan"},
+	"bile": {"bil"}, "bol": {"bɔl"}, "dame": {"dam"}, "date": {"dat"},
+	"dire": {"diʁ"}, "domino": {"dɔmino"}, "fil": {"fil"}, "fine": {"fin"},
+	"lama": {"lama"}, "lame": {"lam"}, "lime": {"lim"}, "lire": {"liʁ"},
+	"malade": {"malad"}, "mari": {"maʁi"}, "midi": {"midi"}, "mine": {"min"},
+	"moral": {"mɔʁal"}, "nid": {"ni"}, "note": {"nɔt"}, "ordinal": {"ɔʁdinal"},
+	"pari": {"paʁi"}, "pile": {"pil"}, "rame": {"ʁam"}, "rire": {"ʁiʁ"},
+	"salade": {"salad"}, "tapis": {"tapi"}, "tire": {"tiʁ"}, "vide": {"vid"},
+	"animal": {"ʃwɛ̃ɡœ"}, // not the pronunciation of animal
+}
+
+func TestScoreAnomalies(t *testing.T) {
+	pairs := scoreAnomalies(anomalyDict, 3)
+	if len(pairs) != len(anomalyDict) {
+		t.Fatalf("scored %d pairs, want %d", len(pairs), len(anomalyDict))
+	}
+	for _, by := range []string{"score", "phonotactic", "alignment"} {
+		sortAnomalies(pairs, by)
+		if pairs[0].Word != "animal" {
+			t.Errorf("by %s: most anomalous = %s /%s/, want animal", by, pairs[0].Word, pairs[0].Pron)
+		}
+	}
+	sortAnomalies(pairs, "score")
+	if bad := pairs[0]; bad.Score <= 0 || bad.WorstGram == "" || bad.WorstLink == "" {
+		t.Errorf("animal: score %.2f, worst gram %q, worst link %q", bad.Score, bad.WorstGram, bad.WorstLink)
+	}
+	for _, p := range pairs[1:] {
+		if p.Score >= pairs[0].Score {
+			t.Errorf("%s scores %.2f, not below animal (%.2f)", p.Word, p.Score, pairs[0].Score)
+		}
+	}
+}
+
+func TestScoreAnomaliesSkipsEmpty(t *testing.T) {
+	pairs := scoreAnomalies(map[string][]string{"a": {"a"}, "b": {"", "ˈ"}, "42": {"kaʁɑ̃t"}}, 2)
+	var words []string
+	for _, p := range pairs {
+		words = append(words, p.Word)
+	}
+	// Pronunciations without phones are skipped; words without letters are
+	// scored on phonotactics only.
+	if !reflect.DeepEqual(words, []string{"42", "a"}) {
+		t.Errorf("scored words = %q", words)
+	}
+	if pairs[0].Alignment != 0 || pairs[0].WorstLink != "" {
+		t.Errorf("42 aligned: %+v", pairs[0])
+	}
+}
+
+func TestGraphemes(t *testing.T) {
+	got := graphemes("Aujourd'hui-Été")
+	want := []string{"a", "u", "j", "o", "u", "r", "d", "h", "u", "i", "é", "t", "é"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("graphemes = %q, want %q", got, want)
+	}
+}
+
+func TestWriteAnomalies(t *testing.T) {
+	pairs := []anomalyPair{
+		{Word: "animal", Pron: "ʃwɛ̃", Score: 4.5, Phonotactic: 3.25, Alignment: 6, WorstGram: "ʃ w", WorstLink: "a→ʃ"},
+		{Word: "ami", Pron: "ami", Score: -1},
+	}
+	var buf bytes.Buffer
+	if err := writeAnomalies(&buf, pairs, 1); err != nil {
+		t.Fatal(err)
+	}
+	if want := "animal\tʃwɛ̃\t4.50\t3.25\t6.00\tʃ w\ta→ʃ\n"; buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+	buf.Reset()
+	if err := writeAnomalies(&buf, pairs, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("top 0 wrote %d lines, want all 2", n)
+	}
+}
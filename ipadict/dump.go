@@ -0,0 +1,422 @@
+// File path: tipatools/ipadict/dump.go
+
+package main
+
+// Wiktionary / Wikipedia dump scanning with a page filter.
+//
+// A local dump that keeps every page, and that the tipa parser can read
+// (plain XML or bzip2, see tipaReadable), is handed to wikipedia.XMLDump as
+// is. Otherwise the dump is decoded page by page with encoding/xml, so that
+// page metadata (title, namespace) is available before any wikitext is
+// inspected. Pages rejected by the namespace and title filters are dropped;
+// the pronunciation templates of the kept ones are read with the wikitext
+// tokenizer (see extractPronunciations), so that multi-line and nested
+// templates, comments and <nowiki> blocks are handled, and merged into the
+// representation. Templates, appendices, thesaurus and user pages therefore
+// never contribute pronunciations.
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+	"github.com/temporal-IPA/tipa/pkg/phono/wikipedia"
+
+	"ipadict/wikitext"
+	"ipadict/wordkey"
+)
+
+// mainNamespaceName is the display name used for namespace 0, which has an
+// empty name in the dump siteinfo.
+const mainNamespaceName = "(main)"
+
+// pageFilter selects which pages of a dump contribute pronunciations.
+//
+// Namespaces holds the raw --namespace values (numeric keys or names such as
+// "main", "Annexe", "Template"). They are resolved against the <siteinfo>
+// block of each dump, since namespace names are localized per wiki. An empty
+// list or the value "all" keeps every namespace.
+type pageFilter struct {
+	Namespaces   []string
+	TitleRegex   *regexp.Regexp // when set, titles must match
+	ExcludeTitle *regexp.Regexp // when set, matching titles are skipped
+}
+
+// allNamespaces reports whether the filter keeps pages from every namespace.
+func (f pageFilter) allNamespaces() bool {
+	if len(f.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range f.Namespaces {
+		if strings.EqualFold(ns, "all") || ns == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveNamespaces maps the raw --namespace values to namespace keys using
+// the names declared by the dump.
+func (f pageFilter) resolveNamespaces(names map[int]string) (map[int]bool, error) {
+	keys := make(map[int]bool, len(f.Namespaces))
+	for _, raw := range f.Namespaces {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(raw); err == nil {
+			keys[n] = true
+			continue
+		}
+		if strings.EqualFold(raw, "main") || raw == mainNamespaceName {
+			keys[0] = true
+			continue
+		}
+		found := false
+		for key, name := range names {
+			if strings.EqualFold(name, raw) {
+				keys[key] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown namespace %q", raw)
+		}
+	}
+	return keys, nil
+}
+
+// progressEveryLines is the number of wikitext lines between two calls of
+// dumpScanner.Progress on filtered dumps.
+const progressEveryLines = 100000
+
+// dumpStats summarises a single dump scan.
+type dumpStats struct {
+	Unfiltered   bool           // handed to the tipa parser as is: pages are not counted
+	Pages        int            // pages read from the dump
+	Kept         int            // pages that passed the filters
+	Lines        int            // wikitext lines of the kept pages
+	Skipped      map[string]int // pages skipped by the namespace filter, per namespace
+	TitleSkipped int            // pages skipped by --title-regex / --exclude-title
+	Elapsed      time.Duration
+}
+
+// xmlSiteInfo is the subset of <siteinfo> needed to name namespaces.
+type xmlSiteInfo struct {
+	Namespaces []struct {
+		Key  int    `xml:"key,attr"`
+		Name string `xml:",chardata"`
+	} `xml:"namespaces>namespace"`
+}
+
+// xmlPage is the subset of a <page> element kept by the filter.
+type xmlPage struct {
+	Title string `xml:"title"`
+	NS    int    `xml:"ns"`
+	ID    int64  `xml:"id"`
+	Text  string `xml:"revision>text"`
+}
+
+// dumpScanner filters the pages of a single XML dump and merges the
+// pronunciations of the kept ones.
+type dumpScanner struct {
+	Lang   string
+	Mode   phono.MergeMode
+	Filter pageFilter
+
+	// Progress, when set, is called every progressEveryLines lines of
+	// wikitext (see wikipedia.XMLDump).
+	Progress func(lines, words, uniquePairs int)
+
+	// OnPage, when set, is called with the page ID, the word and the
+	// pronunciations merged from every kept page. Pages without an ID get a
+	// negative ordinal instead.
+	OnPage func(id int64, word string, prons []string)
+}
+
+// ParseSource scans the dump at src (local path or HTTP/HTTPS URL, plain or
+// compressed) and merges the pronunciations of the kept pages into rep.
+func (s *dumpScanner) ParseSource(src string, rep *phono.Representation) (dumpStats, error) {
+	if s.unfiltered() && !isHTTPURL(src) {
+		readable, err := tipaReadable(src)
+		if err != nil {
+			return dumpStats{Skipped: make(map[string]int)}, err
+		}
+		if readable {
+			return s.parseUnfiltered(src, rep)
+		}
+	}
+	rc, err := openSource(src)
+	if err != nil {
+		return dumpStats{Skipped: make(map[string]int)}, err
+	}
+	defer rc.Close()
+	return s.Parse(rc, rep)
+}
+
+// unfiltered reports whether s keeps every page and has no page callback,
+// so that a dump can be handed to the tipa parser as is.
+func (s *dumpScanner) unfiltered() bool {
+	return s.Filter.allNamespaces() && s.Filter.TitleRegex == nil && s.Filter.ExcludeTitle == nil && s.OnPage == nil
+}
+
+// tipaReadable reports whether the tipa parser reads the local dump at path
+// by itself: plain XML, or bzip2 under a name it recognizes ("*.xml.bz2",
+// "*wiktionary*.bz2", "*wikipedia*.bz2").
+func tipaReadable(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, 6)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+
+	name := strings.ToLower(filepath.Base(path))
+	bz2 := strings.HasSuffix(name, ".bz2")
+	switch sniffCompression(head[:n]) {
+	case compressionNone:
+		return !bz2, nil
+	case compressionBzip2:
+		return bz2 && (strings.HasSuffix(name, ".xml.bz2") ||
+			strings.Contains(name, "wiktionary") || strings.Contains(name, "wikipedia")), nil
+	}
+	return false, nil
+}
+
+// parseUnfiltered hands the local dump at path to the tipa parser.
+func (s *dumpScanner) parseUnfiltered(path string, rep *phono.Representation) (dumpStats, error) {
+	start := time.Now()
+	parser := wikipedia.NewXMLDump(s.Lang, s.Mode)
+	parser.Progress = s.Progress
+	parsed, err := parser.ParseSource(path, rep)
+	return dumpStats{
+		Unfiltered: true,
+		Lines:      parsed.Lines,
+		Skipped:    make(map[string]int),
+		Elapsed:    time.Since(start),
+	}, err
+}
+
+// Parse decodes the dump from r, already opened and decompressed, and merges
+// the pronunciations of the pages accepted by the filter into rep.
+func (s *dumpScanner) Parse(r io.Reader, rep *phono.Representation) (dumpStats, error) {
+	start := time.Now()
+	stats := dumpStats{Skipped: make(map[string]int)}
+	err := s.scanPages(r, rep, &stats)
+	stats.Elapsed = time.Since(start)
+	return stats, err
+}
+
+// scanPages is the page loop of Parse.
+func (s *dumpScanner) scanPages(r io.Reader, rep *phono.Representation, stats *dumpStats) error {
+	nsNames := map[int]string{}
+	var nsKeys map[int]bool
+	keepAll := s.Filter.allNamespaces()
+	resolved := false
+	nextProgress := progressEveryLines
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("decode xml: %w", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch se.Name.Local {
+		case "siteinfo":
+			var si xmlSiteInfo
+			if err := dec.DecodeElement(&si, &se); err != nil {
+				return fmt.Errorf("decode siteinfo: %w", err)
+			}
+			for _, ns := range si.Namespaces {
+				nsNames[ns.Key] = strings.TrimSpace(ns.Name)
+			}
+
+		case "page":
+			if !keepAll && !resolved {
+				nsKeys, err = s.Filter.resolveNamespaces(nsNames)
+				if err != nil {
+					return err
+				}
+				resolved = true
+			}
+
+			var page xmlPage
+			if err := dec.DecodeElement(&page, &se); err != nil {
+				return fmt.Errorf("decode page: %w", err)
+			}
+			stats.Pages++
+
+			if !keepAll && !nsKeys[page.NS] {
+				stats.Skipped[namespaceName(nsNames, page.NS)]++
+				continue
+			}
+			if !s.Filter.keepTitle(page.Title) {
+				stats.TitleSkipped++
+				continue
+			}
+			stats.Kept++
+			stats.Lines += strings.Count(page.Text, "\n") + 1
+
+			word := wordkey.Phrase(strings.TrimSpace(page.Title))
+			var prons []string
+			if word != "" {
+				prons = extractPronunciations(page.Text, s.Lang)
+			}
+			if len(prons) > 0 {
+				mergeEntries(rep, s.Mode, map[string][]string{word: prons})
+			}
+			if s.OnPage != nil {
+				id := page.ID
+				if id == 0 {
+					id = -int64(stats.Pages)
+				}
+				s.OnPage(id, word, prons)
+			}
+			if s.Progress != nil && stats.Lines >= nextProgress {
+				s.Progress(stats.Lines, len(rep.Entries), len(rep.SeenWordPron))
+				nextProgress = stats.Lines + progressEveryLines
+			}
+		}
+	}
+	return nil
+}
+
+// keepTitle applies --title-regex and --exclude-title to a page title.
+func (f pageFilter) keepTitle(title string) bool {
+	if f.TitleRegex != nil && !f.TitleRegex.MatchString(title) {
+		return false
+	}
+	if f.ExcludeTitle != nil && f.ExcludeTitle.MatchString(title) {
+		return false
+	}
+	return true
+}
+
+// namespaceName returns a printable name for namespace key.
+func namespaceName(names map[int]string, key int) string {
+	if key == 0 {
+		return mainNamespaceName
+	}
+	if name := names[key]; name != "" {
+		return name
+	}
+	return strconv.Itoa(key)
+}
+
+// formatSkipped renders per-namespace skip counts, largest first.
+func formatSkipped(skipped map[string]int) string {
+	names := make([]string, 0, len(skipped))
+	for name := range skipped {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if skipped[names[i]] != skipped[names[j]] {
+			return skipped[names[i]] > skipped[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %d", name, skipped[name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// isPronunciationTemplate reports whether t is a {{pron}} / {{API}} template.
+func isPronunciationTemplate(t *wikitext.Template) bool {
+	name := strings.ToLower(t.Name)
+	return name == "pron" || name == "api"
+}
+
+// extractPronunciations returns the pronunciation parameters of the
+// {{pron|...}} and {{API|...}} templates found in the wikitext of a page for
+// the given language code, including templates nested in other templates.
+//
+// The positional parameters that appear before the language code (or every
+// positional parameter when the language is given as lang=CODE) and look
+// like IPA are kept, without their "/" or "[]" delimiters and with their
+// white space collapsed.
+func extractPronunciations(text, lang string) []string {
+	var prons []string
+	for _, top := range wikitext.ParseString(text) {
+		top.Walk(func(t *wikitext.Template) {
+			if !isPronunciationTemplate(t) {
+				return
+			}
+			prons = append(prons, pronunciationParams(t, lang)...)
+		})
+	}
+	return prons
+}
+
+// pronunciationParams returns the positional parameters of t before the
+// language code. Templates for another language yield
+// nothing.
+func pronunciationParams(t *wikitext.Template, lang string) []string {
+	params := t.Positional()
+	langAt := -1
+	for i, p := range params {
+		if strings.EqualFold(strings.TrimSpace(p), lang) {
+			langAt = i
+			break
+		}
+	}
+	if langAt < 0 {
+		named, ok := t.Named("lang")
+		if !ok || !strings.EqualFold(named, lang) {
+			return nil
+		}
+		langAt = len(params)
+	}
+	var prons []string
+	for _, p := range params[:langAt] {
+		p = strings.Join(strings.Fields(strings.Trim(strings.TrimSpace(p), "/[]")), " ")
+		if looksLikeIPA(p) {
+			prons = append(prons, p)
+		}
+	}
+	return prons
+}
+
+// ipaPunctuation lists the symbols other than letters, combining marks and
+// spaces that may appear in a pronunciation parameter.
+const ipaPunctuation = "ˈˌːˑ.‿‖-()"
+
+// looksLikeIPA reports whether p can be a pronunciation: at least one letter,
+// and nothing but letters, combining marks, spaces and ipaPunctuation. This
+// rejects markup (italics, links, <sup> tags, nested templates) and free
+// text with digits.
+func looksLikeIPA(p string) bool {
+	letter := false
+	for _, r := range p {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.Is(unicode.Mn, r), r == ' ', strings.ContainsRune(ipaPunctuation, r):
+		default:
+			return false
+		}
+	}
+	return letter
+}
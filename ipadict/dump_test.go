@@ -0,0 +1,127 @@
+// File path: tipatools/ipadict/dump_test.go
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+const filterDump = `<mediawiki>
+<siteinfo><namespaces><namespace key="0" /><namespace key="10">Modèle</namespace><namespace key="100">Annexe</namespace></namespaces></siteinfo>
+<page><title>chat</title><ns>0</ns><id>1</id><revision><id>9</id><text>{{pron|ʃa|fr}}
+&lt;b&gt;a &amp; b&lt;/b&gt;</text></revision></page>
+<page><title>Modèle:pron</title><ns>10</ns><id>2</id><revision><text>{{pron|xxx|fr}}</text></revision></page>
+<page><title>Annexe:Sons</title><ns>100</ns><id>3</id><revision><text>{{pron|a|fr}}</text></revision></page>
+<page><title>pomme  de terre</title><ns>0</ns><revision><text>{{pron|pɔm də tɛʁ|fr}}</text></revision></page>
+<page><title>chat2</title><ns>0</ns><id>5</id><revision><text>{{pron|ʃa|fr}}</text></revision></page>
+</mediawiki>
+`
+
+func TestScanPages(t *testing.T) {
+	s := &dumpScanner{Lang: "fr", Mode: phono.MergeModeAppend, Filter: pageFilter{
+		Namespaces:   []string{"main", "Annexe"},
+		ExcludeTitle: regexp.MustCompile(`[0-9]`),
+	}}
+	var seen []string
+	s.OnPage = func(id int64, word string, prons []string) {
+		seen = append(seen, fmt.Sprintf("%d:%s:%s", id, word, strings.Join(prons, ",")))
+	}
+
+	rep := phono.NewRepresentation()
+	stats, err := s.Parse(strings.NewReader(filterDump), rep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Unfiltered || stats.Pages != 5 || stats.Kept != 3 || stats.Lines != 4 || stats.TitleSkipped != 1 || stats.Skipped["Modèle"] != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	// The page without an ID gets its negative ordinal.
+	if want := "1:chat:ʃa|3:Annexe:Sons:a|-4:pomme de terre:pɔm də tɛʁ"; strings.Join(seen, "|") != want {
+		t.Errorf("kept pages = %q, want %q", strings.Join(seen, "|"), want)
+	}
+	want := map[string][]string{"chat": {"ʃa"}, "Annexe:Sons": {"a"}, "pomme de terre": {"pɔm də tɛʁ"}}
+	if !reflect.DeepEqual(map[string][]string(rep.Entries), want) {
+		t.Errorf("entries = %v, want %v", rep.Entries, want)
+	}
+	if len(rep.SeenWordPron) != 3 {
+		t.Errorf("seen pairs = %d, want 3", len(rep.SeenWordPron))
+	}
+}
+
+func TestScanPagesUnknownNamespace(t *testing.T) {
+	s := &dumpScanner{Filter: pageFilter{Namespaces: []string{"Thésaurus"}}}
+	_, err := s.Parse(strings.NewReader(filterDump), phono.NewRepresentation())
+	if err == nil || !strings.Contains(err.Error(), "Thésaurus") {
+		t.Errorf("err = %v, want an unknown namespace error", err)
+	}
+}
+
+func TestUnfiltered(t *testing.T) {
+	tests := []struct {
+		scanner dumpScanner
+		want    bool
+	}{
+		{dumpScanner{}, true},
+		{dumpScanner{Filter: pageFilter{Namespaces: []string{"all"}}}, true},
+		{dumpScanner{Filter: pageFilter{Namespaces: []string{"main"}}}, false},
+		{dumpScanner{Filter: pageFilter{ExcludeTitle: regexp.MustCompile(`:`)}}, false},
+		{dumpScanner{OnPage: func(int64, string, []string) {}}, false},
+	}
+	for i, tt := range tests {
+		if got := tt.scanner.unfiltered(); got != tt.want {
+			t.Errorf("%d: unfiltered() = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestTipaReadable(t *testing.T) {
+	dir := t.TempDir()
+	xmlData := []byte(filterDump)
+	// Only the magic bytes are read.
+	bz := []byte("BZh91AY&SY")
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"pages.xml", xmlData, true},
+		{"pages", xmlData, true},
+		{"pages.xml.bz2", xmlData, false},
+		{"pages.xml.bz2", bz, true},
+		{"frwiktionary-latest.bz2", bz, true},
+		{"pages.bz2", bz, false},
+		{"pages.xml", bz, false},
+		{"pages.xml.gz", compressed(t, "gzip", xmlData), false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := tipaReadable(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s (%d bytes): tipaReadable = %v, want %v", tt.name, len(tt.data), got, tt.want)
+		}
+	}
+}
+
+func TestExtractPronunciations(t *testing.T) {
+	text := "{{pron|ʃa|/ʃɑ/|fr}} {{pron|kat|en}} {{API|ʃa|lang=fr}} {{lien|{{pron|ʃaʃa|fr}}}}" +
+		"{{pron|pɔm\n də tɛʁ|fr}} {{pron|ʃa<!-- x -->|fr}} {{pron|<nowiki>[</nowiki>ʁe<nowiki>]</nowiki>|fr}}" +
+		"{{pron|{{lien|pɔmtɛʁ|fr}}|''x''|ʁə(ɡ)ʁɛ|t͡ʃa|2|fr}} <!-- {{pron|x|fr}} -->{{ open {{API|a|lang=fr}}"
+	got := strings.Join(extractPronunciations(text, "fr"), "|")
+	if want := "ʃa|ʃɑ|ʃa|ʃaʃa|pɔm də tɛʁ|ʃa|ʁe|ʁə(ɡ)ʁɛ|t͡ʃa|a"; got != want {
+		t.Errorf("extractPronunciations = %q, want %q", got, want)
+	}
+}
@@ -3,6 +3,10 @@ module ipadict
 go 1.25
 
 require (
+	github.com/klauspost/compress v1.18.0
 	github.com/temporal-IPA/tipa v1.0.0
+	github.com/ulikunitz/xz v0.5.15
 	golang.org/x/net v0.47.0
+	golang.org/x/text v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
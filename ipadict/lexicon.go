@@ -0,0 +1,158 @@
+// File path: tipatools/ipadict/lexicon.go
+
+package main
+
+// Phone lexicon exports for forced alignment and ASR training.
+//
+// Montreal Forced Aligner and Kaldi expect one pronunciation per line, as a
+// space-separated list of phones. Pronunciations are segmented with
+// ipadict/phone, so diacritics, tie-bar affricates and length marks stay
+// part of their phone; stress marks and syllable breaks are dropped.
+//
+//	mfa         <word>\t<p1> <p2> ...          (MFA dictionary)
+//	kaldi       <word> <p1> <p2> ...           (lexicon.txt)
+//	kaldi-prob  <word> <prob> <p1> <p2> ...    (lexiconp.txt)
+//
+// Phrase entries are skipped: their spaces would be read as word
+// separators. The phone inventory of the lexicon can be written next to it
+// (phones.txt, nonsilence_phones.txt, silence_phones.txt,
+// optional_silence.txt) for Kaldi data preparation.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ipadict/phone"
+)
+
+// Silence phones written to silence_phones.txt, optional silence first.
+var silencePhones = []string{"SIL", "SPN"}
+
+// isLexiconFormat reports whether format is one of the phone lexicon
+// exports.
+func isLexiconFormat(format string) bool {
+	return format == "mfa" || format == "kaldi" || format == "kaldi-prob"
+}
+
+// pronunciationProbs returns the probability of each pronunciation of
+// word, as in Kaldi lexiconp.txt: the best pronunciation has probability 1
+// and the others are scaled by their ranking score. Without ranking scores,
+// every pronunciation has probability 1.
+func pronunciationProbs(word string, prons []string, rk *ranker) []float64 {
+	probs := make([]float64, len(prons))
+	best := 0.0
+	if rk != nil {
+		for _, pron := range prons {
+			best = max(best, rk.score(word, pron).Score)
+		}
+	}
+	for i, pron := range prons {
+		probs[i] = 1
+		if best > 0 {
+			probs[i] = rk.score(word, pron).Score / best
+		}
+	}
+	return probs
+}
+
+// writeLexicon writes entries in one of the phone lexicon formats, sorted
+// by word. It returns the number of phrase entries skipped.
+func writeLexicon(w io.Writer, entries map[string][]string, format string, rk *ranker) (int, error) {
+	words := make([]string, 0, len(entries))
+	for word := range entries {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	skipped := 0
+	bw := bufio.NewWriter(w)
+	for _, word := range words {
+		if isPhrase(word) {
+			skipped++
+			continue
+		}
+		prons := entries[word]
+		probs := pronunciationProbs(word, prons, rk)
+		seen := make(map[string]bool, len(prons))
+		for i, pron := range prons {
+			phones := strings.Join(phone.Segment(pron), " ")
+			if phones == "" || seen[phones] {
+				continue
+			}
+			seen[phones] = true
+			switch format {
+			case "mfa":
+				fmt.Fprintf(bw, "%s\t%s\n", word, phones)
+			case "kaldi":
+				fmt.Fprintf(bw, "%s %s\n", word, phones)
+			case "kaldi-prob":
+				fmt.Fprintf(bw, "%s %s %s\n", word, strconv.FormatFloat(probs[i], 'f', 4, 64), phones)
+			}
+		}
+	}
+	return skipped, bw.Flush()
+}
+
+// phoneInventory returns the phones used by entries, in lexical order.
+func phoneInventory(entries map[string][]string) []string {
+	set := make(map[string]bool)
+	for word, prons := range entries {
+		if isPhrase(word) {
+			continue
+		}
+		for _, pron := range prons {
+			for _, p := range phone.Segment(pron) {
+				set[p] = true
+			}
+		}
+	}
+	phones := make([]string, 0, len(set))
+	for p := range set {
+		phones = append(phones, p)
+	}
+	sort.Strings(phones)
+	return phones
+}
+
+// writePhoneInventory writes the Kaldi phone lists of entries into dir. It
+// returns the number of non-silence phones.
+func writePhoneInventory(dir string, entries map[string][]string) (int, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+	phones := phoneInventory(entries)
+
+	var table strings.Builder
+	table.WriteString("<eps> 0\n")
+	for i, p := range append(append([]string(nil), silencePhones...), phones...) {
+		fmt.Fprintf(&table, "%s %d\n", p, i+1)
+	}
+
+	files := map[string]string{
+		"phones.txt":            table.String(),
+		"nonsilence_phones.txt": phoneLines(phones),
+		"silence_phones.txt":    phoneLines(silencePhones),
+		"optional_silence.txt":  phoneLines(silencePhones[:1]),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			return 0, err
+		}
+	}
+	return len(phones), nil
+}
+
+// phoneLines renders phones one per line.
+func phoneLines(phones []string) string {
+	var b strings.Builder
+	for _, p := range phones {
+		b.WriteString(p + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,115 @@
+// File path: tipatools/ipadict/lexicon_test.go
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// lexiconEntries covers the cases of the lexicon exports: pronunciations
+// that only differ by suprasegmentals, a tie-bar affricate next to its
+// untied spelling, a length mark, a phrase and a pronunciation without
+// phones.
+var lexiconEntries = map[string][]string{
+	"chat":           {"ʃa", "ˈʃa", "ʃ.a"},
+	"tchèque":        {"t͡ʃɛk", "tʃɛk"},
+	"pâte":           {"pɑːt"},
+	"pomme de terre": {"pɔm də tɛʁ"},
+	"vide":           {"ˈ."},
+}
+
+func TestWriteLexicon(t *testing.T) {
+	rk := newRanker()
+	rk.attest(map[string][]string{"tchèque": {"t͡ʃɛk", "tʃɛk"}}, 0, 1)
+	rk.attest(map[string][]string{"tchèque": {"tʃɛk"}}, 1, 1)
+
+	tests := []struct {
+		format string
+		rk     *ranker
+		want   []string
+	}{
+		{"mfa", nil, []string{"chat\tʃ a", "pâte\tp ɑː t", "tchèque\tt͡ʃ ɛ k", "tchèque\tt ʃ ɛ k"}},
+		{"kaldi", nil, []string{"chat ʃ a", "pâte p ɑː t", "tchèque t͡ʃ ɛ k", "tchèque t ʃ ɛ k"}},
+		{"kaldi-prob", nil, []string{"chat 1.0000 ʃ a", "pâte 1.0000 p ɑː t", "tchèque 1.0000 t͡ʃ ɛ k", "tchèque 1.0000 t ʃ ɛ k"}},
+		{"kaldi-prob", rk, []string{"chat 1.0000 ʃ a", "pâte 1.0000 p ɑː t", "tchèque 0.5000 t͡ʃ ɛ k", "tchèque 1.0000 t ʃ ɛ k"}},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		skipped, err := writeLexicon(&b, lexiconEntries, tt.format, tt.rk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if skipped != 1 {
+			t.Errorf("%s: skipped %d phrases, want 1", tt.format, skipped)
+		}
+		if want := strings.Join(tt.want, "\n") + "\n"; b.String() != want {
+			t.Errorf("%s (ranked: %v) =\n%s\nwant\n%s", tt.format, tt.rk != nil, b.String(), want)
+		}
+	}
+}
+
+func TestPronunciationProbs(t *testing.T) {
+	rk := newRanker()
+	rk.attest(map[string][]string{"chat": {"ʃa", "tʃat"}}, 0, 3)
+	rk.attest(map[string][]string{"chat": {"ʃa"}}, 1, 1)
+
+	tests := []struct {
+		word  string
+		prons []string
+		rk    *ranker
+		want  []float64
+	}{
+		{"chat", []string{"tʃat", "ʃa"}, nil, []float64{1, 1}},
+		{"chat", []string{"tʃat", "ʃa", "ʃat"}, rk, []float64{0.75, 1, 0}},
+		// No pair of the word was scored.
+		{"chien", []string{"ʃjɛ̃", "ʃjɛn"}, rk, []float64{1, 1}},
+		{"chat", nil, rk, []float64{}},
+	}
+	for _, tt := range tests {
+		if got := pronunciationProbs(tt.word, tt.prons, tt.rk); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pronunciationProbs(%s, %q) = %v, want %v", tt.word, tt.prons, got, tt.want)
+		}
+	}
+}
+
+func TestWritePhoneInventory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data", "local", "dict")
+	n, err := writePhoneInventory(dir, lexiconEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 8 {
+		t.Errorf("%d phones, want 8", n)
+	}
+	// The phones of the phrase are left out, as in the lexicon.
+	want := map[string][]string{
+		"phones.txt": {
+			"<eps> 0", "SIL 1", "SPN 2", "a 3", "k 4", "p 5", "t 6", "t͡ʃ 7", "ɑː 8", "ɛ 9", "ʃ 10",
+		},
+		"nonsilence_phones.txt": {"a", "k", "p", "t", "t͡ʃ", "ɑː", "ɛ", "ʃ"},
+		"silence_phones.txt":    {"SIL", "SPN"},
+		"optional_silence.txt":  {"SIL"},
+	}
+	for name, lines := range want {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strings.Join(lines, "\n") + "\n"; string(data) != want {
+			t.Errorf("%s =\n%s\nwant\n%s", name, data, want)
+		}
+	}
+
+	// Without phones, nonsilence_phones.txt is empty, not a blank line.
+	dir = t.TempDir()
+	if n, err := writePhoneInventory(dir, map[string][]string{"pomme de terre": {"pɔm"}}); err != nil || n != 0 {
+		t.Fatalf("empty inventory: %d phones, %v", n, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "nonsilence_phones.txt")); err != nil || len(data) != 0 {
+		t.Errorf("nonsilence_phones.txt = %q, %v", data, err)
+	}
+}
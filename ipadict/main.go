@@ -22,12 +22,15 @@ import (
 	"io"
 	"log"
 	"os"
+	"regexp"
 	"sort"
 	"strings"
-	"time"
 
 	"github.com/temporal-IPA/tipa/pkg/phono"
-	"github.com/temporal-IPA/tipa/pkg/phono/wikipedia"
+
+	"ipadict/alphabet"
+	"ipadict/remote"
+	"ipadict/wordkey"
 )
 
 // --- CLI help / usage -------------------------------------------------------
@@ -42,19 +45,50 @@ Usage:
       Build an IPA dictionary from one or more sources (Wiktionary /
       Wikipedia XML dumps, existing dictionaries, or a mix of both).
 
+  ipadict build [--cache-dir DIR] recipe.yaml
+      Run a build described by a YAML recipe: an ordered list of
+      sources, each with its own kind (dump / dictionary), language,
+      merge mode, page filters and normalization, and a list of output
+      targets. Relative paths are resolved against the recipe directory.
+      See "Build recipes" below.
+
+  ipadict phones [--examples N] [--cache-dir DIR] DICT [DICT ...]
+      Print the phone inventory of one or more dictionaries, most
+      frequent first, one phone per line:
+          <phone>\t<count>\t<share %>\t<features>\t<example words>
+      Pronunciations are segmented into phones (diacritics, modifier
+      letters, length marks and tie-bar affricates stay part of their
+      phone; stress marks and syllable breaks are dropped). <features> is
+      the articulatory description of the phone ("voiceless postalveolar
+      affricate", "open-mid back rounded vowel, nasalized"), or "?" when
+      its base symbol is not in the IPA charts. --examples sets the number
+      of example words per phone (default: 3).
+
+  ipadict anomalies [--top N] [--order N] [--sort KEY] [--cache-dir DIR] DICT [DICT ...]
+      Rank the word/pronunciation pairs of a dictionary (one language per
+      run) by how unusual they are, to review likely transcription errors
+      first. Two models are learned from the dictionary itself:
+        - a phone n-gram model (--order, default: 3), scored
+          leave-one-out: the phonotactic cost is the average surprise in
+          bits per phone;
+        - a grapheme/phoneme aligner: the alignment cost is the average
+          cost in bits of the letter-to-phone links of the pair.
+      Output, one pair per line, most suspect first:
+          <word>\t<IPA>\t<score>\t<phonotactic>\t<alignment>\t<worst n-gram>\t<worst link>
+      <score> is the sum of the z-scores of both costs. --sort phonotactic
+      or --sort alignment ranks by one cost only. --top sets the number of
+      pairs printed (default: 100, 0 for all).
+      Example:
+          ipadict anomalies --top 500 exports/fr.dict.txt > review.tsv
+
 Sources:
 
   --parse PATH
       Add a source to the pipeline. This flag can be repeated; sources
       are processed in the order they appear on the command line.
 
-      Each PATH can be:
-        - a Wiktionary / Wikipedia XML dump:
-            *.xml
-            *.xml.bz2
-            *wiktionary*.bz2
-            *wikipedia*.bz2
-          (local file or HTTP/HTTPS URL), or
+      Each PATH (local file or HTTP/HTTPS URL) can be:
+        - a Wiktionary / Wikipedia XML dump, or
         - a pre-existing dictionary:
             - native ipadict text:
                 <word>\t<IPA1> | <IPA2> | ...
@@ -63,18 +97,68 @@ Sources:
                 <word>\t/<IPA>/
                 <word>\t/<IPA1>/ /<IPA2>/
 
+      The kind of source is detected from its content, after
+      decompression: a document with a <mediawiki> root is a dump;
+      tab-separated text lines and gob payloads are dictionaries.
+      Prefix PATH with "dump:" or "dict:" to force the kind, e.g.
+          --parse dict:https://example.org/fr_FR.txt
+          --parse dump:frwiktionary.bz2
+
+      Prefix PATH with a merge mode to use it for this source only
+      instead of the run-wide mode (see "Merge modes" below):
+          --parse replace:overrides.txt
+          --preload append:curated.dict.txt
+          --parse no-override:dump:frwiktionary.bz2
+      Accepted prefixes: append:, prepend:, no-override:, replace:.
+      Kind and merge mode prefixes can be combined in any order.
+
   --preload PATH
       Preload an existing dictionary before any --parse sources.
       The flag can be repeated; dictionaries are merged in the order
       they are given. It accepts the same dictionary formats as
       --parse, but is always treated as a dictionary (never as a dump).
 
+  --remove PATH
+      Remove entries from the dictionary built so far. PATH (local file or
+      HTTP/HTTPS URL, plain or compressed) lists one entry per line:
+          <word>                        remove the word entirely
+          <word>\t<IPA1> | <IPA2> | ...  remove only these pronunciations
+      Blank lines and lines starting with "#" are ignored. The removal is
+      applied at its position among the --parse sources: sources given
+      after it may add entries back. The flag can be repeated.
+
+  --block-regex REGEXP
+      Remove every word matching REGEXP (Go syntax) from the dictionary
+      built so far, at its position among the --parse sources, like
+      --remove. Examples: '[0-9]' drops words with digits, ' ' drops
+      multi-word entries. The flag can be repeated.
+
+      Removed words and word/pronunciation pairs are reported after each
+      step and in the final summary.
+
 Flags:
   --lang CODE
       Language code to match in {{pron|...}} / {{API|...}} templates when
       scanning Wikimedia dumps.
       Default is "fr". Examples: "fr", "en", "es", "de".
 
+  --namespace NS
+      Only keep dump pages from the given namespace(s). NS is a numeric key
+      ("0", "100") or a namespace name as declared by the dump ("main",
+      "Annexe", "Thesaurus", ...). The flag can be repeated and accepts
+      comma-separated lists. Use "all" to keep every page.
+      Default is the main namespace only, so Template:, Appendix:, user
+      and talk pages do not contribute pronunciations.
+      BREAKING: earlier versions kept every namespace; pass "--namespace
+      all" to get their output back. Dumps that keep every page, without
+      a title filter, are handed to the tipa parser as is.
+
+  --title-regex REGEXP
+      Only keep dump pages whose title matches REGEXP (Go syntax).
+
+  --exclude-title REGEXP
+      Skip dump pages whose title matches REGEXP (Go syntax).
+
   --export text
       Export a UTF-8 text dictionary to stdout (default).
       Format: one entry per line
@@ -89,11 +173,140 @@ Flags:
       Example:
           ipadict --lang fr --export gob --parse dump.xml.bz2 > fr.dict.gob
 
+  --export scored
+      Export one line per word/pronunciation pair with its ranking score
+      (implies --rank):
+          <word>\t<IPA>\t<score>\t<sources>\t<occurrences>
+      <score> is the sum of the weights of the sources that contain the pair,
+      <sources> their number and <occurrences> the number of dump pages
+      with a pronunciation template for the pair.
+
+  --export pls
+      Export a W3C Pronunciation Lexicon Specification (PLS 1.0) document
+      for TTS engines: one <lexeme> per word with its <grapheme> and one
+      <phoneme> per pronunciation (alphabet "ipa", xml:lang from --lang).
+
+  --export mfa
+  --export kaldi
+  --export kaldi-prob
+      Export a phone lexicon for Montreal Forced Aligner or Kaldi, one line
+      per pronunciation, phones separated by spaces:
+          mfa         <word>\t<p1> <p2> ...        (MFA dictionary)
+          kaldi       <word> <p1> <p2> ...         (lexicon.txt)
+          kaldi-prob  <word> <prob> <p1> <p2> ...  (lexiconp.txt)
+      Pronunciations are segmented into phones: diacritics, tie-bar
+      affricates (t͡ʃ) and length marks (aː) stay part of their phone;
+      stress marks and syllable breaks are dropped. Probabilities are 1.0,
+      or relative to the best-ranked pronunciation with --rank. Phrase
+      entries are skipped.
+      Example:
+          ipadict --lang fr --export kaldi-prob --rank \
+                  --phones-dir data/local/dict \
+                  --parse dump.xml.bz2 > data/local/dict/lexiconp.txt
+
+  --phones-dir DIR
+      With an mfa, kaldi or kaldi-prob export, also write the phone
+      inventory into DIR: phones.txt (symbol table), nonsilence_phones.txt,
+      silence_phones.txt (SIL, SPN) and optional_silence.txt (SIL).
+
+  --export-alphabet ipa|x-sampa|arpabet|kirshenbaum
+      Transliterate the exported pronunciations from IPA (default) into an
+      ASCII phone alphabet:
+        x-sampa      X-SAMPA, symbols concatenated ("ʃa" -> "Sa")
+        arpabet      CMU ARPAbet, space-separated, with stress digits on
+                     vowels ("ˈkæt" -> "K AE1 T"); English (--lang en) only
+        kirshenbaum  Kirshenbaum ASCII-IPA
+      IPA symbols without a mapping are not passed through: the
+      word/pronunciation pairs containing them are dropped and the symbols
+      are reported on stderr with their count and an example.
+
+  --rank
+      Reorder the pronunciations of each word before export so that the
+      ones attested by the most (weighted) sources come first; ties are
+      broken by the number of dump pages with the pair, then by merge
+      order. Without --rank, the order only reflects the merge modes and
+      the source order.
+
+  --source-weight PATH=WEIGHT
+      Ranking weight of the --parse / --preload source PATH (without its
+      kind or merge mode prefixes). Default: 1. Can be repeated.
+      Example:
+          ipadict --rank --source-weight curated.dict.txt=3 \
+                  --preload curated.dict.txt --parse dump.xml.bz2
+
+  --max-prons N
+      Keep at most N pronunciations per word in the export (the first N,
+      in rank order with --rank). 0 means unlimited (default).
+
+  --prune-distance N
+      Drop a pronunciation from the export when it is within N edits
+      (Levenshtein distance in code points, syllable breaks ignored) of a
+      pronunciation ranked before it. 0 disables the step (default).
+
+  --prune-length-ratio F
+      Drop a pronunciation from the export when its length is more than F
+      times longer or shorter than the median length of the word's
+      pronunciations (F > 1; only for words with three or more
+      pronunciations). The first pronunciation is always kept. 0 disables
+      the step (default).
+      Pruning steps run in this order: length outliers, near variants,
+      maximum count.
+      Example:
+          ipadict --rank --max-prons 3 --prune-distance 1 \
+                  --parse dump.xml.bz2 --parse fr_FR.txt
+
+  --key-form nfc|nfd|none
+      Unicode normalization applied to word keys once every source has
+      been merged. Default: none.
+
+  --unify-punct
+      Map typographic apostrophes (’ ‘ ʼ ′) and hyphens (‐ ‑) in word keys
+      to ASCII ' and -, so that "aujourd’hui" and "aujourd'hui" share one
+      entry.
+
+  --case preserve|fold|fold-proper
+      Case policy for word keys:
+        preserve     keep keys as they are (default)
+        fold         lower-case every key ("PARIS", "Paris" -> "paris")
+        fold-proper  lower-case keys, except title-case keys which are
+                     kept as proper nouns ("Marc" stays apart from
+                     "marc"); other capitalized keys fold onto the
+                     title-case key when it exists ("PARIS" -> "Paris")
+      Keys that become equal are merged, their pronunciations deduplicated.
+      Pass the same --key-form, --unify-punct and --case options to
+      phonetize so that lookups use the same keys.
+
+  --phrases keep|drop|only
+      Multi-word entries ("pomme de terre", "New York") are phrase entries:
+      their key contains single spaces (white space in dump titles is
+      collapsed). "keep" exports them with the other words (default),
+      "drop" removes them, "only" exports nothing else. phonetize matches
+      phrase entries before scanning word by word.
+
+  --compress FORMAT
+      Compress the export written to stdout. FORMAT is one of "gzip",
+      "zstd" or "xz". Compressed dictionaries can be passed back to
+      --preload / --parse as-is.
+      Example:
+          ipadict --lang fr --compress zstd --parse dump.xml.bz2 > fr.dict.txt.zst
+
   --preload PATH
       Preload an existing dictionary before any --parse sources.
       This flag can be used multiple times; dictionaries are preloaded
       and merged in the order they are given.
 
+  --cache-dir DIR
+      Directory where dictionaries given as HTTP/HTTPS URLs (--preload or
+      --parse) are cached. Cached copies are revalidated on each run with
+      ETag / Last-Modified conditional requests and only downloaded again
+      when they changed; if the server is unreachable, the cached copy is
+      used. Default: the "tipatools" directory under the user cache
+      directory (e.g. ~/.cache/tipatools).
+
+Merge modes:
+  The following flags select the run-wide merge mode, used by every
+  source that has no merge mode prefix. At most one may be given.
+
   --merge-append
       Merge new pronunciations into the existing dictionary by appending them
       after existing entries (default). New pronunciations for a word are added
@@ -121,13 +334,58 @@ Flags:
 Input formats for --parse:
   - Local files:
       - Plain XML dumps:  *.xml
-      - Bzip2-compressed: *.xml.bz2, *wiktionary*.bz2, *wikipedia*.bz2
-      - Text or gob dictionaries as described above.
+      - Compressed dumps: *.xml.bz2, *.xml.gz, *.xml.zst, *.xml.xz
+      - Text or gob dictionaries as described above, plain or compressed.
   - HTTP/HTTPS:
-      When <path-or-URL> starts with "http://" or "https://", the dump is read
-      directly from the HTTP response body as a stream. If the URL path ends
-      with ".bz2" (e.g. Wikimedia dump URLs), the content is transparently
-      decompressed on the fly without creating temporary files.
+      When <path-or-URL> starts with "http://" or "https://", a dump is read
+      directly from the HTTP response body as a stream; a dictionary is
+      downloaded into the --cache-dir directory and loaded like a local
+      file.
+  - Compression:
+      bzip2, gzip, zstd and xz streams are detected from their magic bytes
+      (not from the file extension) and transparently decompressed on the
+      fly, for dumps and for --preload / --parse dictionaries alike. Dumps
+      are never written to temporary files.
+
+Build recipes:
+  lang: fr                      # default language for dumps
+  rank: true                    # same as --rank
+  phrases: keep                 # same as --phrases
+  keys:                         # word-key normalization
+    form: nfc                   # same as --key-form
+    unify_punct: true           # same as --unify-punct
+    case: fold-proper           # same as --case
+  namespaces: [main]            # default dump namespaces
+  cache_dir: .cache             # optional, for remote dictionaries
+  sources:                      # processed in order
+    - path: curated.dict.txt
+      kind: dictionary          # dump | dictionary (sniffed when omitted)
+      merge: append             # append | prepend | no-override | replace
+      weight: 3                 # ranking weight (default 1)
+    - path: frwiktionary-latest-pages-articles.xml.bz2
+      kind: dump
+      merge: no-override
+      namespaces: [main, Annexe]
+      title_regex: '^[^0-9]+$'
+      exclude_title: ' '
+      normalize: nfc            # nfc | nfd | none
+    - path: bad-entries.txt
+      kind: remove              # same format as --remove
+    - kind: blocklist           # same as --block-regex
+      patterns: ['[0-9]', ' ']
+  outputs:
+    - path: exports/fr.dict.txt # "-" for stdout
+      export: text              # text | gob | scored | pls
+      alphabet: ipa             # ipa | x-sampa | arpabet | kirshenbaum
+    - path: data/local/dict/lexiconp.txt
+      export: kaldi-prob        # mfa | kaldi | kaldi-prob
+      phones_dir: data/local/dict
+    - path: exports/fr.dict.gob.zst
+      export: gob               # compression inferred from .gz/.zst/.xz
+      compress: zstd
+      max_prons: 3              # same as --max-prons
+      prune_distance: 1         # same as --prune-distance
+      prune_length_ratio: 2     # same as --prune-length-ratio
 
 Examples:
   # Basic local scan (French, text export)
@@ -166,13 +424,27 @@ Examples:
           --parse frwiktionary-20251120-pages-articles-multistream.xml.bz2 \
           > exports/fr.override_old.dict.txt
 
+  # Main namespace and the French appendix namespace, without titles
+  # containing digits
+  ipadict --lang fr --namespace main,Annexe \
+          --exclude-title '[0-9]' \
+          --parse frwiktionary-latest-pages-articles.xml.bz2 \
+          > exports/fr.dict.txt
+
+  # Per-source merge modes: curated entries first, Wiktionary only for
+  # missing words, then user overrides replacing existing entries
+  ipadict --lang fr \
+          --preload append:exports/curated.dict.txt \
+          --parse no-override:frwiktionary-latest-pages-articles.xml.bz2 \
+          --parse replace:exports/user-overrides.dict.txt \
+          > exports/fr.dict.txt
+
   # Single-pass build from a dump and an external ipa-dict text file
   ipadict --lang fr --merge-append \
           --parse frwiktionary-20251120-pages-articles-multistream.xml \
           --parse datasets/ipa-dict/fr_FR.txt \
           --export text \
-          > exports/fr.full.dict.txt
-`
+          > exports/fr.full.dict.txt`
 
 // printUsage writes the CLI help text to the given writer.
 func printUsage(w io.Writer) {
@@ -212,15 +484,124 @@ func writeGobDictionary(w io.Writer, entries map[string][]string) error {
 	return enc.Encode(entries)
 }
 
+// pairKey returns the key of the pair (word, pron) in the SeenWordPron set
+// of a phono.Representation.
+func pairKey(word, pron string) string {
+	return word + "\t" + pron
+}
+
+// mergeEntries merges an in-memory word -> pronunciations map into rep with
+// the semantics of mode: new pronunciations are appended or prepended to the
+// existing ones, existing words are left alone (no-override) or have their
+// pronunciations replaced (replace). A pronunciation is never listed twice
+// for a word. rep.SeenWordPron is kept in step with the entries, so that
+// the phono loaders merge later sources against them.
+func mergeEntries(rep *phono.Representation, mode phono.MergeMode, entries map[string][]string) {
+	for word, prons := range entries {
+		old, exists := rep.Entries[word]
+		switch mode {
+		case phono.MergeModeNoOverride:
+			if exists {
+				continue
+			}
+		case phono.MergeModeReplace:
+			old = nil
+		}
+		seen := make(map[string]bool, len(old)+len(prons))
+		for _, pron := range old {
+			seen[pron] = true
+		}
+		var added []string
+		for _, pron := range prons {
+			if !seen[pron] {
+				seen[pron] = true
+				added = append(added, pron)
+			}
+		}
+		if len(added) == 0 {
+			continue
+		}
+		if mode == phono.MergeModeReplace {
+			for _, pron := range rep.Entries[word] {
+				delete(rep.SeenWordPron, pairKey(word, pron))
+			}
+		}
+		for _, pron := range added {
+			rep.SeenWordPron[pairKey(word, pron)] = struct{}{}
+		}
+		if mode == phono.MergeModePrepend {
+			rep.Entries[word] = append(added, old...)
+		} else {
+			rep.Entries[word] = append(old[:len(old):len(old)], added...)
+		}
+	}
+}
+
+// uniqueEntries removes repeated pronunciations of a word, keeping the first
+// one. Dictionaries loaded after a merge of in-memory entries may list again
+// pronunciations the representation already has.
+func uniqueEntries(entries map[string][]string) {
+	for word, prons := range entries {
+		seen := make(map[string]bool, len(prons))
+		kept := prons[:0]
+		for _, pron := range prons {
+			if !seen[pron] {
+				seen[pron] = true
+				kept = append(kept, pron)
+			}
+		}
+		entries[word] = kept
+	}
+}
+
+// countPairs returns the number of word/pronunciation pairs of entries.
+func countPairs(entries map[string][]string) int {
+	n := 0
+	for _, prons := range entries {
+		n += len(prons)
+	}
+	return n
+}
+
 // --- CLI wiring -------------------------------------------------------------
 
 // buildConfig holds options for a full dictionary build.
 type buildConfig struct {
-	ParseSources []string        // sources passed via --parse (dumps or dictionaries)
-	PreloadPaths []string        // sources passed via --preload (always dictionaries)
-	ExportFormat string          // "text" or "gob"
-	Lang         string          // language code used in pron/API templates
-	MergeMode    phono.MergeMode // append, prepend, no-override, replace
+	ParseSources []string           // sources passed via --parse (dumps or dictionaries)
+	PreloadPaths []string           // sources passed via --preload (always dictionaries)
+	ExportFormat string             // "text", "gob", "scored", "pls", "mfa", "kaldi" or "kaldi-prob"
+	Lang         string             // language code used in pron/API templates
+	MergeMode    phono.MergeMode    // default for sources without a merge mode prefix
+	Namespaces   []string           // dump namespaces to keep (keys or names; "all" keeps every page)
+	TitleRegex   string             // dump pages are kept only when their title matches
+	ExcludeTitle string             // dump pages whose title matches are skipped
+	Compress     string             // export compression: "", "gzip", "zstd" or "xz"
+	CacheDir     string             // local cache for dictionaries loaded over HTTP/HTTPS
+	Removals     []removalStep      // --remove / --block-regex, positioned among ParseSources
+	Rank         bool               // reorder pronunciations by source agreement
+	Weights      map[string]float64 // --source-weight, keyed by source path
+	Prune        pruneOptions       // --max-prons, --prune-distance, --prune-length-ratio
+	Keys         wordkey.Policy     // --key-form, --unify-punct, --case
+	Phrases      string             // --phrases: keep, drop or only
+	Alphabet     string             // --export-alphabet
+	PhonesDir    string             // --phones-dir
+}
+
+// removalStep is a --remove or --block-regex flag. It is applied after the
+// first After --parse sources, i.e. at its position on the command line.
+type removalStep struct {
+	After   int    // number of --parse sources given before this flag
+	List    string // --remove path or URL
+	Pattern string // --block-regex pattern
+}
+
+// sourceMergeMode returns the merge mode attached to spec, or the run-wide
+// mode selected by the merge flags.
+func (cfg buildConfig) sourceMergeMode(spec sourceSpec) phono.MergeMode {
+	if spec.HasMode {
+		return spec.Mode
+	}
+	return cfg.MergeMode
 }
 
 // stringSliceFlag implements flag.Value to allow repeated flags.
@@ -240,22 +621,8 @@ func isHTTPURL(src string) bool {
 	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
 }
 
-// isXMLWikipediaDumpSource classifies pathOrURL as a Wiktionary/Wikipedia XML dump
-// when its shape strongly suggests it.
-func isXMLWikipediaDumpSource(pathOrURL string) bool {
-	if isHTTPURL(pathOrURL) {
-		return true
-	}
-	lower := strings.ToLower(pathOrURL)
-	if strings.HasSuffix(lower, ".xml") || strings.HasSuffix(lower, ".xml.bz2") {
-		return true
-	}
-	return false
-}
-
 // runBuild executes a full build according to cfg and writes the result to stdout.
 func runBuild(cfg buildConfig) error {
-	fs := os.DirFS("/")
 	if len(cfg.ParseSources) == 0 && len(cfg.PreloadPaths) == 0 {
 		return errors.New("at least one --parse or --preload source must be specified")
 	}
@@ -264,8 +631,17 @@ func runBuild(cfg buildConfig) error {
 	if export == "" {
 		export = "text"
 	}
-	if export != "text" && export != "gob" {
-		return fmt.Errorf("invalid --export value %q (must be \"text\" or \"gob\")", cfg.ExportFormat)
+	switch export {
+	case "text", "gob", "scored", "pls", "mfa", "kaldi", "kaldi-prob":
+	default:
+		return fmt.Errorf("invalid --export value %q (must be \"text\", \"gob\", \"scored\", \"pls\", \"mfa\", \"kaldi\" or \"kaldi-prob\")", cfg.ExportFormat)
+	}
+
+	if err := cfg.Keys.Validate(); err != nil {
+		return err
+	}
+	if err := validatePhrases(cfg.Phrases); err != nil {
+		return err
 	}
 
 	lang := strings.ToLower(strings.TrimSpace(cfg.Lang))
@@ -273,68 +649,106 @@ func runBuild(cfg buildConfig) error {
 		lang = "fr"
 	}
 
-	rep := phono.NewRepresentation()
+	filter := pageFilter{Namespaces: cfg.Namespaces}
+	if cfg.TitleRegex != "" {
+		re, err := regexp.Compile(cfg.TitleRegex)
+		if err != nil {
+			return fmt.Errorf("invalid --title-regex: %w", err)
+		}
+		filter.TitleRegex = re
+	}
+	if cfg.ExcludeTitle != "" {
+		re, err := regexp.Compile(cfg.ExcludeTitle)
+		if err != nil {
+			return fmt.Errorf("invalid --exclude-title: %w", err)
+		}
+		filter.ExcludeTitle = re
+	}
+
+	p := &pipeline{
+		CacheDir: cfg.CacheDir,
+		Rank:     cfg.Rank,
+		Keys:     cfg.Keys,
+		Phrases:  cfg.Phrases,
+	}
+	out := buildOutput{
+		ExportFormat: export,
+		Compress:     cfg.Compress,
+		Prune:        cfg.Prune,
+		Lang:         lang,
+		Alphabet:     alphabet.Canonical(cfg.Alphabet),
+		PhonesDir:    cfg.PhonesDir,
+	}
+	if err := out.validate(); err != nil {
+		return err
+	}
+	p.Outputs = []buildOutput{out}
 
 	// Step 1: preload dictionaries (always treated as dictionaries).
-	if len(cfg.PreloadPaths) > 0 {
-		if err := phono.LoadInto(fs, rep, cfg.MergeMode, cfg.PreloadPaths...); err != nil {
-			return fmt.Errorf("preload %q: %w", strings.Join(cfg.PreloadPaths, ", "), err)
+	for _, src := range cfg.PreloadPaths {
+		spec, err := parseSourceSpec(src)
+		if err != nil {
+			return fmt.Errorf("preload: %w", err)
+		}
+		if spec.Kind == sourceDump {
+			return fmt.Errorf("preload %q: --preload only accepts dictionaries", spec.Path)
 		}
+		p.Sources = append(p.Sources, buildSource{
+			Path:      spec.Path,
+			Kind:      sourceDictionary,
+			MergeMode: cfg.sourceMergeMode(spec),
+			Weight:    cfg.Weights[spec.Path],
+		})
 	}
 
-	// Step 2: process --parse sources in order.
-	var totalLines int
-	var totalElapsed time.Duration
-
-	for _, src := range cfg.ParseSources {
-		src = strings.TrimSpace(src)
-		if src == "" {
+	// Step 2: process --parse sources in order, with removal steps at their
+	// position on the command line.
+	for i, src := range cfg.ParseSources {
+		if err := cfg.appendRemovals(p, i); err != nil {
+			return err
+		}
+		if strings.TrimSpace(src) == "" {
 			continue
 		}
+		spec, err := parseSourceSpec(src)
+		if err != nil {
+			return fmt.Errorf("parse: %w", err)
+		}
+		p.Sources = append(p.Sources, buildSource{
+			Path:      spec.Path,
+			Kind:      spec.Kind,
+			Lang:      lang,
+			MergeMode: cfg.sourceMergeMode(spec),
+			Filter:    filter,
+			Weight:    cfg.Weights[spec.Path],
+		})
+	}
 
-		if isXMLWikipediaDumpSource(src) {
-			parser := wikipedia.NewXMLDump(lang, cfg.MergeMode)
-			parser.Progress = func(lines, words, uniquePairs int) {
-				fmt.Fprintf(os.Stderr,
-					"\rScanning %s... lines: %d (words: %d, unique word/pron pairs: %d)",
-					src, lines, len(rep.Entries), len(rep.SeenWordPron))
-			}
-
-			stats, err := parser.ParseSource(src, rep)
-			if err != nil {
-				return fmt.Errorf("scan %q: %w", src, err)
-			}
+	if err := cfg.appendRemovals(p, len(cfg.ParseSources)); err != nil {
+		return err
+	}
 
-			totalLines += stats.Lines
-			totalElapsed += stats.Elapsed
+	// Step 3: run the sources in order and export the dictionary.
+	return p.run()
+}
 
-			fmt.Fprintf(os.Stderr,
-				"\rFinished %s. Scanned lines: %d (words: %d, unique word/pron pairs: %d, elapsed: %.3f seconds)\n",
-				src, stats.Lines, len(rep.Entries), len(rep.SeenWordPron), stats.Elapsed.Seconds())
-		} else {
-			// Treat as dictionary source, using phonodict preloaders.
-			if err := phono.LoadInto(fs, rep, cfg.MergeMode, src); err != nil {
-				return fmt.Errorf("preload %q: %w", src, err)
-			}
+// appendRemovals adds the removal steps given after exactly `after` --parse
+// sources to p.
+func (cfg buildConfig) appendRemovals(p *pipeline, after int) error {
+	for _, r := range cfg.Removals {
+		if r.After != after {
+			continue
 		}
-	}
-
-	// Step 3: export dictionary.
-	switch export {
-	case "text":
-		if err := writeTextDictionary(os.Stdout, rep.Entries); err != nil {
-			return fmt.Errorf("write text: %w", err)
+		if r.List != "" {
+			p.Sources = append(p.Sources, buildSource{Path: r.List, Kind: sourceRemove})
+			continue
 		}
-	case "gob":
-		if err := writeGobDictionary(os.Stdout, rep.Entries); err != nil {
-			return fmt.Errorf("write gob: %w", err)
+		b, err := compileBlocklist([]string{r.Pattern})
+		if err != nil {
+			return fmt.Errorf("--block-regex: %w", err)
 		}
+		p.Sources = append(p.Sources, buildSource{Kind: sourceBlocklist, Blocklist: b})
 	}
-
-	fmt.Fprintf(os.Stderr,
-		"Finished. Scanned lines: %d (words: %d, unique word/pron pairs: %d, total elapsed: %.3f seconds)\n",
-		totalLines, len(rep.Entries), len(rep.SeenWordPron), totalElapsed.Seconds())
-
 	return nil
 }
 
@@ -342,16 +756,56 @@ func runBuild(cfg buildConfig) error {
 func runFromArgs(args []string) error {
 	fs := flag.NewFlagSet("ipadict", flag.ContinueOnError)
 
-	exportFormat := fs.String("export", "text", "export format: text or gob")
+	exportFormat := fs.String("export", "text", "export format: text, gob, scored, pls, mfa, kaldi or kaldi-prob")
+	phonesDir := fs.String("phones-dir", "", "write the phone inventory of an mfa/kaldi export (phones.txt, nonsilence_phones.txt, ...) into this directory")
+	compress := fs.String("compress", "", "compress the export: gzip, zstd or xz")
+	cacheDir := fs.String("cache-dir", remote.DefaultCacheDir(), "cache directory for dictionaries loaded over HTTP/HTTPS")
 
 	var parseSources stringSliceFlag
 	fs.Var(&parseSources, "parse", "source to parse (dump or dictionary). Can be repeated; order matters.")
 
+	var removals []removalStep
+	fs.Func("remove", "removal list (words or word/pronunciation pairs) applied at this point of the --parse order. Can be repeated.", func(v string) error {
+		removals = append(removals, removalStep{After: len(parseSources), List: strings.TrimSpace(v)})
+		return nil
+	})
+	fs.Func("block-regex", "remove every word matching this regular expression at this point of the --parse order. Can be repeated.", func(v string) error {
+		removals = append(removals, removalStep{After: len(parseSources), Pattern: v})
+		return nil
+	})
+
 	var preloadPaths stringSliceFlag
 	fs.Var(&preloadPaths, "preload", "dictionary to preload before any --parse sources (text, gob, ipa_dict_txt). Can be repeated.")
 
+	rank := fs.Bool("rank", false, "reorder the pronunciations of each word by source agreement and dump frequency")
+	weights := make(map[string]float64)
+	fs.Func("source-weight", "ranking weight of a source, as PATH=WEIGHT (default 1). Can be repeated.", func(v string) error {
+		path, w, err := parseSourceWeight(v)
+		if err != nil {
+			return err
+		}
+		weights[path] = w
+		return nil
+	})
+
+	maxProns := fs.Int("max-prons", 0, "keep at most N pronunciations per word on export (0 = unlimited)")
+	pruneDistance := fs.Int("prune-distance", 0, "drop pronunciations within this edit distance of a higher-ranked one on export (0 = off)")
+	pruneLengthRatio := fs.Float64("prune-length-ratio", 0, "drop pronunciations more than this many times longer or shorter than the word's median (0 = off)")
+
+	keyForm := fs.String("key-form", "", "Unicode normalization of word keys: nfc, nfd or none")
+	unifyPunct := fs.Bool("unify-punct", false, "map typographic apostrophes and hyphens in word keys to ASCII")
+	casePolicy := fs.String("case", "preserve", "case policy for word keys: preserve, fold or fold-proper")
+
+	phrases := fs.String("phrases", "keep", "multi-word entries: keep, drop or only")
+	exportAlphabet := fs.String("export-alphabet", "ipa", "alphabet of the exported pronunciations: ipa, x-sampa, arpabet or kirshenbaum")
+
 	lang := fs.String("lang", "fr", "language code to match in pron/API templates (e.g. fr, en, es, de)")
 
+	var namespaces stringSliceFlag
+	fs.Var(&namespaces, "namespace", "dump namespace to keep (key or name, comma-separated; \"all\" keeps every page). Can be repeated. Default: main namespace only (breaking: earlier versions kept every page).")
+	titleRegex := fs.String("title-regex", "", "only keep dump pages whose title matches this regular expression")
+	excludeTitle := fs.String("exclude-title", "", "skip dump pages whose title matches this regular expression")
+
 	mergeFlag := fs.Bool("merge", false, "alias for --merge-append (merge new pronunciations by appending them)")
 	mergeAppendFlag := fs.Bool("merge-append", false, "merge new pronunciations into existing entries by appending them (default)")
 	mergePrependFlag := fs.Bool("merge-prepend", false, "merge new pronunciations by prepending them before existing entries")
@@ -397,12 +851,48 @@ func runFromArgs(args []string) error {
 		return errors.New("only one of --merge/--merge-append, --merge-prepend, --no-override/--no-overide, or --replace may be specified")
 	}
 
+	var nsList []string
+	for _, v := range namespaces {
+		for _, ns := range strings.Split(v, ",") {
+			if ns = strings.TrimSpace(ns); ns != "" {
+				nsList = append(nsList, ns)
+			}
+		}
+	}
+	if len(nsList) == 0 {
+		nsList = []string{"0"}
+	}
+
 	cfg := buildConfig{
 		ParseSources: parseSources,
 		PreloadPaths: preloadPaths,
 		ExportFormat: strings.TrimSpace(*exportFormat),
 		Lang:         strings.TrimSpace(*lang),
 		MergeMode:    mode,
+		Namespaces:   nsList,
+		TitleRegex:   strings.TrimSpace(*titleRegex),
+		ExcludeTitle: strings.TrimSpace(*excludeTitle),
+		Compress:     strings.ToLower(strings.TrimSpace(*compress)),
+		CacheDir:     strings.TrimSpace(*cacheDir),
+		Removals:     removals,
+		Rank:         *rank,
+		Weights:      weights,
+		Prune: pruneOptions{
+			MaxProns:    *maxProns,
+			Distance:    *pruneDistance,
+			LengthRatio: *pruneLengthRatio,
+		},
+		Keys: wordkey.Policy{
+			Form:  strings.ToLower(strings.TrimSpace(*keyForm)),
+			Unify: *unifyPunct,
+			Case:  strings.ToLower(strings.TrimSpace(*casePolicy)),
+		},
+		Phrases:   strings.ToLower(strings.TrimSpace(*phrases)),
+		Alphabet:  *exportAlphabet,
+		PhonesDir: strings.TrimSpace(*phonesDir),
+	}
+	if cfg.Keys.Form == "none" {
+		cfg.Keys.Form = ""
 	}
 
 	return runBuild(cfg)
@@ -414,6 +904,21 @@ func main() {
 		case "help", "-h", "--help":
 			printUsage(os.Stdout)
 			return
+		case "build":
+			if err := runRecipe(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "phones":
+			if err := runPhones(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "anomalies":
+			if err := runAnomalies(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
 		}
 	}
 
@@ -0,0 +1,41 @@
+// File path: tipatools/ipadict/main_test.go
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+func TestMergeEntries(t *testing.T) {
+	tests := []struct {
+		mode phono.MergeMode
+		want map[string][]string
+	}{
+		{phono.MergeModeAppend, map[string][]string{"a": {"1", "2", "3"}, "b": {"4"}}},
+		{phono.MergeModePrepend, map[string][]string{"a": {"3", "1", "2"}, "b": {"4"}}},
+		{phono.MergeModeNoOverride, map[string][]string{"a": {"1", "2"}, "b": {"4"}}},
+		{phono.MergeModeReplace, map[string][]string{"a": {"2", "3"}, "b": {"4"}}},
+	}
+	for _, tt := range tests {
+		rep := phono.NewRepresentation()
+		rep.Entries["a"] = []string{"1", "2"}
+		mergeEntries(rep, tt.mode, map[string][]string{"a": {"2", "3", "3"}, "b": {"4"}})
+		if !reflect.DeepEqual(map[string][]string(rep.Entries), tt.want) {
+			t.Errorf("mode %v: entries = %v, want %v", tt.mode, rep.Entries, tt.want)
+		}
+	}
+}
+
+func TestUniqueEntries(t *testing.T) {
+	entries := map[string][]string{"a": {"1", "2", "1", "3", "2"}}
+	uniqueEntries(entries)
+	if want := []string{"1", "2", "3"}; !reflect.DeepEqual(entries["a"], want) {
+		t.Errorf("entries = %v, want %v", entries["a"], want)
+	}
+	if n := countPairs(entries); n != 3 {
+		t.Errorf("countPairs = %d, want 3", n)
+	}
+}
@@ -0,0 +1,254 @@
+// File path: tipatools/ipadict/phone/features.go
+
+package phone
+
+// Articulatory features of IPA phones.
+//
+// Features come from the pulmonic, non-pulmonic and vowel charts of the
+// IPA, keyed by base symbol, and are refined by the diacritics and modifier
+// letters of the phone. Tie bars join two bases into an affricate (t͡ʃ), a
+// doubly articulated consonant (k͡p) or a diphthong (a͡ɪ).
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Features describes a phone.
+type Features struct {
+	Vowel     bool
+	Voiced    bool
+	Place     string   // consonants: bilabial, alveolar, velar, ...
+	Manner    string   // consonants: plosive, fricative, affricate, ...
+	Height    string   // vowels: close, close-mid, open, ...
+	Backness  string   // vowels: front, central, back
+	Rounded   bool     // vowels
+	Modifiers []string // from diacritics: nasalized, long, aspirated, ...
+}
+
+// String describes the features in the usual chart order, e.g.
+// "voiceless postalveolar affricate" or "open back unrounded vowel,
+// nasalized".
+func (f Features) String() string {
+	var parts []string
+	if f.Vowel {
+		rounding := "unrounded"
+		if f.Rounded {
+			rounding = "rounded"
+		}
+		parts = []string{f.Height, f.Backness, rounding, "vowel"}
+	} else {
+		voicing := "voiceless"
+		if f.Voiced {
+			voicing = "voiced"
+		}
+		parts = []string{voicing, f.Place, f.Manner}
+	}
+	s := strings.Join(parts, " ")
+	if len(f.Modifiers) > 0 {
+		s += ", " + strings.Join(f.Modifiers, ", ")
+	}
+	return s
+}
+
+// consonant is a row of the consonant tables.
+type consonant struct {
+	Place, Manner string
+	Voiced        bool
+}
+
+// vowel is a row of the vowel table.
+type vowel struct {
+	Height, Backness string
+	Rounded          bool
+}
+
+var consonants = map[string]consonant{
+	// Plosives
+	"p": {"bilabial", "plosive", false}, "b": {"bilabial", "plosive", true},
+	"t": {"alveolar", "plosive", false}, "d": {"alveolar", "plosive", true},
+	"ʈ": {"retroflex", "plosive", false}, "ɖ": {"retroflex", "plosive", true},
+	"c": {"palatal", "plosive", false}, "ɟ": {"palatal", "plosive", true},
+	"k": {"velar", "plosive", false}, "g": {"velar", "plosive", true}, "ɡ": {"velar", "plosive", true},
+	"q": {"uvular", "plosive", false}, "ɢ": {"uvular", "plosive", true},
+	"ʡ": {"epiglottal", "plosive", false}, "ʔ": {"glottal", "plosive", false},
+	// Nasals
+	"m": {"bilabial", "nasal", true}, "ɱ": {"labiodental", "nasal", true},
+	"n": {"alveolar", "nasal", true}, "ɳ": {"retroflex", "nasal", true},
+	"ɲ": {"palatal", "nasal", true}, "ŋ": {"velar", "nasal", true},
+	"ɴ": {"uvular", "nasal", true},
+	// Trills, taps and flaps
+	"ʙ": {"bilabial", "trill", true}, "r": {"alveolar", "trill", true},
+	"ʀ": {"uvular", "trill", true}, "ⱱ": {"labiodental", "tap", true},
+	"ɾ": {"alveolar", "tap", true}, "ɽ": {"retroflex", "tap", true},
+	"ɺ": {"alveolar", "lateral tap", true},
+	// Fricatives
+	"ɸ": {"bilabial", "fricative", false}, "β": {"bilabial", "fricative", true},
+	"f": {"labiodental", "fricative", false}, "v": {"labiodental", "fricative", true},
+	"θ": {"dental", "fricative", false}, "ð": {"dental", "fricative", true},
+	"s": {"alveolar", "fricative", false}, "z": {"alveolar", "fricative", true},
+	"ʃ": {"postalveolar", "fricative", false}, "ʒ": {"postalveolar", "fricative", true},
+	"ʂ": {"retroflex", "fricative", false}, "ʐ": {"retroflex", "fricative", true},
+	"ɕ": {"alveolo-palatal", "fricative", false}, "ʑ": {"alveolo-palatal", "fricative", true},
+	"ç": {"palatal", "fricative", false}, "ʝ": {"palatal", "fricative", true},
+	"x": {"velar", "fricative", false}, "ɣ": {"velar", "fricative", true},
+	"χ": {"uvular", "fricative", false}, "ʁ": {"uvular", "fricative", true},
+	"ħ": {"pharyngeal", "fricative", false}, "ʕ": {"pharyngeal", "fricative", true},
+	"ʜ": {"epiglottal", "fricative", false}, "ʢ": {"epiglottal", "fricative", true},
+	"h": {"glottal", "fricative", false}, "ɦ": {"glottal", "fricative", true},
+	"ʍ": {"labial-velar", "fricative", false}, "ɧ": {"postalveolar-velar", "fricative", false},
+	"ɬ": {"alveolar", "lateral fricative", false}, "ɮ": {"alveolar", "lateral fricative", true},
+	// Approximants
+	"ʋ": {"labiodental", "approximant", true}, "ɹ": {"alveolar", "approximant", true},
+	"ɻ": {"retroflex", "approximant", true}, "j": {"palatal", "approximant", true},
+	"ɰ": {"velar", "approximant", true}, "w": {"labial-velar", "approximant", true},
+	"ɥ": {"labial-palatal", "approximant", true},
+	"l": {"alveolar", "lateral approximant", true}, "ɭ": {"retroflex", "lateral approximant", true},
+	"ʎ": {"palatal", "lateral approximant", true}, "ʟ": {"velar", "lateral approximant", true},
+	"ɫ": {"alveolar", "lateral approximant", true},
+	// Non-pulmonic
+	"ʘ": {"bilabial", "click", false}, "ǀ": {"dental", "click", false},
+	"ǃ": {"alveolar", "click", false}, "ǂ": {"palatal", "click", false},
+	"ǁ": {"alveolar", "lateral click", false},
+	"ɓ": {"bilabial", "implosive", true}, "ɗ": {"alveolar", "implosive", true},
+	"ʄ": {"palatal", "implosive", true}, "ɠ": {"velar", "implosive", true},
+	"ʛ": {"uvular", "implosive", true},
+}
+
+var vowels = map[string]vowel{
+	"i": {"close", "front", false}, "y": {"close", "front", true},
+	"ɨ": {"close", "central", false}, "ʉ": {"close", "central", true},
+	"ɯ": {"close", "back", false}, "u": {"close", "back", true},
+	"ɪ": {"near-close", "front", false}, "ʏ": {"near-close", "front", true},
+	"ʊ": {"near-close", "back", true},
+	"e": {"close-mid", "front", false}, "ø": {"close-mid", "front", true},
+	"ɘ": {"close-mid", "central", false}, "ɵ": {"close-mid", "central", true},
+	"ɤ": {"close-mid", "back", false}, "o": {"close-mid", "back", true},
+	"ə": {"mid", "central", false},
+	"ɛ": {"open-mid", "front", false}, "œ": {"open-mid", "front", true},
+	"ɜ": {"open-mid", "central", false}, "ɞ": {"open-mid", "central", true},
+	"ʌ": {"open-mid", "back", false}, "ɔ": {"open-mid", "back", true},
+	"æ": {"near-open", "front", false}, "ɐ": {"near-open", "central", false},
+	"a": {"open", "front", false}, "ɶ": {"open", "front", true},
+	"ɑ": {"open", "back", false}, "ɒ": {"open", "back", true},
+	"ɚ": {"mid", "central", false}, "ɝ": {"open-mid", "central", false},
+}
+
+// Secondary features of diacritics and modifier letters.
+var diacritics = map[rune]string{
+	'\u0303': "nasalized",
+	'ː':      "long",
+	'ˑ':      "half-long",
+	'\u0306': "extra-short",
+	'ʰ':      "aspirated",
+	'ʱ':      "breathy-voiced",
+	'\u0324': "breathy-voiced",
+	'\u0330': "creaky-voiced",
+	'ʷ':      "labialized",
+	'ʲ':      "palatalized",
+	'ˠ':      "velarized",
+	'\u0334': "velarized",
+	'ˤ':      "pharyngealized",
+	'ʼ':      "ejective",
+	'\u0325': "devoiced",
+	'\u030A': "devoiced",
+	'\u032C': "voiced",
+	'\u0329': "syllabic",
+	'\u030D': "syllabic",
+	'\u032F': "non-syllabic",
+	'˞':      "rhotacized",
+	'\u032A': "dental",
+	'\u033A': "apical",
+	'\u033B': "laminal",
+	'\u031A': "unreleased",
+	'ⁿ':      "nasal release",
+	'ˡ':      "lateral release",
+	'\u0339': "more rounded",
+	'\u031C': "less rounded",
+	'\u031F': "advanced",
+	'\u0320': "retracted",
+	'\u0308': "centralized",
+	'\u033D': "mid-centralized",
+	'\u031D': "raised",
+	'\u031E': "lowered",
+	'\u0318': "advanced tongue root",
+	'\u0319': "retracted tongue root",
+}
+
+// Lookup returns the articulatory features of a single phone, as returned
+// by Segment. It reports false when p is not exactly one phone or when its
+// base symbols are not in the IPA charts (stray Latin letters, digits, ...).
+func Lookup(p string) (Features, bool) {
+	units := Units(p)
+	if len(units) != 1 || units[0].Kind != Segmental {
+		return Features{}, false
+	}
+	f, ok := baseFeatures(units[0].Base)
+	if !ok {
+		return Features{}, false
+	}
+	seen := make(map[string]bool)
+	for _, r := range norm.NFD.String(units[0].Text) {
+		name, ok := diacritics[r]
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		switch name {
+		case "devoiced":
+			f.Voiced = false
+		case "voiced", "breathy-voiced", "creaky-voiced":
+			f.Voiced = true
+		}
+		f.Modifiers = append(f.Modifiers, name)
+	}
+	return f, true
+}
+
+// baseFeatures returns the features of the base symbols of a phone: a
+// single symbol, or two symbols joined by a tie bar.
+func baseFeatures(base string) (Features, bool) {
+	parts := strings.FieldsFunc(base, isTie)
+	switch len(parts) {
+	case 1:
+		return symbolFeatures(parts[0])
+	case 2:
+		first, ok1 := symbolFeatures(parts[0])
+		second, ok2 := symbolFeatures(parts[1])
+		if !ok1 || !ok2 {
+			return Features{}, false
+		}
+		switch {
+		case first.Vowel && second.Vowel:
+			first.Modifiers = append(first.Modifiers, "diphthong")
+			return first, true
+		case first.Vowel || second.Vowel:
+			return Features{}, false
+		case first.Manner == "plosive" && strings.Contains(second.Manner, "fricative"):
+			manner := "affricate"
+			if strings.HasPrefix(second.Manner, "lateral") {
+				manner = "lateral affricate"
+			}
+			return Features{Voiced: first.Voiced, Place: second.Place, Manner: manner}, true
+		case first.Manner == second.Manner:
+			place := first.Place + "-" + second.Place
+			if place == "velar-bilabial" || place == "bilabial-velar" {
+				place = "labial-velar"
+			}
+			return Features{Voiced: first.Voiced, Place: place, Manner: first.Manner}, true
+		}
+	}
+	return Features{}, false
+}
+
+// symbolFeatures looks a base symbol up in the consonant and vowel tables.
+func symbolFeatures(s string) (Features, bool) {
+	if c, ok := consonants[s]; ok {
+		return Features{Voiced: c.Voiced, Place: c.Place, Manner: c.Manner}, true
+	}
+	if v, ok := vowels[s]; ok {
+		return Features{Vowel: true, Voiced: true, Height: v.Height, Backness: v.Backness, Rounded: v.Rounded}, true
+	}
+	return Features{}, false
+}
@@ -0,0 +1,47 @@
+// File path: tipatools/ipadict/phone/features_test.go
+
+package phone
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  Features
+		desc  string
+	}{
+		{"ʃ", Features{Place: "postalveolar", Manner: "fricative"}, "voiceless postalveolar fricative"},
+		{"b", Features{Voiced: true, Place: "bilabial", Manner: "plosive"}, "voiced bilabial plosive"},
+		{"t͡ʃ", Features{Place: "postalveolar", Manner: "affricate"}, "voiceless postalveolar affricate"},
+		{"t͡ɬ", Features{Place: "alveolar", Manner: "lateral affricate"}, "voiceless alveolar lateral affricate"},
+		{"k͡p", Features{Place: "labial-velar", Manner: "plosive"}, "voiceless labial-velar plosive"},
+		{"pʰ", Features{Place: "bilabial", Manner: "plosive", Modifiers: []string{"aspirated"}}, "voiceless bilabial plosive, aspirated"},
+		{"n̥", Features{Place: "alveolar", Manner: "nasal", Modifiers: []string{"devoiced"}}, "voiceless alveolar nasal, devoiced"},
+		{"ɑ̃", Features{Vowel: true, Voiced: true, Height: "open", Backness: "back", Modifiers: []string{"nasalized"}}, "open back unrounded vowel, nasalized"},
+		{"yː", Features{Vowel: true, Voiced: true, Height: "close", Backness: "front", Rounded: true, Modifiers: []string{"long"}}, "close front rounded vowel, long"},
+		{"a͡ɪ", Features{Vowel: true, Voiced: true, Height: "open", Backness: "front", Modifiers: []string{"diphthong"}}, "open front unrounded vowel, diphthong"},
+	}
+	for _, tt := range tests {
+		got, ok := Lookup(tt.phone)
+		if !ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lookup(%q) = %+v, %v; want %+v", tt.phone, got, ok, tt.want)
+			continue
+		}
+		if s := got.String(); s != tt.desc {
+			t.Errorf("Lookup(%q).String() = %q, want %q", tt.phone, s, tt.desc)
+		}
+	}
+}
+
+func TestLookupRejects(t *testing.T) {
+	// Several phones, suprasegmentals, symbols outside the charts and
+	// impossible tie combinations.
+	for _, p := range []string{"", "ʃa", "ˈ", "˥", "W", "3", "t͡a", "a͡ʃ"} {
+		if f, ok := Lookup(p); ok {
+			t.Errorf("Lookup(%q) = %+v, want no features", p, f)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// File path: tipatools/ipadict/phone/phone.go
+
+// Package phone splits IPA transcriptions into phones and describes them
+// with articulatory features.
+//
+// A phone is a base symbol together with everything that modifies it:
+//
+//   - combining diacritics (nasalization, devoicing, syllabicity, ...),
+//   - spacing modifier letters (aspiration ʰ, labialization ʷ,
+//     palatalization ʲ, rhoticity ˞, ejective ʼ, ...),
+//   - length marks (ː, ˑ),
+//   - a second base joined by a tie bar (t͡ʃ, d͡ʒ, k͡p).
+//
+// Stress marks, syllable breaks, linking marks, intonation bars and tone
+// letters are suprasegmentals: they are not part of any phone. Units keeps
+// them as units of their own; Segment drops them. Phones are returned in
+// Unicode NFC, so that "ã" written with a combining tilde and the
+// precomposed "ã" are the same phone.
+package phone
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Kind classifies the units of a transcription.
+type Kind int
+
+const (
+	Segmental Kind = iota // a phone
+	Stress                // primary ˈ or secondary ˌ stress
+	Boundary              // syllable break, linking mark, intonation bar
+	Tone                  // tone letters and tone numbers
+)
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	switch k {
+	case Segmental:
+		return "segmental"
+	case Stress:
+		return "stress"
+	case Boundary:
+		return "boundary"
+	case Tone:
+		return "tone"
+	}
+	return "unknown"
+}
+
+// Unit is one phone or suprasegmental of a transcription.
+type Unit struct {
+	Text string // the unit as written, in NFC
+	Base string // the base symbols of a phone, without diacritics (t͡ʃ for t͡ʃʰ)
+	Kind Kind
+}
+
+// Modifier letters that attach to the preceding phone.
+const modifiers = "ʰʱʷʲˠˤⁿˡʼ˞ːˑ̚ᵊᶿˣ"
+
+// Suprasegmental symbols that are not part of a phone.
+const (
+	stressMarks   = "ˈˌ"
+	boundaryMarks = ".‿|‖"
+	toneMarks     = "˥˦˧˨˩꜒꜓꜔꜕꜖¹²³⁴⁵↗↘"
+)
+
+// Combining marks that are part of a base symbol: the cedilla of ç.
+const baseMarks = "\u0327"
+
+// Transcription delimiters and optionality brackets, dropped.
+const delimiters = "/[]()"
+
+// isTie reports whether r is a tie bar joining two bases.
+func isTie(r rune) bool {
+	return r == '͡' || r == '͜'
+}
+
+// isModifier reports whether r belongs to the preceding phone.
+func isModifier(r rune) bool {
+	return (unicode.Is(unicode.Mn, r) && !isTie(r)) || strings.ContainsRune(modifiers, r)
+}
+
+// suprasegmental returns the kind of a suprasegmental symbol.
+func suprasegmental(r rune) (Kind, bool) {
+	switch {
+	case strings.ContainsRune(stressMarks, r):
+		return Stress, true
+	case strings.ContainsRune(boundaryMarks, r):
+		return Boundary, true
+	case strings.ContainsRune(toneMarks, r):
+		return Tone, true
+	}
+	return Segmental, false
+}
+
+// Units splits an IPA transcription into phones and suprasegmentals.
+// Consecutive tone letters form a single tone unit (˥˩).
+func Units(ipa string) []Unit {
+	var units []Unit
+	var cur, base []rune
+	tied := false
+	flush := func() {
+		if len(cur) > 0 {
+			units = append(units, Unit{
+				Text: norm.NFC.String(string(cur)),
+				Base: norm.NFC.String(string(base)),
+				Kind: Segmental,
+			})
+			cur, base = cur[:0], base[:0]
+		}
+		tied = false
+	}
+	for _, r := range norm.NFD.String(ipa) {
+		if kind, ok := suprasegmental(r); ok {
+			flush()
+			if n := len(units); kind == Tone && n > 0 && units[n-1].Kind == Tone {
+				units[n-1].Text += string(r)
+				continue
+			}
+			units = append(units, Unit{Text: string(r), Kind: kind})
+			continue
+		}
+		switch {
+		case unicode.IsSpace(r) || strings.ContainsRune(delimiters, r):
+			flush()
+		case isTie(r):
+			if len(cur) > 0 {
+				cur = append(cur, r)
+				base = append(base, r)
+				tied = true
+			}
+		case isModifier(r):
+			if len(cur) > 0 {
+				cur = append(cur, r)
+				if strings.ContainsRune(baseMarks, r) {
+					base = append(base, r)
+				}
+			}
+		default:
+			if !tied {
+				flush()
+			}
+			cur = append(cur, r)
+			base = append(base, r)
+			tied = false
+		}
+	}
+	flush()
+	return units
+}
+
+// Segment splits an IPA transcription into phones, dropping
+// suprasegmentals.
+func Segment(ipa string) []string {
+	var phones []string
+	for _, u := range Units(ipa) {
+		if u.Kind == Segmental {
+			phones = append(phones, u.Text)
+		}
+	}
+	return phones
+}
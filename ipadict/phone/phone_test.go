@@ -0,0 +1,60 @@
+// File path: tipatools/ipadict/phone/phone_test.go
+
+package phone
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSegment(t *testing.T) {
+	tests := []struct {
+		ipa  string
+		want []string
+	}{
+		{"ʃa", []string{"ʃ", "a"}},
+		{"/bɔ̃.ʒuʁ/", []string{"b", "ɔ̃", "ʒ", "u", "ʁ"}},
+		{"po\u0303", []string{"p", "\u00f5"}}, // phones are returned in NFC
+		{"p\u00f5", []string{"p", "\u00f5"}},
+		{"ˈt͡ʃiːz", []string{"t͡ʃ", "iː", "z"}},
+		{"tʃ", []string{"t", "ʃ"}},
+		{"pʰɪn", []string{"pʰ", "ɪ", "n"}},
+		{"kʷʼa", []string{"kʷʼ", "a"}},
+		{"fa͡ɪn", []string{"f", "a͡ɪ", "n"}},
+		{"ma˥˩", []string{"m", "a"}},
+		{"pɑ̃ (t)", []string{"p", "ɑ̃", "t"}},
+		{"ça", []string{"ç", "a"}},
+		{"ʰa", []string{"a"}}, // a stray modifier has no phone to attach to
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := Segment(tt.ipa); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Segment(%q) = %q, want %q", tt.ipa, got, tt.want)
+		}
+	}
+}
+
+func TestUnits(t *testing.T) {
+	got := Units("ˈma˥˩.t͡ʃʰa‿")
+	want := []Unit{
+		{Text: "ˈ", Kind: Stress},
+		{Text: "m", Base: "m", Kind: Segmental},
+		{Text: "a", Base: "a", Kind: Segmental},
+		{Text: "˥˩", Kind: Tone},
+		{Text: ".", Kind: Boundary},
+		{Text: "t͡ʃʰ", Base: "t͡ʃ", Kind: Segmental},
+		{Text: "a", Base: "a", Kind: Segmental},
+		{Text: "‿", Kind: Boundary},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Units = %+v, want %+v", got, want)
+	}
+}
+
+func TestKindString(t *testing.T) {
+	for kind, want := range map[Kind]string{Segmental: "segmental", Stress: "stress", Boundary: "boundary", Tone: "tone", Kind(9): "unknown"} {
+		if got := kind.String(); got != want {
+			t.Errorf("Kind(%d).String() = %q, want %q", kind, got, want)
+		}
+	}
+}
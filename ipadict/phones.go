@@ -0,0 +1,143 @@
+// File path: tipatools/ipadict/phones.go
+
+package main
+
+// Phone inventory report ("ipadict phones DICT").
+//
+// The pronunciations of one or more dictionaries are segmented into phones
+// with ipadict/phone, and every phone is printed with its frequency, its
+// articulatory features and a few example words:
+//
+//	<phone>\t<count>\t<share %>\t<features>\t<example words>
+//
+// Phones whose base symbols are not IPA (stray Latin letters, digits,
+// punctuation) have "?" as features, which makes transcription errors easy
+// to spot at the bottom of the inventory.
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+
+	"ipadict/phone"
+	"ipadict/remote"
+)
+
+// phoneStat is one line of the inventory.
+type phoneStat struct {
+	Phone    string
+	Count    int
+	Examples []string
+}
+
+// countPhones segments every pronunciation of entries and counts phone
+// occurrences, keeping up to examples words per phone (in word order).
+func countPhones(entries map[string][]string, examples int) ([]phoneStat, int) {
+	words := make([]string, 0, len(entries))
+	for word := range entries {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	stats := make(map[string]*phoneStat)
+	total := 0
+	for _, word := range words {
+		inWord := make(map[string]bool)
+		for _, pron := range entries[word] {
+			for _, p := range phone.Segment(pron) {
+				st := stats[p]
+				if st == nil {
+					st = &phoneStat{Phone: p}
+					stats[p] = st
+				}
+				st.Count++
+				total++
+				if !inWord[p] && len(st.Examples) < examples {
+					st.Examples = append(st.Examples, word)
+				}
+				inWord[p] = true
+			}
+		}
+	}
+
+	list := make([]phoneStat, 0, len(stats))
+	for _, st := range stats {
+		list = append(list, *st)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Phone < list[j].Phone
+	})
+	return list, total
+}
+
+// writePhoneStats prints the inventory, most frequent phones first.
+func writePhoneStats(w io.Writer, list []phoneStat, total int) error {
+	bw := bufio.NewWriter(w)
+	for _, st := range list {
+		features := "?"
+		if f, ok := phone.Lookup(st.Phone); ok {
+			features = f.String()
+		}
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(st.Count) / float64(total)
+		}
+		fmt.Fprintf(bw, "%s\t%d\t%s\t%s\t%s\n",
+			st.Phone, st.Count, strconv.FormatFloat(share, 'f', 2, 64), features, strings.Join(st.Examples, ", "))
+	}
+	return bw.Flush()
+}
+
+// runPhones implements "ipadict phones [flags] DICT [DICT ...]".
+func runPhones(args []string) error {
+	fs := flag.NewFlagSet("ipadict phones", flag.ContinueOnError)
+	examples := fs.Int("examples", 3, "number of example words per phone")
+	cacheDir := fs.String("cache-dir", remote.DefaultCacheDir(), "cache directory for dictionaries loaded over HTTP/HTTPS")
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		printUsage(os.Stderr)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printUsage(os.Stdout)
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: ipadict phones [--examples N] [--cache-dir DIR] DICT [DICT ...]")
+	}
+	if *examples < 0 {
+		return fmt.Errorf("invalid --examples value %d (must be >= 0)", *examples)
+	}
+
+	rep := phono.NewRepresentation()
+	if err := loadDictionaries(rep, phono.MergeModeAppend, *cacheDir, fs.Args()...); err != nil {
+		return err
+	}
+	list, total := countPhones(rep.Entries, *examples)
+	if err := writePhoneStats(os.Stdout, list, total); err != nil {
+		return err
+	}
+
+	unknown := 0
+	for _, st := range list {
+		if _, ok := phone.Lookup(st.Phone); !ok {
+			unknown++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Phones: %d (not in the IPA charts: %d), phone occurrences: %d, words: %d\n",
+		len(list), unknown, total, len(rep.Entries))
+	return nil
+}
@@ -0,0 +1,54 @@
+// File path: tipatools/ipadict/phrases.go
+
+package main
+
+// Multi-word (phrase) entries.
+//
+// Wiktionary has pronunciations for locutions such as "pomme de terre",
+// "à peu près" or "New York", which are not the concatenation of the
+// pronunciations of their words. Such titles are kept as regular entries
+// whose key contains single ASCII spaces (see wordkey.Phrase): a key with a
+// space is a phrase.
+// phonetize matches phrase entries before scanning word by word.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// isPhrase reports whether word is a multi-word entry.
+func isPhrase(word string) bool {
+	return strings.Contains(word, " ")
+}
+
+// validatePhrases checks a --phrases value.
+func validatePhrases(mode string) error {
+	switch mode {
+	case "", "keep", "drop", "only":
+		return nil
+	}
+	return fmt.Errorf("invalid phrases mode %q (must be \"keep\", \"drop\" or \"only\")", mode)
+}
+
+// keepPhrase returns the filter implementing a --phrases mode, or nil when
+// every entry is kept.
+func keepPhrase(mode string) func(word, pron string) bool {
+	switch mode {
+	case "drop":
+		return func(word, _ string) bool { return !isPhrase(word) }
+	case "only":
+		return func(word, _ string) bool { return isPhrase(word) }
+	}
+	return nil
+}
+
+// countPhrases returns the number of phrase entries in entries.
+func countPhrases(entries map[string][]string) int {
+	n := 0
+	for word := range entries {
+		if isPhrase(word) {
+			n++
+		}
+	}
+	return n
+}
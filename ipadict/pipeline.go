@@ -0,0 +1,441 @@
+// File path: tipatools/ipadict/pipeline.go
+
+package main
+
+// Build pipeline shared by the flag-driven CLI and "ipadict build" recipes.
+//
+// A pipeline is an ordered list of sources, each carrying its own kind,
+// language, merge mode, page filter and normalization, followed by one or
+// more export targets.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+	"golang.org/x/text/unicode/norm"
+
+	"ipadict/alphabet"
+	"ipadict/wordkey"
+)
+
+// buildSource is a single step of a build pipeline.
+type buildSource struct {
+	Path      string          // local path or HTTP/HTTPS URL
+	Kind      sourceKind      // sourceUnknown means "sniff the content"
+	Lang      string          // language code for dump templates
+	MergeMode phono.MergeMode // how the source is merged into the dictionary
+	Filter    pageFilter      // dump page filter
+	Normalize string          // Unicode normalization of words and pronunciations: "", "nfc" or "nfd"
+	Blocklist blocklist       // patterns of a sourceBlocklist step
+	Weight    float64         // ranking weight; 0 means 1
+}
+
+// describe returns a short label for progress and summary messages.
+func (src buildSource) describe() string {
+	if src.Kind == sourceBlocklist {
+		patterns := make([]string, len(src.Blocklist))
+		for i, re := range src.Blocklist {
+			patterns[i] = re.String()
+		}
+		return "blocklist " + strings.Join(patterns, ", ")
+	}
+	return src.Path
+}
+
+// weight returns the ranking weight of the source.
+func (src buildSource) weight() float64 {
+	if src.Weight == 0 {
+		return 1
+	}
+	return src.Weight
+}
+
+// buildOutput is an export target of a build pipeline.
+type buildOutput struct {
+	Path         string       // destination file; "" or "-" for stdout
+	ExportFormat string       // "text", "gob", "scored", "pls", "mfa", "kaldi" or "kaldi-prob"
+	Compress     string       // "", "gzip", "zstd" or "xz"
+	Prune        pruneOptions // export-time pruning of variants
+	Lang         string       // dictionary language, for "pls" and Alphabet
+	Alphabet     string       // transliteration of pronunciations; "" for IPA
+	PhonesDir    string       // directory for the phone inventory of a lexicon export
+}
+
+// validate checks the export options that depend on each other.
+func (out buildOutput) validate() error {
+	a, err := alphabet.Lookup(out.Alphabet, out.Lang)
+	if err != nil {
+		return err
+	}
+	if a != nil && (out.ExportFormat == "scored" || isLexiconFormat(out.ExportFormat)) {
+		return fmt.Errorf("the %s export only supports IPA, not %s", out.ExportFormat, a.Name)
+	}
+	if out.PhonesDir != "" && !isLexiconFormat(out.ExportFormat) {
+		return fmt.Errorf("a phone inventory needs an mfa, kaldi or kaldi-prob export, not %s", out.ExportFormat)
+	}
+	if err := out.Prune.validate(); err != nil {
+		return err
+	}
+	return validateCompress(out.Compress)
+}
+
+// pipeline is a complete, validated build.
+type pipeline struct {
+	Sources  []buildSource
+	Outputs  []buildOutput
+	CacheDir string
+	Rank     bool           // reorder pronunciations by source agreement before export
+	Keys     wordkey.Policy // normalization of word keys, applied after the last source
+	Phrases  string         // multi-word entries: "" or "keep", "drop" or "only"
+}
+
+// ranking reports whether pair scores must be collected.
+func (p *pipeline) ranking() bool {
+	if p.Rank {
+		return true
+	}
+	for _, out := range p.Outputs {
+		if out.ExportFormat == "scored" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMergeMode maps a merge mode name to its phono.MergeMode.
+func parseMergeMode(name string) (phono.MergeMode, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "append", "merge-append", "merge":
+		return phono.MergeModeAppend, nil
+	case "prepend", "merge-prepend":
+		return phono.MergeModePrepend, nil
+	case "no-override", "no-overide":
+		return phono.MergeModeNoOverride, nil
+	case "replace":
+		return phono.MergeModeReplace, nil
+	}
+	return phono.MergeModeAppend, fmt.Errorf("invalid merge mode %q (must be \"append\", \"prepend\", \"no-override\" or \"replace\")", name)
+}
+
+// validateNormalize checks a normalization name.
+func validateNormalize(name string) error {
+	switch name {
+	case "", "none", "nfc", "nfd":
+		return nil
+	}
+	return fmt.Errorf("invalid normalization %q (must be \"nfc\", \"nfd\" or \"none\")", name)
+}
+
+// normalizeString applies the Unicode normalization form to s.
+func normalizeString(s, form string) string {
+	switch form {
+	case "nfc":
+		return norm.NFC.String(s)
+	case "nfd":
+		return norm.NFD.String(s)
+	}
+	return s
+}
+
+// normalizeEntries applies the Unicode normalization form to words and
+// pronunciations, merging the pronunciations of words that become equal.
+func normalizeEntries(entries map[string][]string, form string) map[string][]string {
+	if form != "nfc" && form != "nfd" {
+		return entries
+	}
+	out := make(map[string][]string, len(entries))
+	seen := make(map[string]bool)
+	for word, prons := range entries {
+		w := normalizeString(word, form)
+		for _, pron := range prons {
+			p := normalizeString(pron, form)
+			if seen[w+"\t"+p] {
+				continue
+			}
+			seen[w+"\t"+p] = true
+			out[w] = append(out[w], p)
+		}
+	}
+	return out
+}
+
+// run executes the pipeline and writes every output.
+func (p *pipeline) run() error {
+	rep := phono.NewRepresentation()
+
+	var totalPages, totalLines int
+	var totalElapsed time.Duration
+	var removed removalStats
+	hasRemovals := false
+
+	var rk *ranker
+	if p.ranking() {
+		rk = newRanker()
+	}
+
+	for i, src := range p.Sources {
+		kind, path := src.Kind, src.Path
+		var stream io.ReadCloser
+		if kind == sourceUnknown {
+			var err error
+			if kind, path, stream, err = classifySource(src.Path, p.CacheDir); err != nil {
+				return fmt.Errorf("classify %q: %w", src.Path, err)
+			}
+		}
+
+		switch kind {
+		case sourceRemove, sourceBlocklist:
+			var keep func(word, pron string) bool
+			if kind == sourceRemove {
+				list, err := loadRemovalList(src.Path)
+				if err != nil {
+					return fmt.Errorf("remove %q: %w", src.Path, err)
+				}
+				keep = list.keep
+			} else {
+				keep = src.Blocklist.keep
+			}
+			stats := filterRepresentation(rep, keep)
+			removed.add(stats)
+			hasRemovals = true
+			fmt.Fprintf(os.Stderr,
+				"Applied %s. Removed words: %d, word/pron pairs: %d (words: %d, unique word/pron pairs: %d)\n",
+				src.describe(), stats.Words, stats.Pairs, len(rep.Entries), countPairs(rep.Entries))
+		case sourceDump:
+			stats, err := p.scanDump(rep, i, src, stream, rk)
+			if err != nil {
+				return fmt.Errorf("scan %q: %w", src.Path, err)
+			}
+			totalPages += stats.Pages
+			totalLines += stats.Lines
+			totalElapsed += stats.Elapsed
+		default:
+			// Treat as dictionary source, using phonodict preloaders.
+			if err := p.loadDictionary(rep, i, src, path, rk); err != nil {
+				return fmt.Errorf("preload %q: %w", src.Path, err)
+			}
+		}
+	}
+
+	uniqueEntries(rep.Entries)
+
+	if p.Keys.Enabled() {
+		before := len(rep.Entries)
+		mapping := wordkey.KeyMap(p.Keys, rep.Entries)
+		normalized := phono.NewRepresentation()
+		mergeEntries(normalized, phono.MergeModeAppend, wordkey.Rekey(rep.Entries, mapping))
+		rep = normalized
+		if rk != nil {
+			rk.rekey(mapping)
+		}
+		fmt.Fprintf(os.Stderr, "Normalized keys: %d words before, %d after\n", before, len(rep.Entries))
+	}
+
+	if keep := keepPhrase(p.Phrases); keep != nil {
+		stats := filterRepresentation(rep, keep)
+		fmt.Fprintf(os.Stderr, "Phrases %s. Removed words: %d\n", p.Phrases, stats.Words)
+	}
+
+	entries := rep.Entries
+	if rk != nil {
+		entries = rk.reorder(entries)
+	}
+	for _, out := range p.Outputs {
+		outEntries := entries
+		if out.Prune.enabled() {
+			var stats pruneStats
+			outEntries, stats = out.Prune.prune(entries)
+			fmt.Fprintf(os.Stderr,
+				"Pruned pronunciations: %d (length outliers: %d, near variants: %d, over maximum: %d)\n",
+				stats.total(), stats.Outliers, stats.Variants, stats.Max)
+		}
+		if a, _ := alphabet.Lookup(out.Alphabet, out.Lang); a != nil {
+			var report alphabetReport
+			outEntries, report = convertEntries(a, outEntries)
+			fmt.Fprintf(os.Stderr,
+				"Converted pronunciations to %s. Dropped word/pron pairs with unmappable symbols: %d\n%s",
+				a.Name, report.Dropped, report)
+		}
+		if err := writeOutput(out, outEntries, rk); err != nil {
+			return err
+		}
+		if out.PhonesDir != "" {
+			n, err := writePhoneInventory(out.PhonesDir, outEntries)
+			if err != nil {
+				return fmt.Errorf("phone inventory: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Wrote phone inventory to %s (phones: %d)\n", out.PhonesDir, n)
+		}
+	}
+
+	if hasRemovals {
+		fmt.Fprintf(os.Stderr,
+			"Removed words: %d, word/pron pairs: %d\n", removed.Words, removed.Pairs)
+	}
+	fmt.Fprintf(os.Stderr,
+		"Finished. Scanned pages: %d, lines: %d (words: %d, unique word/pron pairs: %d, total elapsed: %.3f seconds)\n",
+		totalPages, totalLines, len(rep.Entries), countPairs(rep.Entries), totalElapsed.Seconds())
+	if n := countPhrases(rep.Entries); n > 0 {
+		fmt.Fprintf(os.Stderr, "Phrase entries: %d\n", n)
+	}
+	return nil
+}
+
+// scanDump scans a dump source into rep and prints its summary. When stream
+// is not nil, it is the dump already downloaded by classifySource, and it is
+// read and closed instead of opening src again. When rk is not nil, the
+// pairs of the dump and the pages they occur in are recorded in it, under
+// the source index i. Dumps with a normalization, or scanned while ranking,
+// are first parsed on their own, then merged.
+func (p *pipeline) scanDump(rep *phono.Representation, i int, src buildSource, stream io.ReadCloser, rk *ranker) (dumpStats, error) {
+	target, mode := rep, src.MergeMode
+	if src.Normalize != "" || rk != nil {
+		target, mode = phono.NewRepresentation(), phono.MergeModeAppend
+	}
+	scanner := &dumpScanner{Lang: src.Lang, Mode: mode, Filter: src.Filter}
+	scanner.Progress = func(lines, words, uniquePairs int) {
+		fmt.Fprintf(os.Stderr,
+			"\rScanning %s... lines: %d (words: %d, unique word/pron pairs: %d)",
+			src.Path, lines, words, uniquePairs)
+	}
+	if rk != nil {
+		// Occurrences are the pairs merged from each page, so that every
+		// pair of the dump is counted on the pages it comes from.
+		scanner.OnPage = func(id int64, word string, prons []string) {
+			word = normalizeString(word, src.Normalize)
+			for _, pron := range prons {
+				rk.occur(word, normalizeString(pron, src.Normalize), i, id)
+			}
+		}
+	}
+
+	var stats dumpStats
+	var err error
+	if stream != nil {
+		var rc io.ReadCloser
+		if rc, err = openStream(src.Path, stream); err != nil {
+			return stats, err
+		}
+		stats, err = scanner.Parse(rc, target)
+		rc.Close()
+	} else {
+		stats, err = scanner.ParseSource(src.Path, target)
+	}
+	if err != nil {
+		return stats, err
+	}
+	if target != rep {
+		entries := normalizeEntries(target.Entries, src.Normalize)
+		if rk != nil {
+			rk.attest(entries, i, src.weight())
+		}
+		mergeEntries(rep, src.MergeMode, entries)
+	}
+
+	pages := fmt.Sprintf("Scanned pages: %d, kept: %d, ", stats.Pages, stats.Kept)
+	if stats.Unfiltered {
+		pages = "Scanned "
+	}
+	fmt.Fprintf(os.Stderr,
+		"\rFinished %s. %slines: %d (words: %d, unique word/pron pairs: %d, elapsed: %.3f seconds)\n",
+		src.Path, pages, stats.Lines, len(rep.Entries), countPairs(rep.Entries), stats.Elapsed.Seconds())
+	if len(stats.Skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped pages by namespace: %s\n", formatSkipped(stats.Skipped))
+	}
+	if stats.TitleSkipped > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped pages by title filter: %d\n", stats.TitleSkipped)
+	}
+	return stats, nil
+}
+
+// loadDictionary merges a dictionary source into rep. Sources with a
+// normalization, or loaded while ranking, are first loaded on their own,
+// normalized and attested in rk under the source index i, then merged. The
+// dictionary is read from path, which is src.Path or its cached copy (see
+// classifySource).
+func (p *pipeline) loadDictionary(rep *phono.Representation, i int, src buildSource, path string, rk *ranker) error {
+	if src.Normalize == "" && rk == nil {
+		return loadDictionaries(rep, src.MergeMode, p.CacheDir, path)
+	}
+	tmp := phono.NewRepresentation()
+	if err := loadDictionaries(tmp, phono.MergeModeAppend, p.CacheDir, path); err != nil {
+		return err
+	}
+	entries := normalizeEntries(tmp.Entries, src.Normalize)
+	if rk != nil {
+		rk.attest(entries, i, src.weight())
+	}
+	mergeEntries(rep, src.MergeMode, entries)
+	return nil
+}
+
+// writeOutput exports entries to a single target. rk is only used by the
+// "scored" export.
+func writeOutput(out buildOutput, entries map[string][]string, rk *ranker) error {
+	if out.Path == "" || out.Path == "-" {
+		return writeCompressed(os.Stdout, out, entries, rk)
+	}
+	f, err := os.Create(out.Path)
+	if err != nil {
+		return fmt.Errorf("create %q: %w", out.Path, err)
+	}
+	if err := writeCompressed(f, out, entries, rk); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeCompressed writes entries to w in the export format and compression
+// of out. It does not close w.
+func writeCompressed(w io.Writer, out buildOutput, entries map[string][]string, rk *ranker) error {
+	cw, closer, err := compressWriter(w, out.Compress)
+	if err != nil {
+		return err
+	}
+	if err := writeFormat(cw, out, entries, rk); err != nil {
+		closer.Close()
+		return err
+	}
+	if err := closer.Close(); err != nil {
+		return fmt.Errorf("compress %s: %w", out.Compress, err)
+	}
+	return nil
+}
+
+// writeFormat writes entries to w in the export format of out.
+func writeFormat(w io.Writer, out buildOutput, entries map[string][]string, rk *ranker) error {
+	switch out.ExportFormat {
+	case "text":
+		if err := writeTextDictionary(w, entries); err != nil {
+			return fmt.Errorf("write text: %w", err)
+		}
+	case "gob":
+		if err := writeGobDictionary(w, entries); err != nil {
+			return fmt.Errorf("write gob: %w", err)
+		}
+	case "scored":
+		if err := writeScoredDictionary(w, entries, rk); err != nil {
+			return fmt.Errorf("write scored: %w", err)
+		}
+	case "pls":
+		if err := writePLSDictionary(w, entries, out.Lang, out.Alphabet); err != nil {
+			return fmt.Errorf("write pls: %w", err)
+		}
+	case "mfa", "kaldi", "kaldi-prob":
+		skipped, err := writeLexicon(w, entries, out.ExportFormat, rk)
+		if err != nil {
+			return fmt.Errorf("write %s: %w", out.ExportFormat, err)
+		}
+		if skipped > 0 {
+			fmt.Fprintf(os.Stderr, "Skipped phrase entries in the %s lexicon: %d\n", out.ExportFormat, skipped)
+		}
+	default:
+		return fmt.Errorf("invalid export format %q (must be \"text\", \"gob\", \"scored\", \"pls\", \"mfa\", \"kaldi\" or \"kaldi-prob\")", out.ExportFormat)
+	}
+	return nil
+}
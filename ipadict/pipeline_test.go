@@ -0,0 +1,84 @@
+// File path: tipatools/ipadict/pipeline_test.go
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+func TestWriteOutput(t *testing.T) {
+	entries := map[string][]string{"chat": {"ʃa"}, "chien": {"ʃjɛ̃"}}
+	for _, compress := range []string{"", "gzip", "zstd", "xz"} {
+		path := filepath.Join(t.TempDir(), "fr.txt")
+		out := buildOutput{Path: path, ExportFormat: "text", Compress: compress}
+		if err := writeOutput(out, entries, nil); err != nil {
+			t.Fatalf("%q: %v", compress, err)
+		}
+		rc, err := openSource(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "chat\tʃa\nchien\tʃjɛ̃\n"; string(got) != want {
+			t.Errorf("%q: got %q, want %q", compress, got, want)
+		}
+	}
+
+	out := buildOutput{Path: filepath.Join(t.TempDir(), "fr.txt"), ExportFormat: "csv", Compress: "zstd"}
+	if err := writeOutput(out, entries, nil); err == nil {
+		t.Error("invalid export format accepted")
+	}
+}
+
+func TestScanDumpRecordsMergedPairs(t *testing.T) {
+	dump := `<mediawiki>
+<page><title>chat</title><ns>0</ns><id>1</id><revision><text>{{pron|ʃa|fr}} {{pron|ʃa|2|fr}}
+{{écouter|lang=fr|{{pron|/ʃɑ/|fr}}}}</text></revision></page>
+<page><title>chat</title><ns>0</ns><id>2</id><revision><text>{{pron|[ʃa]|fr}} {{pron|''ʃa''|fr}}</text></revision></page>
+<page><title>chien</title><ns>0</ns><id>3</id><revision><text>{{pron|ʃjɛ̃
+|fr}}</text></revision></page>
+</mediawiki>
+`
+	path := filepath.Join(t.TempDir(), "pages.xml")
+	if err := os.WriteFile(path, []byte(dump), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rep := phono.NewRepresentation()
+	rk := newRanker()
+	src := buildSource{Path: path, Lang: "fr", MergeMode: phono.MergeModeAppend}
+	if _, err := (&pipeline{}).scanDump(rep, 0, src, nil, rk); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every merged pair has occurrences, and every occurrence is a merged
+	// pair: rejected parameters are neither merged nor counted.
+	occurrences := map[string]int{"chat\tʃa": 2, "chat\tʃɑ": 1, "chien\tʃjɛ̃": 1}
+	for word, prons := range rep.Entries {
+		for _, pron := range prons {
+			key := pairKey(word, pron)
+			if got := rk.score(word, pron).Occurrences; got != occurrences[key] {
+				t.Errorf("%q: %d occurrences, want %d", key, got, occurrences[key])
+			}
+			delete(occurrences, key)
+		}
+	}
+	if len(occurrences) > 0 {
+		t.Errorf("pairs not merged: %v", occurrences)
+	}
+	for word, prons := range rk.pairs {
+		for pron := range prons {
+			if _, ok := rep.SeenWordPron[pairKey(word, pron)]; !ok {
+				t.Errorf("occurrence of %q / %q, which was not merged", word, pron)
+			}
+		}
+	}
+}
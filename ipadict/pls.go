@@ -0,0 +1,76 @@
+// File path: tipatools/ipadict/pls.go
+
+package main
+
+// W3C Pronunciation Lexicon Specification (PLS 1.0) export.
+//
+// Each word becomes a <lexeme> with one <grapheme> and one <phoneme> per
+// pronunciation, in dictionary order (the first phoneme is the preferred
+// one for TTS engines). See https://www.w3.org/TR/pronunciation-lexicon/.
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"sort"
+)
+
+// PLS document skeleton; the alphabet and the language are written between
+// the parts of the header.
+const (
+	plsHeaderStart = `<?xml version="1.0" encoding="UTF-8"?>
+<lexicon version="1.0"
+      xmlns="http://www.w3.org/2005/01/pronunciation-lexicon"
+      xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
+      xsi:schemaLocation="http://www.w3.org/2005/01/pronunciation-lexicon http://www.w3.org/TR/2007/CR-pronunciation-lexicon-20071212/pls.xsd"
+      alphabet="`
+	plsHeaderLang = `" xml:lang="`
+	plsHeaderEnd  = "\">\n"
+	plsFooter     = "</lexicon>\n"
+)
+
+// plsAlphabet returns the PLS alphabet attribute for a --export-alphabet
+// name: "ipa", or a vendor-specific "x-" value.
+func plsAlphabet(name string) string {
+	switch name {
+	case "", "ipa":
+		return "ipa"
+	case "x-sampa":
+		return name
+	}
+	return "x-" + name
+}
+
+// writePLSDictionary writes entries as a PLS lexicon for language lang,
+// sorted by word. alpha is the alphabet of the pronunciations ("" for IPA).
+func writePLSDictionary(w io.Writer, entries map[string][]string, lang, alpha string) error {
+	words := make([]string, 0, len(entries))
+	for word := range entries {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(plsHeaderStart)
+	bw.WriteString(plsAlphabet(alpha))
+	bw.WriteString(plsHeaderLang)
+	xml.EscapeText(bw, []byte(lang))
+	bw.WriteString(plsHeaderEnd)
+	for _, word := range words {
+		prons := entries[word]
+		if len(prons) == 0 {
+			continue
+		}
+		bw.WriteString("  <lexeme>\n    <grapheme>")
+		xml.EscapeText(bw, []byte(word))
+		bw.WriteString("</grapheme>\n")
+		for _, pron := range prons {
+			bw.WriteString("    <phoneme>")
+			xml.EscapeText(bw, []byte(pron))
+			bw.WriteString("</phoneme>\n")
+		}
+		bw.WriteString("  </lexeme>\n")
+	}
+	bw.WriteString(plsFooter)
+	return bw.Flush()
+}
@@ -0,0 +1,97 @@
+// File path: tipatools/ipadict/pls_test.go
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// plsLexicon is the part of a PLS 1.0 document checked by the tests.
+type plsLexicon struct {
+	XMLName  xml.Name `xml:"http://www.w3.org/2005/01/pronunciation-lexicon lexicon"`
+	Version  string   `xml:"version,attr"`
+	Alphabet string   `xml:"alphabet,attr"`
+	Lang     string   `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Lexemes  []struct {
+		Graphemes []string `xml:"grapheme"`
+		Phonemes  []string `xml:"phoneme"`
+	} `xml:"lexeme"`
+}
+
+func TestWritePLSDictionary(t *testing.T) {
+	entries := map[string][]string{
+		"chien":      {"ʃjɛ̃"},
+		"AT&T":       {"ate ate"},
+		"<3":         {"lʌv"},
+		`"citation"`: {"sitasjɔ̃", "sitɑsjɔ̃"},
+		"vide":       nil,
+	}
+	var buf bytes.Buffer
+	if err := writePLSDictionary(&buf, entries, `fr"FR`, ""); err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.String()
+	if !strings.HasPrefix(doc, `<?xml version="1.0" encoding="UTF-8"?>`) {
+		t.Errorf("missing XML declaration: %q", doc[:min(len(doc), 40)])
+	}
+	for _, raw := range []string{">AT&T<", "><3<", `>"citation"<`} {
+		if strings.Contains(doc, raw) {
+			t.Errorf("%q written unescaped", raw)
+		}
+	}
+
+	var lex plsLexicon
+	if err := xml.Unmarshal(buf.Bytes(), &lex); err != nil {
+		t.Fatalf("invalid PLS document: %v\n%s", err, doc)
+	}
+	if lex.Version != "1.0" || lex.Alphabet != "ipa" || lex.Lang != `fr"FR` {
+		t.Errorf("lexicon version %q, alphabet %q, lang %q", lex.Version, lex.Alphabet, lex.Lang)
+	}
+	var got [][]string
+	for _, l := range lex.Lexemes {
+		if len(l.Graphemes) != 1 {
+			t.Errorf("lexeme with graphemes %q, want one", l.Graphemes)
+		}
+		got = append(got, append(l.Graphemes, l.Phonemes...))
+	}
+	want := [][]string{
+		{`"citation"`, "sitasjɔ̃", "sitɑsjɔ̃"},
+		{"<3", "lʌv"},
+		{"AT&T", "ate ate"},
+		{"chien", "ʃjɛ̃"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lexemes = %q, want %q", got, want)
+	}
+}
+
+func TestPLSAlphabet(t *testing.T) {
+	tests := map[string]string{
+		"":        "ipa",
+		"ipa":     "ipa",
+		"x-sampa": "x-sampa",
+		"sampa":   "x-sampa",
+		"arpabet": "x-arpabet",
+	}
+	for name, want := range tests {
+		if got := plsAlphabet(name); got != want {
+			t.Errorf("plsAlphabet(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writePLSDictionary(&buf, map[string][]string{"chat": {"Sa"}}, "fr", "sampa"); err != nil {
+		t.Fatal(err)
+	}
+	var lex plsLexicon
+	if err := xml.Unmarshal(buf.Bytes(), &lex); err != nil {
+		t.Fatal(err)
+	}
+	if lex.Alphabet != "x-sampa" {
+		t.Errorf("alphabet = %q, want x-sampa", lex.Alphabet)
+	}
+}
@@ -0,0 +1,176 @@
+// File path: tipatools/ipadict/prune.go
+
+package main
+
+// Export-time pruning of pronunciation variants.
+//
+// After merging several sources, a word may accumulate many near-identical
+// pronunciations. Pruning runs on the final (possibly ranked) order, so the
+// first pronunciation of a word is always kept and variants are only dropped
+// in favour of higher-ranked ones. The steps run in this order: length
+// outliers, near-duplicate variants, then the per-word maximum.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// pruneOptions configures the pruning of an export. The zero value disables
+// every step.
+type pruneOptions struct {
+	MaxProns    int     // keep at most this many pronunciations per word; 0 = unlimited
+	Distance    int     // drop variants within this edit distance of a higher-ranked one; 0 = off
+	LengthRatio float64 // drop pronunciations whose length differs from the word's median by more than this factor; 0 = off
+}
+
+// pruneStats counts the pronunciations dropped by each step.
+type pruneStats struct {
+	Outliers int
+	Variants int
+	Max      int
+}
+
+// total returns the number of dropped pronunciations.
+func (s pruneStats) total() int {
+	return s.Outliers + s.Variants + s.Max
+}
+
+// enabled reports whether at least one pruning step is active.
+func (o pruneOptions) enabled() bool {
+	return o.MaxProns > 0 || o.Distance > 0 || o.LengthRatio > 0
+}
+
+// validate checks the option values.
+func (o pruneOptions) validate() error {
+	if o.MaxProns < 0 {
+		return fmt.Errorf("invalid max pronunciations %d (must be positive)", o.MaxProns)
+	}
+	if o.Distance < 0 {
+		return fmt.Errorf("invalid prune distance %d (must be positive)", o.Distance)
+	}
+	if o.LengthRatio != 0 && o.LengthRatio <= 1 {
+		return fmt.Errorf("invalid length ratio %g (must be greater than 1)", o.LengthRatio)
+	}
+	return nil
+}
+
+// prune returns a copy of entries with the pruning steps applied.
+func (o pruneOptions) prune(entries map[string][]string) (map[string][]string, pruneStats) {
+	var stats pruneStats
+	out := make(map[string][]string, len(entries))
+	for word, prons := range entries {
+		kept := prons
+		if o.LengthRatio > 0 {
+			var n int
+			kept, n = dropLengthOutliers(kept, o.LengthRatio)
+			stats.Outliers += n
+		}
+		if o.Distance > 0 {
+			var n int
+			kept, n = dropNearVariants(kept, o.Distance)
+			stats.Variants += n
+		}
+		if o.MaxProns > 0 && len(kept) > o.MaxProns {
+			stats.Max += len(kept) - o.MaxProns
+			kept = kept[:o.MaxProns]
+		}
+		out[word] = kept
+	}
+	return out, stats
+}
+
+// pronLength returns the number of segments of pron, ignoring syllable
+// breaks and stress marks.
+func pronLength(pron string) int {
+	n := 0
+	for _, r := range pron {
+		switch r {
+		case '.', 'ˈ', 'ˌ', ' ':
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// dropLengthOutliers removes the pronunciations whose length is more than
+// ratio times longer or shorter than the median length of prons. Words with
+// fewer than three pronunciations have no meaningful median and are left
+// untouched; the first pronunciation is always kept.
+func dropLengthOutliers(prons []string, ratio float64) ([]string, int) {
+	if len(prons) < 3 {
+		return prons, 0
+	}
+	lengths := make([]int, len(prons))
+	for i, p := range prons {
+		lengths[i] = pronLength(p)
+	}
+	sorted := append([]int(nil), lengths...)
+	sort.Ints(sorted)
+	median := float64(sorted[len(sorted)/2])
+	if len(sorted)%2 == 0 {
+		median = float64(sorted[len(sorted)/2-1]+sorted[len(sorted)/2]) / 2
+	}
+	if median == 0 {
+		return prons, 0
+	}
+
+	kept := make([]string, 0, len(prons))
+	for i, p := range prons {
+		l := float64(lengths[i])
+		if i > 0 && (l > median*ratio || l*ratio < median) {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept, len(prons) - len(kept)
+}
+
+// dropNearVariants removes every pronunciation within maxDist edits of a
+// pronunciation ranked before it.
+func dropNearVariants(prons []string, maxDist int) ([]string, int) {
+	kept := make([]string, 0, len(prons))
+	for _, p := range prons {
+		near := false
+		for _, k := range kept {
+			if editDistance(stripSyllables(k), stripSyllables(p)) <= maxDist {
+				near = true
+				break
+			}
+		}
+		if !near {
+			kept = append(kept, p)
+		}
+	}
+	return kept, len(prons) - len(kept)
+}
+
+// stripSyllables removes syllable breaks, which do not make two
+// pronunciations different.
+func stripSyllables(pron string) string {
+	return strings.ReplaceAll(pron, ".", "")
+}
+
+// editDistance returns the Levenshtein distance between a and b, counted in
+// runes.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,199 @@
+// File path: tipatools/ipadict/prune_test.go
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPruneOptionsValidate(t *testing.T) {
+	tests := []struct {
+		opts    pruneOptions
+		enabled bool
+		errMsg  string
+	}{
+		{pruneOptions{}, false, ""},
+		{pruneOptions{MaxProns: 3, Distance: 1, LengthRatio: 1.5}, true, ""},
+		{pruneOptions{Distance: 2}, true, ""},
+		{pruneOptions{MaxProns: -1}, false, "max pronunciations"},
+		{pruneOptions{Distance: -1}, false, "prune distance"},
+		{pruneOptions{LengthRatio: 1}, true, "length ratio"},
+		{pruneOptions{LengthRatio: 0.5}, true, "length ratio"},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.enabled(); got != tt.enabled {
+			t.Errorf("%+v: enabled() = %v, want %v", tt.opts, got, tt.enabled)
+		}
+		err := tt.opts.validate()
+		if tt.errMsg == "" {
+			if err != nil {
+				t.Errorf("%+v: validate() = %v", tt.opts, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("%+v: validate() = %v, want %q", tt.opts, err, tt.errMsg)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	entries := map[string][]string{
+		// ʃjɛ̃ʃjɛ̃ʃjɛ̃ is a length outlier, ʃjɛ and ʃjɛn are one edit away
+		// from ʃjɛ̃, which comes first.
+		"chien": {"ʃjɛ̃", "ʃjɛ", "ʃjɛ̃ʃjɛ̃ʃjɛ̃", "ʃœ̃", "ʃjɛn"},
+		// No variant is near another: only the maximum applies.
+		"chat": {"ʃa", "kat", "tʃat", "pʁa"},
+		"eau":  {"o"},
+	}
+	tests := []struct {
+		name  string
+		opts  pruneOptions
+		want  map[string][]string
+		stats pruneStats
+	}{
+		{
+			"every step",
+			pruneOptions{MaxProns: 2, Distance: 1, LengthRatio: 2},
+			map[string][]string{"chien": {"ʃjɛ̃", "ʃœ̃"}, "chat": {"ʃa", "kat"}, "eau": {"o"}},
+			pruneStats{Outliers: 1, Variants: 2, Max: 2},
+		},
+		{
+			// --max-prons 0 keeps every pronunciation.
+			"unlimited",
+			pruneOptions{Distance: 1},
+			map[string][]string{"chien": {"ʃjɛ̃", "ʃjɛ̃ʃjɛ̃ʃjɛ̃", "ʃœ̃"}, "chat": {"ʃa", "kat", "tʃat", "pʁa"}, "eau": {"o"}},
+			pruneStats{Variants: 2},
+		},
+		{
+			"maximum only",
+			pruneOptions{MaxProns: 1},
+			map[string][]string{"chien": {"ʃjɛ̃"}, "chat": {"ʃa"}, "eau": {"o"}},
+			pruneStats{Max: 7},
+		},
+		{"disabled", pruneOptions{}, entries, pruneStats{}},
+	}
+	for _, tt := range tests {
+		got, stats := tt.opts.prune(entries)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: prune = %v, want %v", tt.name, got, tt.want)
+		}
+		if stats != tt.stats || stats.total() != tt.stats.Outliers+tt.stats.Variants+tt.stats.Max {
+			t.Errorf("%s: stats = %+v, want %+v", tt.name, stats, tt.stats)
+		}
+	}
+	// The input is left alone.
+	if want := []string{"ʃjɛ̃", "ʃjɛ", "ʃjɛ̃ʃjɛ̃ʃjɛ̃", "ʃœ̃", "ʃjɛn"}; !reflect.DeepEqual(entries["chien"], want) {
+		t.Errorf("input modified: %v", entries["chien"])
+	}
+}
+
+func TestPronLength(t *testing.T) {
+	tests := []struct {
+		pron string
+		want int
+	}{
+		{"ʃa", 2},
+		{"ˈʃa.ta", 4},
+		{"ˌpɔm də ˈtɛʁ", 8},
+		{"ɑ̃", 2}, // the combining tilde is a rune
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := pronLength(tt.pron); got != tt.want {
+			t.Errorf("pronLength(%q) = %d, want %d", tt.pron, got, tt.want)
+		}
+	}
+}
+
+func TestDropLengthOutliers(t *testing.T) {
+	tests := []struct {
+		name    string
+		prons   []string
+		ratio   float64
+		want    []string
+		dropped int
+	}{
+		{"single pronunciation", []string{"ʃaʃaʃaʃa"}, 1.1, []string{"ʃaʃaʃaʃa"}, 0},
+		{"two pronunciations", []string{"ʃa", "ʃaʃaʃaʃa"}, 1.1, []string{"ʃa", "ʃaʃaʃaʃa"}, 0},
+		{
+			// Lengths 2, 8, 3: median 3.
+			"odd count",
+			[]string{"ʃa", "ʃaʃaʃaʃa", "ʃat"}, 2,
+			[]string{"ʃa", "ʃat"}, 1,
+		},
+		{
+			// Lengths 16, 3, 4, 6: median 5, so 4 and 6 are within 1.25
+			// of it, 3 is not. The first pronunciation is kept although
+			// it is the longest; '.' and stress marks do not count.
+			"even count",
+			[]string{"ʃaʃaʃaʃaʃaʃaʃaʃa", "ʃat", "ʃa.ta", "ˈʃa.tata"}, 1.25,
+			[]string{"ʃaʃaʃaʃaʃaʃaʃaʃa", "ʃa.ta", "ˈʃa.tata"}, 1,
+		},
+		{"zero median", []string{".", "ˈ", " ", "a"}, 2, []string{".", "ˈ", " ", "a"}, 0},
+	}
+	for _, tt := range tests {
+		got, dropped := dropLengthOutliers(tt.prons, tt.ratio)
+		if !reflect.DeepEqual(got, tt.want) || dropped != tt.dropped {
+			t.Errorf("%s: dropLengthOutliers = %q, %d; want %q, %d", tt.name, got, dropped, tt.want, tt.dropped)
+		}
+	}
+}
+
+func TestDropNearVariants(t *testing.T) {
+	tests := []struct {
+		name    string
+		prons   []string
+		maxDist int
+		want    []string
+		dropped int
+	}{
+		{
+			// The best ranked pronunciation survives its variants.
+			"first kept",
+			[]string{"ʃjɛ̃", "ʃjɛ", "ʃi.jɛ̃", "kaʁ"}, 1,
+			[]string{"ʃjɛ̃", "kaʁ"}, 2,
+		},
+		{
+			// ʃjɛ is dropped for ʃjɛ̃, so ʃjɛn is only compared with ʃjɛ̃.
+			"compared with kept ones",
+			[]string{"ʃjɛ̃", "ʃjɛ", "ʃjɛn"}, 1,
+			[]string{"ʃjɛ̃"}, 2,
+		},
+		{"syllable breaks ignored", []string{"ʃa.ta", "ʃata", "ʃat"}, 0, []string{"ʃa.ta", "ʃat"}, 1},
+		{"far apart", []string{"ʃa", "kat", "tʃat"}, 1, []string{"ʃa", "kat", "tʃat"}, 0},
+	}
+	for _, tt := range tests {
+		got, dropped := dropNearVariants(tt.prons, tt.maxDist)
+		if !reflect.DeepEqual(got, tt.want) || dropped != tt.dropped {
+			t.Errorf("%s: dropNearVariants = %q, %d; want %q, %d", tt.name, got, dropped, tt.want, tt.dropped)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"ʃa", "", 2},
+		{"", "kat", 3},
+		{"kitten", "sitting", 3},
+		{"ʃa", "ʃa", 0},
+		// Distances are counted in runes, not bytes: a combining mark is
+		// one edit, a different two-byte vowel is one substitution.
+		{"ʃjɛ̃", "ʃjɛ", 1},
+		{"ɛ̃", "ɑ̃", 1},
+		{"t͡ʃa", "tʃa", 1},
+		{"ʁə", "ʁø", 1},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := editDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// File path: tipatools/ipadict/rank.go
+
+package main
+
+// Pronunciation ranking by source agreement and frequency.
+//
+// When ranking is enabled, every source attests the word/pronunciation pairs
+// it contains. A pair's score is the sum of the weights of the distinct
+// sources that attest it; dumps also count the distinct pages with a
+// pronunciation template for the pair, which breaks ties between equally
+// attested pairs. Before export, the pronunciations of each word are
+// reordered by decreasing score, so the pronunciation most sources agree on
+// comes first.
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pairScore is the evidence for a word/pronunciation pair, as exported.
+type pairScore struct {
+	Score       float64 // sum of the weights of the attesting sources
+	Sources     int     // number of attesting sources
+	Occurrences int     // number of dump pages with a template of the pair
+}
+
+// pageRef identifies a page of a dump by the index of the source and the
+// page ID.
+type pageRef struct {
+	source int
+	page   int64
+}
+
+// evidence records what attests a word/pronunciation pair. Sources and pages
+// are sets, so that a pair reached again through another key (see rekey) is
+// not counted twice.
+type evidence struct {
+	sources []int            // indexes of the attesting sources, increasing
+	pages   map[pageRef]bool // dump pages with a pronunciation template
+}
+
+// addSource adds the source index i to the attesting sources.
+func (e *evidence) addSource(i int) {
+	n := len(e.sources)
+	if n > 0 && e.sources[n-1] == i {
+		return
+	}
+	if n == 0 || e.sources[n-1] < i {
+		e.sources = append(e.sources, i)
+		return
+	}
+	j := sort.SearchInts(e.sources, i)
+	if j < n && e.sources[j] == i {
+		return
+	}
+	e.sources = append(e.sources, 0)
+	copy(e.sources[j+1:], e.sources[j:])
+	e.sources[j] = i
+}
+
+// addPage adds ref to the pages with a template of the pair.
+func (e *evidence) addPage(ref pageRef) {
+	if e.pages == nil {
+		e.pages = make(map[pageRef]bool)
+	}
+	e.pages[ref] = true
+}
+
+// ranker collects pair evidence across the sources of a pipeline. Sources
+// are identified by their index in the pipeline.
+type ranker struct {
+	pairs   map[string]map[string]*evidence // word -> pronunciation -> evidence
+	weights map[int]float64                 // source index -> weight
+}
+
+// newRanker returns an empty ranker.
+func newRanker() *ranker {
+	return &ranker{
+		pairs:   make(map[string]map[string]*evidence),
+		weights: make(map[int]float64),
+	}
+}
+
+// pair returns the evidence of (word, pron), creating it if needed.
+func (r *ranker) pair(word, pron string) *evidence {
+	prons := r.pairs[word]
+	if prons == nil {
+		prons = make(map[string]*evidence)
+		r.pairs[word] = prons
+	}
+	e := prons[pron]
+	if e == nil {
+		e = &evidence{}
+		prons[pron] = e
+	}
+	return e
+}
+
+// attest records that the source with index source and the given weight
+// contains entries. Each pair is counted once per source.
+func (r *ranker) attest(entries map[string][]string, source int, weight float64) {
+	r.weights[source] = weight
+	for word, prons := range entries {
+		for _, pron := range prons {
+			r.pair(word, pron).addSource(source)
+		}
+	}
+}
+
+// occur records that page of the dump with index source has a pronunciation
+// template for (word, pron). Each pair is counted once per page.
+func (r *ranker) occur(word, pron string, source int, page int64) {
+	r.pair(word, pron).addPage(pageRef{source: source, page: page})
+}
+
+// score returns the score record of (word, pron), or a zero record.
+func (r *ranker) score(word, pron string) pairScore {
+	e := r.pairs[word][pron]
+	if e == nil {
+		return pairScore{}
+	}
+	ps := pairScore{Sources: len(e.sources), Occurrences: len(e.pages)}
+	for _, i := range e.sources {
+		ps.Score += r.weights[i]
+	}
+	return ps
+}
+
+// rekey moves the evidence of every word to its key in mapping. Pairs that
+// end up under the same key merge their sources and pages, so a source or a
+// page attesting several variants of a word still counts once.
+func (r *ranker) rekey(mapping map[string]string) {
+	pairs := make(map[string]map[string]*evidence, len(r.pairs))
+	for word, prons := range r.pairs {
+		key, ok := mapping[word]
+		if !ok {
+			key = word
+		}
+		if pairs[key] == nil {
+			pairs[key] = make(map[string]*evidence, len(prons))
+		}
+		for pron, e := range prons {
+			acc := pairs[key][pron]
+			if acc == nil {
+				pairs[key][pron] = e
+				continue
+			}
+			for _, i := range e.sources {
+				acc.addSource(i)
+			}
+			for ref := range e.pages {
+				acc.addPage(ref)
+			}
+		}
+	}
+	r.pairs = pairs
+}
+
+// reorder returns a copy of entries where the pronunciations of each word
+// are sorted by decreasing score, then occurrences. Ties keep the merge
+// order.
+func (r *ranker) reorder(entries map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(entries))
+	for word, prons := range entries {
+		sorted := append([]string(nil), prons...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			a, b := r.score(word, sorted[i]), r.score(word, sorted[j])
+			if a.Score != b.Score {
+				return a.Score > b.Score
+			}
+			return a.Occurrences > b.Occurrences
+		})
+		out[word] = sorted
+	}
+	return out
+}
+
+// writeScoredDictionary prints one line per word/pronunciation pair, in rank
+// order, with its score:
+//
+//	<word>\t<IPA>\t<score>\t<sources>\t<occurrences>
+func writeScoredDictionary(w io.Writer, entries map[string][]string, r *ranker) error {
+	words := make([]string, 0, len(entries))
+	for word := range entries {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	for _, word := range words {
+		for _, pron := range entries[word] {
+			ps := r.score(word, pron)
+			line := fmt.Sprintf("%s\t%s\t%s\t%d\t%d\n",
+				word, pron, strconv.FormatFloat(ps.Score, 'f', -1, 64), ps.Sources, ps.Occurrences)
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseSourceWeight parses a --source-weight PATH=WEIGHT value.
+func parseSourceWeight(v string) (string, float64, error) {
+	i := strings.LastIndex(v, "=")
+	if i <= 0 {
+		return "", 0, fmt.Errorf("invalid --source-weight %q (expected PATH=WEIGHT)", v)
+	}
+	w, err := strconv.ParseFloat(strings.TrimSpace(v[i+1:]), 64)
+	if err != nil || w <= 0 {
+		return "", 0, fmt.Errorf("invalid --source-weight %q: weight must be a positive number", v)
+	}
+	return strings.TrimSpace(v[:i]), w, nil
+}
@@ -0,0 +1,75 @@
+// File path: tipatools/ipadict/rank_test.go
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRankerCountsDistinctSourcesAndPages(t *testing.T) {
+	rk := newRanker()
+	// The same source attesting a pair twice counts once.
+	rk.attest(map[string][]string{"chat": {"ʃa", "ʃa", "tʃat"}}, 0, 2)
+	rk.attest(map[string][]string{"chat": {"ʃa"}}, 0, 2)
+	rk.attest(map[string][]string{"chat": {"ʃa"}}, 1, 0.5)
+
+	// A page with several templates of the same pair counts once, and page
+	// IDs are per source.
+	rk.occur("chat", "ʃa", 1, 10)
+	rk.occur("chat", "ʃa", 1, 10)
+	rk.occur("chat", "ʃa", 1, 11)
+	rk.occur("chat", "ʃa", 2, 10)
+
+	if got, want := rk.score("chat", "ʃa"), (pairScore{Score: 2.5, Sources: 2, Occurrences: 3}); got != want {
+		t.Errorf("score(ʃa) = %+v, want %+v", got, want)
+	}
+	if got, want := rk.score("chat", "tʃat"), (pairScore{Score: 2, Sources: 1}); got != want {
+		t.Errorf("score(tʃat) = %+v, want %+v", got, want)
+	}
+	if got := rk.score("chien", "ʃjɛ̃"); got != (pairScore{}) {
+		t.Errorf("score of an unknown pair = %+v", got)
+	}
+}
+
+func TestRankerRekeyMergesEvidence(t *testing.T) {
+	rk := newRanker()
+	// Source 0 has both case variants, source 1 only one of them.
+	rk.attest(map[string][]string{"Paris": {"paʁi"}, "paris": {"paʁi"}}, 0, 1)
+	rk.attest(map[string][]string{"paris": {"paʁi"}}, 1, 1)
+	rk.occur("Paris", "paʁi", 0, 7)
+	rk.occur("paris", "paʁi", 0, 7)
+	rk.occur("paris", "paʁi", 0, 8)
+
+	rk.rekey(map[string]string{"Paris": "paris"})
+	if got, want := rk.score("paris", "paʁi"), (pairScore{Score: 2, Sources: 2, Occurrences: 2}); got != want {
+		t.Errorf("score after rekey = %+v, want %+v", got, want)
+	}
+	if _, ok := rk.pairs["Paris"]; ok {
+		t.Error("old key kept after rekey")
+	}
+}
+
+func TestEvidenceAddSource(t *testing.T) {
+	var e evidence
+	for _, i := range []int{3, 1, 3, 5, 0, 1, 4} {
+		e.addSource(i)
+	}
+	if want := []int{0, 1, 3, 4, 5}; !reflect.DeepEqual(e.sources, want) {
+		t.Errorf("sources = %v, want %v", e.sources, want)
+	}
+}
+
+func TestRankerReorder(t *testing.T) {
+	rk := newRanker()
+	rk.attest(map[string][]string{"chat": {"tʃat", "ʃa"}}, 0, 1)
+	rk.attest(map[string][]string{"chat": {"ʃa"}}, 1, 1)
+	rk.attest(map[string][]string{"chien": {"ʃjɛ̃", "ʃjɛn"}}, 0, 1)
+	rk.occur("chien", "ʃjɛn", 2, 1)
+
+	got := rk.reorder(map[string][]string{"chat": {"tʃat", "ʃa"}, "chien": {"ʃjɛ̃", "ʃjɛn"}})
+	want := map[string][]string{"chat": {"ʃa", "tʃat"}, "chien": {"ʃjɛn", "ʃjɛ̃"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reorder = %v, want %v", got, want)
+	}
+}
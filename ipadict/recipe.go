@@ -0,0 +1,336 @@
+// File path: tipatools/ipadict/recipe.go
+
+package main
+
+// Declarative build recipes ("ipadict build recipe.yaml").
+//
+// A recipe describes a whole build in a reviewable YAML file: the ordered
+// list of sources, each with its own kind, language, merge mode, page filters
+// and normalization, and the list of output targets. Relative paths are
+// resolved against the directory of the recipe file.
+//
+// Example:
+//
+//	lang: fr
+//	sources:
+//	  - path: exports/curated.dict.txt
+//	    kind: dictionary
+//	    merge: append
+//	  - path: frwiktionary-latest-pages-articles.xml.bz2
+//	    kind: dump
+//	    merge: no-override
+//	    namespaces: [main, Annexe]
+//	    exclude_title: '[0-9]'
+//	    normalize: nfc
+//	  - kind: blocklist
+//	    patterns: ['[0-9]', ' ']
+//	  - path: overrides.txt
+//	    merge: replace
+//	outputs:
+//	  - path: exports/fr.dict.txt
+//	  - path: exports/fr.dict.gob.zst
+//	    export: gob
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"ipadict/alphabet"
+	"ipadict/remote"
+	"ipadict/wordkey"
+)
+
+// recipe is the YAML document read by "ipadict build".
+type recipe struct {
+	Lang       string         `yaml:"lang"`       // default language for dump sources
+	Namespaces []string       `yaml:"namespaces"` // default dump namespaces
+	CacheDir   string         `yaml:"cache_dir"`  // cache for remote dictionaries
+	Rank       bool           `yaml:"rank"`       // reorder pronunciations by source agreement
+	Keys       recipeKeys     `yaml:"keys"`       // word-key normalization
+	Phrases    string         `yaml:"phrases"`    // keep, drop or only
+	Sources    []recipeSource `yaml:"sources"`
+	Outputs    []recipeOutput `yaml:"outputs"`
+}
+
+// recipeKeys is the word-key normalization policy of a recipe.
+type recipeKeys struct {
+	Form       string `yaml:"form"`        // nfc, nfd or none
+	UnifyPunct bool   `yaml:"unify_punct"` // typographic apostrophes and hyphens to ASCII
+	Case       string `yaml:"case"`        // preserve, fold or fold-proper
+}
+
+// recipeSource is one entry of recipe.Sources.
+type recipeSource struct {
+	Path         string   `yaml:"path"`
+	Kind         string   `yaml:"kind"`  // "dump", "dictionary", "remove", "blocklist" or empty to sniff
+	Lang         string   `yaml:"lang"`  // overrides recipe.Lang
+	Merge        string   `yaml:"merge"` // append, prepend, no-override, replace
+	Namespaces   []string `yaml:"namespaces"`
+	TitleRegex   string   `yaml:"title_regex"`
+	ExcludeTitle string   `yaml:"exclude_title"`
+	Normalize    string   `yaml:"normalize"` // nfc, nfd or none
+	Patterns     []string `yaml:"patterns"`  // word regexps of a "blocklist" step
+	Weight       float64  `yaml:"weight"`    // ranking weight (default 1)
+}
+
+// recipeOutput is one entry of recipe.Outputs.
+type recipeOutput struct {
+	Path     string `yaml:"path"`     // "-" or empty for stdout
+	Export   string `yaml:"export"`   // text (default), gob, scored, pls, mfa, kaldi or kaldi-prob
+	Compress string `yaml:"compress"` // gzip, zstd, xz; inferred from the extension when empty
+
+	MaxProns         int     `yaml:"max_prons"`          // see --max-prons
+	PruneDistance    int     `yaml:"prune_distance"`     // see --prune-distance
+	PruneLengthRatio float64 `yaml:"prune_length_ratio"` // see --prune-length-ratio
+	Alphabet         string  `yaml:"alphabet"`           // see --export-alphabet
+	PhonesDir        string  `yaml:"phones_dir"`         // see --phones-dir
+}
+
+// loadRecipe reads and decodes a recipe file, rejecting unknown fields.
+func loadRecipe(path string) (*recipe, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var r recipe
+	if err := dec.Decode(&r); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// pipeline converts the recipe into a validated pipeline. baseDir is used to
+// resolve relative paths.
+func (r *recipe) pipeline(baseDir string) (*pipeline, error) {
+	if len(r.Sources) == 0 {
+		return nil, errors.New("recipe has no sources")
+	}
+
+	p := &pipeline{CacheDir: r.CacheDir, Rank: r.Rank}
+	p.Keys = wordkey.Policy{
+		Form:  strings.ToLower(strings.TrimSpace(r.Keys.Form)),
+		Unify: r.Keys.UnifyPunct,
+		Case:  strings.ToLower(strings.TrimSpace(r.Keys.Case)),
+	}
+	if p.Keys.Form == "none" {
+		p.Keys.Form = ""
+	}
+	if err := p.Keys.Validate(); err != nil {
+		return nil, fmt.Errorf("keys: %w", err)
+	}
+	p.Phrases = strings.ToLower(strings.TrimSpace(r.Phrases))
+	if err := validatePhrases(p.Phrases); err != nil {
+		return nil, err
+	}
+	if p.CacheDir == "" {
+		p.CacheDir = remote.DefaultCacheDir()
+	} else {
+		p.CacheDir = resolvePath(baseDir, p.CacheDir)
+	}
+
+	lang := strings.ToLower(strings.TrimSpace(r.Lang))
+	if lang == "" {
+		lang = "fr"
+	}
+
+	for i, rs := range r.Sources {
+		where := fmt.Sprintf("sources[%d]", i)
+		kind := strings.ToLower(strings.TrimSpace(rs.Kind))
+		if kind == "blocklist" {
+			if len(rs.Patterns) == 0 {
+				return nil, fmt.Errorf("%s: blocklist without patterns", where)
+			}
+			b, err := compileBlocklist(rs.Patterns)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", where, err)
+			}
+			p.Sources = append(p.Sources, buildSource{Kind: sourceBlocklist, Blocklist: b})
+			continue
+		}
+		if strings.TrimSpace(rs.Path) == "" {
+			return nil, fmt.Errorf("%s: missing path", where)
+		}
+		if kind == "remove" {
+			p.Sources = append(p.Sources, buildSource{
+				Path: resolvePath(baseDir, strings.TrimSpace(rs.Path)),
+				Kind: sourceRemove,
+			})
+			continue
+		}
+
+		src := buildSource{
+			Path:      resolvePath(baseDir, strings.TrimSpace(rs.Path)),
+			Lang:      lang,
+			Normalize: strings.ToLower(strings.TrimSpace(rs.Normalize)),
+			Weight:    rs.Weight,
+		}
+		if rs.Lang != "" {
+			src.Lang = strings.ToLower(strings.TrimSpace(rs.Lang))
+		}
+		if src.Normalize == "none" {
+			src.Normalize = ""
+		}
+		if err := validateNormalize(src.Normalize); err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+		if src.Weight < 0 {
+			return nil, fmt.Errorf("%s: weight must not be negative", where)
+		}
+
+		switch kind {
+		case "":
+			src.Kind = sourceUnknown
+		case "dump":
+			src.Kind = sourceDump
+		case "dictionary", "dict":
+			src.Kind = sourceDictionary
+		default:
+			return nil, fmt.Errorf("%s: invalid kind %q (must be \"dump\", \"dictionary\", \"remove\" or \"blocklist\")", where, rs.Kind)
+		}
+
+		mode, err := parseMergeMode(rs.Merge)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+		src.MergeMode = mode
+
+		src.Filter.Namespaces = r.Namespaces
+		if len(rs.Namespaces) > 0 {
+			src.Filter.Namespaces = rs.Namespaces
+		}
+		if len(src.Filter.Namespaces) == 0 {
+			src.Filter.Namespaces = []string{"0"}
+		}
+		if rs.TitleRegex != "" {
+			if src.Filter.TitleRegex, err = regexp.Compile(rs.TitleRegex); err != nil {
+				return nil, fmt.Errorf("%s: invalid title_regex: %w", where, err)
+			}
+		}
+		if rs.ExcludeTitle != "" {
+			if src.Filter.ExcludeTitle, err = regexp.Compile(rs.ExcludeTitle); err != nil {
+				return nil, fmt.Errorf("%s: invalid exclude_title: %w", where, err)
+			}
+		}
+
+		p.Sources = append(p.Sources, src)
+	}
+
+	outputs := r.Outputs
+	if len(outputs) == 0 {
+		outputs = []recipeOutput{{Path: "-"}}
+	}
+	written := make(map[string]int, len(outputs)) // path -> output index
+	for i, ro := range outputs {
+		where := fmt.Sprintf("outputs[%d]", i)
+		out := buildOutput{
+			Path:         strings.TrimSpace(ro.Path),
+			ExportFormat: strings.ToLower(strings.TrimSpace(ro.Export)),
+			Compress:     strings.ToLower(strings.TrimSpace(ro.Compress)),
+			Lang:         lang,
+			Alphabet:     alphabet.Canonical(ro.Alphabet),
+			PhonesDir:    strings.TrimSpace(ro.PhonesDir),
+			Prune: pruneOptions{
+				MaxProns:    ro.MaxProns,
+				Distance:    ro.PruneDistance,
+				LengthRatio: ro.PruneLengthRatio,
+			},
+		}
+		if out.ExportFormat == "" {
+			out.ExportFormat = "text"
+		}
+		switch out.ExportFormat {
+		case "text", "gob", "scored", "pls", "mfa", "kaldi", "kaldi-prob":
+		default:
+			return nil, fmt.Errorf("%s: invalid export %q (must be \"text\", \"gob\", \"scored\", \"pls\", \"mfa\", \"kaldi\" or \"kaldi-prob\")", where, ro.Export)
+		}
+		if out.PhonesDir != "" {
+			out.PhonesDir = resolvePath(baseDir, out.PhonesDir)
+		}
+		if out.Path == "" || out.Path == "-" {
+			if len(outputs) > 1 {
+				return nil, fmt.Errorf("%s: stdout can only be the single output of a recipe", where)
+			}
+		} else {
+			out.Path = resolvePath(baseDir, out.Path)
+			if out.Compress == "" {
+				out.Compress = string(compressionForExtension(out.Path))
+			}
+			if j, ok := written[out.Path]; ok {
+				return nil, fmt.Errorf("%s: same path as outputs[%d] (%s)", where, j, out.Path)
+			}
+			written[out.Path] = i
+		}
+		if err := out.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+		p.Outputs = append(p.Outputs, out)
+	}
+
+	return p, nil
+}
+
+// compressionForExtension infers an export compression from a file name.
+func compressionForExtension(path string) compression {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".gz"):
+		return compressionGzip
+	case strings.HasSuffix(lower, ".zst"), strings.HasSuffix(lower, ".zstd"):
+		return compressionZstd
+	case strings.HasSuffix(lower, ".xz"):
+		return compressionXZ
+	}
+	return compressionNone
+}
+
+// resolvePath makes p relative to baseDir unless it is absolute or a URL.
+func resolvePath(baseDir, p string) string {
+	if isHTTPURL(p) || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(baseDir, p)
+}
+
+// runRecipe implements "ipadict build [flags] recipe.yaml".
+func runRecipe(args []string) error {
+	fs := flag.NewFlagSet("ipadict build", flag.ContinueOnError)
+	cacheDir := fs.String("cache-dir", "", "cache directory for dictionaries loaded over HTTP/HTTPS (overrides the recipe)")
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		printUsage(os.Stderr)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printUsage(os.Stdout)
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: ipadict build [--cache-dir DIR] recipe.yaml")
+	}
+
+	path := fs.Arg(0)
+	r, err := loadRecipe(path)
+	if err != nil {
+		return err
+	}
+	p, err := r.pipeline(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("recipe %s: %w", path, err)
+	}
+	if *cacheDir != "" {
+		p.CacheDir = *cacheDir
+	}
+	return p.run()
+}
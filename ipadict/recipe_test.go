@@ -0,0 +1,168 @@
+// File path: tipatools/ipadict/recipe_test.go
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+// writeRecipe writes a recipe file into a new temporary directory and
+// returns its path.
+func writeRecipe(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "recipe.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// recipePipeline loads the recipe and converts it like runRecipe does.
+func recipePipeline(t *testing.T, yaml string) (*pipeline, string, error) {
+	t.Helper()
+	path := writeRecipe(t, yaml)
+	r, err := loadRecipe(path)
+	if err != nil {
+		return nil, "", err
+	}
+	dir := filepath.Dir(path)
+	p, err := r.pipeline(dir)
+	return p, dir, err
+}
+
+func TestLoadRecipeRejectsUnknownFields(t *testing.T) {
+	path := writeRecipe(t, "sources:\n  - path: a.txt\n    merge_mode: append\n")
+	if _, err := loadRecipe(path); err == nil || !strings.Contains(err.Error(), "merge_mode") {
+		t.Errorf("err = %v, want an unknown field error", err)
+	}
+}
+
+func TestRecipePipeline(t *testing.T) {
+	p, dir, err := recipePipeline(t, `
+lang: EN
+namespaces: [main, Appendix]
+cache_dir: cache
+sources:
+  - path: dumps/enwiktionary.xml.bz2
+    kind: dump
+    merge: no-override
+    exclude_title: '[0-9]'
+    normalize: NFC
+  - path: /abs/curated.txt
+    kind: dict
+    lang: fr
+    namespaces: ['0']
+    weight: 2
+  - path: https://example.com/fr.dict.txt
+  - path: remove.txt
+    kind: remove
+  - kind: blocklist
+    patterns: ['[0-9]']
+outputs:
+  - path: out/en.dict.txt.zst
+  - path: out/en.lexicon
+    export: kaldi
+    phones_dir: out/dict
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.CacheDir != filepath.Join(dir, "cache") {
+		t.Errorf("CacheDir = %q", p.CacheDir)
+	}
+	if len(p.Sources) != 5 {
+		t.Fatalf("%d sources, want 5", len(p.Sources))
+	}
+
+	dump := p.Sources[0]
+	if dump.Path != filepath.Join(dir, "dumps/enwiktionary.xml.bz2") || dump.Kind != sourceDump ||
+		dump.Lang != "en" || dump.MergeMode != phono.MergeModeNoOverride || dump.Normalize != "nfc" {
+		t.Errorf("dump source = %+v", dump)
+	}
+	if !reflect.DeepEqual(dump.Filter.Namespaces, []string{"main", "Appendix"}) || dump.Filter.ExcludeTitle == nil {
+		t.Errorf("dump filter = %+v", dump.Filter)
+	}
+
+	dict := p.Sources[1]
+	if dict.Path != "/abs/curated.txt" || dict.Kind != sourceDictionary || dict.Lang != "fr" ||
+		dict.MergeMode != phono.MergeModeAppend || dict.Weight != 2 || !reflect.DeepEqual(dict.Filter.Namespaces, []string{"0"}) {
+		t.Errorf("dictionary source = %+v", dict)
+	}
+	if remote := p.Sources[2]; remote.Path != "https://example.com/fr.dict.txt" || remote.Kind != sourceUnknown {
+		t.Errorf("remote source = %+v", remote)
+	}
+	if rm := p.Sources[3]; rm.Path != filepath.Join(dir, "remove.txt") || rm.Kind != sourceRemove {
+		t.Errorf("remove source = %+v", rm)
+	}
+	if bl := p.Sources[4]; bl.Kind != sourceBlocklist || len(bl.Blocklist) != 1 {
+		t.Errorf("blocklist source = %+v", bl)
+	}
+
+	if len(p.Outputs) != 2 {
+		t.Fatalf("%d outputs, want 2", len(p.Outputs))
+	}
+	if out := p.Outputs[0]; out.Path != filepath.Join(dir, "out/en.dict.txt.zst") || out.ExportFormat != "text" || out.Compress != "zstd" {
+		t.Errorf("first output = %+v", out)
+	}
+	if out := p.Outputs[1]; out.Path != filepath.Join(dir, "out/en.lexicon") || out.ExportFormat != "kaldi" ||
+		out.PhonesDir != filepath.Join(dir, "out/dict") || out.Compress != "" {
+		t.Errorf("second output = %+v", out)
+	}
+}
+
+func TestRecipePipelineDefaults(t *testing.T) {
+	p, _, err := recipePipeline(t, "sources:\n  - path: a.txt\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := p.Sources[0]
+	if src.Lang != "fr" || src.MergeMode != phono.MergeModeAppend || !reflect.DeepEqual(src.Filter.Namespaces, []string{"0"}) {
+		t.Errorf("source = %+v", src)
+	}
+	if len(p.Outputs) != 1 || p.Outputs[0].Path != "-" || p.Outputs[0].ExportFormat != "text" {
+		t.Errorf("outputs = %+v", p.Outputs)
+	}
+}
+
+func TestRecipePipelineErrors(t *testing.T) {
+	tests := []struct {
+		name, yaml, want string
+	}{
+		{"no sources", "lang: fr\n", "no sources"},
+		{"missing path", "sources:\n  - kind: dump\n", "sources[0]: missing path"},
+		{"invalid kind", "sources:\n  - path: a.txt\n    kind: wordlist\n", `invalid kind "wordlist"`},
+		{"blocklist without patterns", "sources:\n  - kind: blocklist\n", "blocklist without patterns"},
+		{"invalid merge", "sources:\n  - path: a.txt\n    merge: overwrite\n", "sources[0]"},
+		{"invalid normalize", "sources:\n  - path: a.txt\n    normalize: nfkc\n", "sources[0]"},
+		{"negative weight", "sources:\n  - path: a.txt\n    weight: -1\n", "weight must not be negative"},
+		{"invalid title regex", "sources:\n  - path: a.txt\n    title_regex: '('\n", "invalid title_regex"},
+		{"invalid export", "sources:\n  - path: a.txt\noutputs:\n  - path: b.txt\n    export: csv\n", `invalid export "csv"`},
+		{
+			"duplicate outputs",
+			"sources:\n  - path: a.txt\noutputs:\n  - path: out/b.txt\n  - path: out/../out/b.txt\n    export: gob\n",
+			"outputs[1]: same path as outputs[0]",
+		},
+		{
+			"stdout among several outputs",
+			"sources:\n  - path: a.txt\noutputs:\n  - path: b.txt\n  - export: gob\n",
+			"outputs[1]: stdout can only be the single output",
+		},
+		{
+			"dash among several outputs",
+			"sources:\n  - path: a.txt\noutputs:\n  - path: '-'\n  - path: b.txt\n",
+			"outputs[0]: stdout can only be the single output",
+		},
+	}
+	for _, tt := range tests {
+		_, _, err := recipePipeline(t, tt.yaml)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
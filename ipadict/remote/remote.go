@@ -0,0 +1,201 @@
+// File path: tipatools/ipadict/remote/remote.go
+
+// Package remote downloads remote dictionaries into a local cache directory
+// shared by ipadict and phonetize.
+//
+// A file is downloaded once and revalidated on later runs with conditional
+// requests (ETag / Last-Modified), so repeated builds only transfer the files
+// that changed. Each cached file has a "<file>.meta" companion recording the
+// URL and the validators returned by the server.
+package remote
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// meta is stored next to each cached file as "<file>.meta".
+type meta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// DefaultCacheDir returns the directory used when --cache-dir is not given.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "tipatools")
+	}
+	return filepath.Join(dir, "tipatools")
+}
+
+// CachePath returns the local file used to cache rawURL in dir. The file keeps
+// the base name of the URL so that name-based format hints still apply.
+func CachePath(dir, rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	base := "dictionary"
+	if u, err := url.Parse(rawURL); err == nil {
+		if b := path.Base(u.Path); b != "" && b != "." && b != "/" {
+			base = b
+		}
+	}
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+"-"+base)
+}
+
+// Fetch makes sure rawURL is available in cacheDir and returns the path of
+// the local copy.
+//
+// A cached copy is revalidated with If-None-Match / If-Modified-Since and
+// reused on 304 Not Modified. When the server cannot be reached, an existing
+// copy is used and a warning is printed on stderr.
+func Fetch(client *http.Client, rawURL, cacheDir string) (string, error) {
+	local, _, err := FetchOrStream(client, rawURL, cacheDir, nil)
+	return local, err
+}
+
+// FetchOrStream is Fetch for content that may not be worth caching. When
+// rawURL has to be downloaded and sniff is not nil, sniff reads the start of
+// the content and reports whether to cache it. When it does not, nothing is
+// cached: the content is returned as a stream instead, from its first byte,
+// and the caller closes it. Otherwise the path of the local copy is returned,
+// as by Fetch.
+func FetchOrStream(client *http.Client, rawURL, cacheDir string, sniff func(r io.Reader) (bool, error)) (string, io.ReadCloser, error) {
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return "", nil, fmt.Errorf("cache dir: %w", err)
+	}
+	local := CachePath(cacheDir, rawURL)
+	metaPath := local + ".meta"
+
+	var m meta
+	cached := false
+	if data, err := os.ReadFile(metaPath); err == nil && json.Unmarshal(data, &m) == nil && m.URL == rawURL {
+		if _, err := os.Stat(local); err == nil {
+			cached = true
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	if cached {
+		if m.ETag != "" {
+			req.Header.Set("If-None-Match", m.ETag)
+		}
+		if m.LastModified != "" {
+			req.Header.Set("If-Modified-Since", m.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if cached {
+			fmt.Fprintf(os.Stderr, "Warning: %v; using cached copy of %s\n", err, rawURL)
+			return local, nil, nil
+		}
+		return "", nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		resp.Body.Close()
+		if cached {
+			return local, nil, nil
+		}
+		return "", nil, fmt.Errorf("GET %s: unexpected %s without a cached copy", rawURL, resp.Status)
+	case http.StatusOK:
+	default:
+		resp.Body.Close()
+		return "", nil, fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+
+	// The bytes read by sniff are kept, to be written to the cache or
+	// replayed in front of the stream.
+	var head bytes.Buffer
+	if sniff != nil {
+		keep, err := sniff(io.TeeReader(resp.Body, &head))
+		if err != nil {
+			resp.Body.Close()
+			return "", nil, fmt.Errorf("GET %s: %w", rawURL, err)
+		}
+		if !keep {
+			return "", streamCloser{Reader: io.MultiReader(&head, resp.Body), Closer: resp.Body}, nil
+		}
+	}
+	defer resp.Body.Close()
+
+	tmp, err := os.CreateTemp(cacheDir, ".download-*")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, io.MultiReader(&head, resp.Body)); err != nil {
+		tmp.Close()
+		return "", nil, fmt.Errorf("GET %s: %w", rawURL, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", nil, err
+	}
+
+	m = meta{
+		URL:          rawURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if err := install(tmp.Name(), local, m); err != nil {
+		return "", nil, err
+	}
+	return local, nil, nil
+}
+
+// install moves the downloaded file tmp to local, together with its meta.
+//
+// Both files are replaced by renames, so a reader never sees them half
+// written. The new meta is written before the file is moved, and the old one
+// is removed first: if the process dies in between, the cached copy has no
+// meta and is downloaded again, instead of being revalidated with the
+// validators of another version.
+func install(tmp, local string, m meta) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	metaTmp, err := os.CreateTemp(filepath.Dir(local), ".meta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(metaTmp.Name())
+	if _, err := metaTmp.Write(data); err != nil {
+		metaTmp.Close()
+		return err
+	}
+	if err := metaTmp.Close(); err != nil {
+		return err
+	}
+
+	metaPath := local + ".meta"
+	if err := os.Remove(metaPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(tmp, local); err != nil {
+		return err
+	}
+	return os.Rename(metaTmp.Name(), metaPath)
+}
+
+// streamCloser is a stream replayed from several readers, closed by the
+// closer of the last one.
+type streamCloser struct {
+	io.Reader
+	io.Closer
+}
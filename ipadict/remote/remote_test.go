@@ -0,0 +1,204 @@
+// File path: tipatools/ipadict/remote/remote_test.go
+
+package remote
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// server serves body with an ETag and a Last-Modified date, answers
+// conditional requests with 304, and counts the requests by status.
+type server struct {
+	body, etag string
+	statuses   map[int]int
+}
+
+const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	switch {
+	case r.URL.Path == "/missing":
+		status = http.StatusNotFound
+	case r.Header.Get("If-None-Match") == s.etag:
+		status = http.StatusNotModified
+	}
+	s.statuses[status]++
+	w.Header().Set("ETag", s.etag)
+	w.Header().Set("Last-Modified", lastModified)
+	w.WriteHeader(status)
+	if status == http.StatusOK {
+		io.WriteString(w, s.body)
+	}
+}
+
+func newServer(t *testing.T) (*server, *httptest.Server) {
+	s := &server{body: "chat\tʃa\n", etag: `"v1"`, statuses: map[int]int{}}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFetch(t *testing.T) {
+	s, srv := newServer(t)
+	dir := t.TempDir()
+	rawURL := srv.URL + "/fr.txt"
+
+	// 200: downloaded, with its meta.
+	local, err := Fetch(srv.Client(), rawURL, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local != CachePath(dir, rawURL) || !strings.HasSuffix(local, "-fr.txt") {
+		t.Errorf("local = %q", local)
+	}
+	if got := readFile(t, local); got != s.body {
+		t.Errorf("cached copy = %q", got)
+	}
+	var m meta
+	if err := json.Unmarshal([]byte(readFile(t, local+".meta")), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m != (meta{URL: rawURL, ETag: `"v1"`, LastModified: lastModified}) {
+		t.Errorf("meta = %+v", m)
+	}
+
+	// 304: revalidated with the ETag and reused.
+	if _, err := Fetch(srv.Client(), rawURL, dir); err != nil {
+		t.Fatal(err)
+	}
+	if s.statuses[http.StatusOK] != 1 || s.statuses[http.StatusNotModified] != 1 {
+		t.Errorf("statuses = %v", s.statuses)
+	}
+
+	// A new ETag: downloaded again.
+	s.body, s.etag = "chat\tʃa\nchien\tʃjɛ̃\n", `"v2"`
+	if _, err := Fetch(srv.Client(), rawURL, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, local); got != s.body {
+		t.Errorf("cached copy = %q, want the new version", got)
+	}
+	if s.statuses[http.StatusOK] != 2 {
+		t.Errorf("statuses = %v", s.statuses)
+	}
+
+	// No temporary file is left behind.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("cache dir has %d entries, want the file and its meta", len(entries))
+	}
+}
+
+func TestFetchOffline(t *testing.T) {
+	_, srv := newServer(t)
+	dir := t.TempDir()
+	rawURL := srv.URL + "/fr.txt"
+	local, err := Fetch(srv.Client(), rawURL, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	// The server is gone: the cached copy is used.
+	got, err := Fetch(srv.Client(), rawURL, dir)
+	if err != nil || got != local {
+		t.Errorf("Fetch = %q, %v; want %q", got, err, local)
+	}
+	// Nothing was ever cached for this one.
+	if _, err := Fetch(srv.Client(), srv.URL+"/other.txt", dir); err == nil {
+		t.Error("Fetch of an uncached URL succeeded offline")
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	_, srv := newServer(t)
+	dir := t.TempDir()
+	if _, err := Fetch(srv.Client(), srv.URL+"/missing", dir); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("err = %v, want a 404", err)
+	}
+
+	// A 304 without a cached copy is an error.
+	rawURL := srv.URL + "/fr.txt"
+	if _, err := Fetch(srv.Client(), rawURL, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(CachePath(dir, rawURL)); err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: roundTripper(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusNotModified, Status: "304 Not Modified", Body: http.NoBody, Request: r}, nil
+	})}
+	if _, err := Fetch(client, rawURL, dir); err == nil {
+		t.Error("304 without a cached copy succeeded")
+	}
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestFetchOrStream(t *testing.T) {
+	s, srv := newServer(t)
+	s.body = strings.Repeat("<mediawiki/>\n", 10000)
+	dir := t.TempDir()
+	rawURL := srv.URL + "/dump.xml"
+
+	sniff := func(r io.Reader) (bool, error) {
+		head := make([]byte, 10)
+		n, err := io.ReadFull(r, head)
+		if err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		return string(head[:n]) != "<mediawiki", err
+	}
+	local, stream, err := FetchOrStream(srv.Client(), rawURL, dir, sniff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local != "" || stream == nil {
+		t.Fatalf("local = %q, stream = %v", local, stream)
+	}
+	data, err := io.ReadAll(stream)
+	stream.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != s.body {
+		t.Errorf("stream has %d bytes, want %d", len(data), len(s.body))
+	}
+	if _, err := os.Stat(CachePath(dir, rawURL)); !os.IsNotExist(err) {
+		t.Errorf("streamed content cached: %v", err)
+	}
+
+	// Kept content is cached, including the sniffed bytes.
+	s.body = "chat\tʃa\n"
+	local, stream, err = FetchOrStream(srv.Client(), rawURL, dir, sniff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stream != nil {
+		t.Fatal("kept content streamed")
+	}
+	if got := readFile(t, local); got != s.body {
+		t.Errorf("cached copy = %q", got)
+	}
+}
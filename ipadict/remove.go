@@ -0,0 +1,168 @@
+// File path: tipatools/ipadict/remove.go
+
+package main
+
+// Negative sources: removal lists and regex blocklists.
+//
+// A removal list deletes whole words or specific word/pronunciation pairs
+// from the dictionary being built; a blocklist deletes every word matching a
+// regular expression. Both are pipeline steps, applied at their position in
+// the source order, so later sources may still add entries back.
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+// removalList is the content of a --remove file.
+//
+// Format, one entry per line (blank lines and lines starting with '#' are
+// ignored):
+//
+//	<word>                         remove the word and all its pronunciations
+//	<word>\t<IPA1> | <IPA2> | ...  remove only these pronunciations
+//
+// Slashed pronunciations (/IPA/) are accepted too.
+type removalList struct {
+	Words map[string]bool            // words removed entirely
+	Pairs map[string]map[string]bool // word -> pronunciations to remove
+}
+
+// removalStats counts what a removal step deleted.
+type removalStats struct {
+	Words int // words that no longer have any pronunciation
+	Pairs int // word/pronunciation pairs deleted
+}
+
+// add accumulates the counts of another step.
+func (s *removalStats) add(o removalStats) {
+	s.Words += o.Words
+	s.Pairs += o.Pairs
+}
+
+// loadRemovalList reads a removal list from a local path or URL, plain or
+// compressed.
+func loadRemovalList(src string) (*removalList, error) {
+	rc, err := openSource(src)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	list := &removalList{
+		Words: make(map[string]bool),
+		Pairs: make(map[string]map[string]bool),
+	}
+	sc := bufio.NewScanner(rc)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		word, rest, hasProns := strings.Cut(line, "\t")
+		word = strings.TrimSpace(word)
+		if !hasProns || strings.TrimSpace(rest) == "" {
+			list.Words[word] = true
+			continue
+		}
+		for _, pron := range splitPronunciations(rest) {
+			if list.Pairs[word] == nil {
+				list.Pairs[word] = make(map[string]bool)
+			}
+			list.Pairs[word][pron] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// splitPronunciations splits "IPA1 | IPA2" or "/IPA1/ /IPA2/" into values.
+func splitPronunciations(s string) []string {
+	s = strings.TrimSpace(s)
+	var prons []string
+	if strings.HasPrefix(s, "/") {
+		for _, p := range strings.Split(s, "/") {
+			if p = strings.TrimSpace(strings.Trim(p, ",")); p != "" {
+				prons = append(prons, p)
+			}
+		}
+		return prons
+	}
+	for _, p := range strings.Split(s, "|") {
+		if p = strings.TrimSpace(p); p != "" {
+			prons = append(prons, p)
+		}
+	}
+	return prons
+}
+
+// keep reports whether the pair (word, pron) survives the list.
+func (l *removalList) keep(word, pron string) bool {
+	if l.Words[word] {
+		return false
+	}
+	return !l.Pairs[word][pron]
+}
+
+// blocklist removes every word matching one of its patterns.
+type blocklist []*regexp.Regexp
+
+// keep reports whether word survives the blocklist.
+func (b blocklist) keep(word, _ string) bool {
+	for _, re := range b {
+		if re.MatchString(word) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterRepresentation removes from rep the pairs for which keep returns
+// false, preserving the order of the remaining pronunciations. The removed
+// pairs are dropped from rep.SeenWordPron too, so that later sources are
+// merged against the filtered entries: a kept pair is not listed twice,
+// and a removed one may be added back.
+func filterRepresentation(rep *phono.Representation, keep func(word, pron string) bool) removalStats {
+	var stats removalStats
+	for word, prons := range rep.Entries {
+		survivors := make([]string, 0, len(prons))
+		for _, pron := range prons {
+			if keep(word, pron) {
+				survivors = append(survivors, pron)
+				continue
+			}
+			stats.Pairs++
+			delete(rep.SeenWordPron, pairKey(word, pron))
+		}
+		switch {
+		case len(survivors) == 0:
+			if len(prons) > 0 {
+				stats.Words++
+			}
+			delete(rep.Entries, word)
+		case len(survivors) < len(prons):
+			rep.Entries[word] = survivors
+		}
+	}
+	return stats
+}
+
+// compileBlocklist compiles --block-regex / recipe patterns.
+func compileBlocklist(patterns []string) (blocklist, error) {
+	var b blocklist
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block pattern %q: %w", p, err)
+		}
+		b = append(b, re)
+	}
+	return b, nil
+}
@@ -0,0 +1,106 @@
+// File path: tipatools/ipadict/remove_test.go
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+func TestLoadRemovalList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "remove.txt")
+	data := "# comment\n\nchat\nchien\tʃjɛ̃ | ʃjɛn\r\nsuis\t/sɥi/ /swi/\nvide\t  \n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	list, err := loadRemovalList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &removalList{
+		Words: map[string]bool{"chat": true, "vide": true},
+		Pairs: map[string]map[string]bool{
+			"chien": {"ʃjɛ̃": true, "ʃjɛn": true},
+			"suis":  {"sɥi": true, "swi": true},
+		},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("list = %+v, want %+v", list, want)
+	}
+}
+
+func TestFilterRepresentation(t *testing.T) {
+	rep := phono.NewRepresentation()
+	mergeEntries(rep, phono.MergeModeAppend, map[string][]string{
+		"chat":  {"ʃa"},
+		"chien": {"ʃjɛ̃", "ʃjɛn", "ʃɛ̃"},
+		"xx1":   {"iks"},
+	})
+
+	list := &removalList{
+		Words: map[string]bool{"chat": true},
+		Pairs: map[string]map[string]bool{"chien": {"ʃjɛn": true}},
+	}
+	stats := filterRepresentation(rep, list.keep)
+	if stats != (removalStats{Words: 1, Pairs: 2}) {
+		t.Errorf("stats = %+v", stats)
+	}
+	want := map[string][]string{"chien": {"ʃjɛ̃", "ʃɛ̃"}, "xx1": {"iks"}}
+	if !reflect.DeepEqual(map[string][]string(rep.Entries), want) {
+		t.Errorf("entries = %v, want %v", rep.Entries, want)
+	}
+	if len(rep.SeenWordPron) != countPairs(rep.Entries) {
+		t.Errorf("%d seen pairs for %d entries", len(rep.SeenWordPron), countPairs(rep.Entries))
+	}
+
+	stats = filterRepresentation(rep, blocklist{regexp.MustCompile(`\d`)}.keep)
+	if stats != (removalStats{Words: 1, Pairs: 1}) || len(rep.Entries) != 1 {
+		t.Errorf("blocklist: stats = %+v, entries = %v", stats, rep.Entries)
+	}
+
+	if stats := filterRepresentation(rep, list.keep); stats != (removalStats{}) {
+		t.Errorf("no-op filter: stats = %+v", stats)
+	}
+}
+
+func TestFilterThenLoad(t *testing.T) {
+	// A source loaded after a removal is merged against the filtered
+	// entries: kept pairs are not listed twice, removed ones come back.
+	path := filepath.Join(t.TempDir(), "next.txt")
+	if err := os.WriteFile(path, []byte("chien\tʃjɛ̃ | ʃjɛn\nchat\tʃa\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		mode phono.MergeMode
+		want map[string][]string
+	}{
+		{phono.MergeModeAppend, map[string][]string{"chien": {"ʃjɛ̃", "ʃjɛn"}, "chat": {"ʃa"}}},
+		{phono.MergeModeNoOverride, map[string][]string{"chien": {"ʃjɛ̃"}, "chat": {"ʃa"}}},
+	}
+	for _, tt := range tests {
+		rep := phono.NewRepresentation()
+		mergeEntries(rep, phono.MergeModeAppend, map[string][]string{
+			"chat":  {"ʃa"},
+			"chien": {"ʃjɛ̃", "ʃjɛn"},
+		})
+		list := &removalList{
+			Words: map[string]bool{"chat": true},
+			Pairs: map[string]map[string]bool{"chien": {"ʃjɛn": true}},
+		}
+		filterRepresentation(rep, list.keep)
+		if err := loadDictionaries(rep, tt.mode, "", path); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(map[string][]string(rep.Entries), tt.want) {
+			t.Errorf("mode %v: entries = %v, want %v", tt.mode, rep.Entries, tt.want)
+		}
+		if len(rep.SeenWordPron) != countPairs(rep.Entries) {
+			t.Errorf("mode %v: %d seen pairs for %d entries", tt.mode, len(rep.SeenWordPron), countPairs(rep.Entries))
+		}
+	}
+}
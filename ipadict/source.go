@@ -0,0 +1,497 @@
+// File path: tipatools/ipadict/source.go
+
+package main
+
+// Source opening, classification, compression sniffing and compressed
+// exports.
+//
+// Dumps and dictionaries may be stored plain or compressed with bzip2, gzip,
+// zstd or xz. The compression is detected from the magic bytes at the start
+// of the stream, and the kind of source (dump or dictionary) from the
+// decompressed content, so file names do not need particular extensions.
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/temporal-IPA/tipa/pkg/phono"
+	"github.com/ulikunitz/xz"
+
+	"ipadict/remote"
+)
+
+// compression identifies a stream compression format.
+type compression string
+
+const (
+	compressionNone  compression = ""
+	compressionBzip2 compression = "bzip2"
+	compressionGzip  compression = "gzip"
+	compressionZstd  compression = "zstd"
+	compressionXZ    compression = "xz"
+)
+
+// compressionMagics maps each format to the magic bytes opening its streams.
+var compressionMagics = []struct {
+	kind  compression
+	magic []byte
+}{
+	{compressionGzip, []byte{0x1f, 0x8b}},
+	{compressionBzip2, []byte("BZh")},
+	{compressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{compressionXZ, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
+
+// compressionExtensions lists the file suffixes stripped from compressed
+// dictionary names so that the preloaders can still sniff the inner format
+// from the name.
+var compressionExtensions = []string{".bz2", ".gz", ".zst", ".zstd", ".xz"}
+
+// sniffCompression returns the compression format of a stream from its first
+// bytes.
+func sniffCompression(head []byte) compression {
+	for _, m := range compressionMagics {
+		if bytes.HasPrefix(head, m.magic) {
+			return m.kind
+		}
+	}
+	return compressionNone
+}
+
+// decompressReader wraps r with the decompressor matching its magic bytes.
+// Uncompressed streams are returned unchanged (but buffered). Closing the
+// returned reader releases the decompressor; it does not close r.
+func decompressReader(r io.Reader) (io.ReadCloser, compression, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(6)
+
+	kind := sniffCompression(head)
+	switch kind {
+	case compressionBzip2:
+		return io.NopCloser(bzip2.NewReader(br)), kind, nil
+	case compressionGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, kind, err
+		}
+		return zr, kind, nil
+	case compressionZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, kind, err
+		}
+		// The decoder runs goroutines until it is closed.
+		return zr.IOReadCloser(), kind, nil
+	case compressionXZ:
+		zr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, kind, err
+		}
+		return io.NopCloser(zr), kind, nil
+	}
+	return io.NopCloser(br), kind, nil
+}
+
+// openSource opens a local path or an HTTP/HTTPS URL and transparently
+// decompresses it.
+func openSource(src string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	if isHTTPURL(src) {
+		resp, err := http.Get(src)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("GET %s: %s", src, resp.Status)
+		}
+		rc = resp.Body
+	} else {
+		f, err := os.Open(src)
+		if err != nil {
+			return nil, err
+		}
+		rc = f
+	}
+	return openStream(src, rc)
+}
+
+// openStream transparently decompresses the stream rc opened from src.
+// Closing the result closes rc.
+func openStream(src string, rc io.ReadCloser) (io.ReadCloser, error) {
+	r, _, err := decompressReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("decompress %s: %w", src, err)
+	}
+	return readCloser{ReadCloser: r, src: rc}, nil
+}
+
+// readCloser pairs a decompressing reader with the underlying stream. Close
+// releases both.
+type readCloser struct {
+	io.ReadCloser
+	src io.Closer
+}
+
+func (rc readCloser) Close() error {
+	err := rc.ReadCloser.Close()
+	if serr := rc.src.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// sourceKind tells how a --parse source is processed.
+type sourceKind int
+
+const (
+	sourceUnknown    sourceKind = iota // not decided yet: sniff the content
+	sourceDump                         // Wiktionary / Wikipedia XML dump
+	sourceDictionary                   // dictionary handled by the phono preloaders
+	sourceRemove                       // removal list (--remove)
+	sourceBlocklist                    // word regex blocklist (--block-regex)
+)
+
+// sniffLen is the number of decompressed bytes inspected by classifySource.
+const sniffLen = 4096
+
+// sourceSpec is a --parse / --preload value split into its optional
+// prefixes and the path or URL.
+type sourceSpec struct {
+	Kind    sourceKind      // from a "dump:" / "dict:" prefix, or sourceUnknown
+	Mode    phono.MergeMode // from a merge mode prefix, when HasMode is set
+	HasMode bool
+	Path    string
+}
+
+// sourceKindPrefixes and mergeModePrefixes are the prefixes accepted by
+// parseSourceSpec, in any order ("replace:dict:https://...").
+var (
+	sourceKindPrefixes = map[string]sourceKind{
+		"dump": sourceDump,
+		"dict": sourceDictionary,
+	}
+	mergeModePrefixes = map[string]phono.MergeMode{
+		"append":      phono.MergeModeAppend,
+		"prepend":     phono.MergeModePrepend,
+		"no-override": phono.MergeModeNoOverride,
+		"replace":     phono.MergeModeReplace,
+	}
+)
+
+// parseSourceSpec strips the optional kind ("dump:", "dict:") and merge mode
+// ("append:", "prepend:", "no-override:", "replace:") prefixes from src.
+// Prefixes are case-sensitive, so that a Windows drive letter or a URL
+// scheme ends them.
+func parseSourceSpec(src string) (sourceSpec, error) {
+	spec := sourceSpec{Path: strings.TrimSpace(src)}
+	for {
+		prefix, rest, ok := strings.Cut(spec.Path, ":")
+		if !ok {
+			if spec.Path == "" {
+				return spec, fmt.Errorf("%q: missing path", src)
+			}
+			return spec, nil
+		}
+		if kind, ok := sourceKindPrefixes[prefix]; ok {
+			if spec.Kind != sourceUnknown {
+				return spec, fmt.Errorf("%q: more than one source kind prefix", src)
+			}
+			spec.Kind = kind
+			spec.Path = rest
+			continue
+		}
+		if mode, ok := mergeModePrefixes[prefix]; ok {
+			if spec.HasMode {
+				return spec, fmt.Errorf("%q: more than one merge mode prefix", src)
+			}
+			spec.Mode = mode
+			spec.HasMode = true
+			spec.Path = rest
+			continue
+		}
+		return spec, nil
+	}
+}
+
+// classifySource decides whether src is a dump or a dictionary by looking at
+// its first decompressed bytes, and returns where to read it from, so that
+// remote sources are fetched only once. Local sources are read from their
+// path. Remote dictionaries are downloaded into cacheDir while they are
+// sniffed (see remote.FetchOrStream), and path is their cached copy. Remote dumps
+// are not cached: stream goes on with the download from its first byte, and
+// the caller closes it.
+func classifySource(src, cacheDir string) (kind sourceKind, path string, stream io.ReadCloser, err error) {
+	if !isHTTPURL(src) {
+		kind, err := sniffFile(src)
+		return kind, src, nil, err
+	}
+	local, stream, err := remote.FetchOrStream(http.DefaultClient, src, cacheDir, func(r io.Reader) (bool, error) {
+		var err error
+		kind, err = sniffStream(r)
+		return kind != sourceDump, err
+	})
+	if err != nil {
+		return sourceUnknown, "", nil, err
+	}
+	if stream != nil {
+		return kind, src, stream, nil
+	}
+	if kind == sourceUnknown {
+		// The cached copy was still valid, so nothing was downloaded.
+		kind, err = sniffFile(local)
+	}
+	return kind, local, nil, err
+}
+
+// sniffFile classifies the local source at path.
+func sniffFile(path string) (sourceKind, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return sourceUnknown, err
+	}
+	defer f.Close()
+	return sniffStream(f)
+}
+
+// sniffStream classifies a source from its first sniffLen decompressed bytes,
+// read from r.
+func sniffStream(r io.Reader) (sourceKind, error) {
+	dr, _, err := decompressReader(r)
+	if err != nil {
+		return sourceUnknown, err
+	}
+	defer dr.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(dr, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return sourceUnknown, err
+	}
+	return sniffSourceKind(head[:n])
+}
+
+// sniffSourceKind classifies a source from its first decompressed bytes:
+//
+//   - a gob stream (see writeGobDictionary) is a dictionary,
+//   - an XML document with a <mediawiki> root is a dump,
+//   - any other XML document is rejected,
+//   - text with tab-separated lines and everything else are left to the
+//     dictionary preloaders.
+func sniffSourceKind(head []byte) (sourceKind, error) {
+	if isGobStream(head) {
+		return sourceDictionary, nil
+	}
+	text := bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	text = bytes.TrimLeft(text, " \t\r\n")
+	if bytes.HasPrefix(text, []byte("<")) {
+		if bytes.Contains(text, []byte("<mediawiki")) {
+			return sourceDump, nil
+		}
+		if bytes.HasPrefix(text, []byte("<?xml")) {
+			return sourceUnknown, errors.New("XML document without a <mediawiki> root")
+		}
+	}
+	return sourceDictionary, nil
+}
+
+// isGobStream reports whether head starts like an encoding/gob stream: a
+// message length followed by the definition of a user type, sent with the
+// negated type id (user ids start at 65, encoded as 0xff 0x81).
+func isGobStream(head []byte) bool {
+	n, size := gobUint(head)
+	if size == 0 || n == 0 || n > 1<<20 {
+		return false
+	}
+	id, size := gobUint(head[size:])
+	return size > 0 && id&1 == 1 && id>>1 >= 64
+}
+
+// gobUint decodes an unsigned integer in the encoding/gob format from the
+// start of b, and returns it with its size in bytes, or a size of 0 when b
+// does not start with one.
+func gobUint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	if b[0] < 0x80 {
+		return uint64(b[0]), 1
+	}
+	count := int(-int8(b[0]))
+	if count > 8 || len(b) < count+1 {
+		return 0, 0
+	}
+	var x uint64
+	for _, c := range b[1 : count+1] {
+		x = x<<8 | uint64(c)
+	}
+	return x, count + 1
+}
+
+// loadDictionaries merges the dictionaries at paths into rep, in order.
+//
+// Plain dictionaries are handed to phono.LoadInto as-is. Compressed ones are
+// decompressed into a temporary file named without the compression
+// suffix ("fr.dict.txt.gz" is loaded as "fr.dict.txt"). HTTP/HTTPS URLs are
+// first downloaded into cacheDir (see remote.Fetch). Curation stubs,
+// recognized by their first line (curationStubHeader), are loaded without
+// their comments and unfilled entries.
+func loadDictionaries(rep *phono.Representation, mode phono.MergeMode, cacheDir string, paths ...string) error {
+	for _, p := range paths {
+		if err := loadDictionary(rep, mode, cacheDir, p); err != nil {
+			return fmt.Errorf("load %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// loadDictionary merges a single, possibly compressed or remote, dictionary
+// into rep.
+func loadDictionary(rep *phono.Representation, mode phono.MergeMode, cacheDir, p string) error {
+	if isHTTPURL(p) {
+		local, err := remote.Fetch(http.DefaultClient, p, cacheDir)
+		if err != nil {
+			return err
+		}
+		p = local
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, kind, err := decompressReader(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	br := bufio.NewReader(r)
+	if isCurationStub(br) {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return err
+		}
+		return loadDictionaryData(rep, mode, p, bytes.NewReader(stripCurationLines(data)))
+	}
+	if kind == compressionNone {
+		return phono.LoadInto(os.DirFS("/"), rep, mode, p)
+	}
+	return loadDictionaryData(rep, mode, p, br)
+}
+
+// curationStubHeader is the first line of the curation stubs written by
+// phonetize coverage --harvest-oov (stubHeader in phonetize/harvest.go).
+const curationStubHeader = "# ipadict curation stub"
+
+// isCurationStub reports whether the dictionary read from br starts with
+// curationStubHeader, after an optional byte order mark.
+func isCurationStub(br *bufio.Reader) bool {
+	head, _ := br.Peek(3 + len(curationStubHeader))
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	return bytes.HasPrefix(head, []byte(curationStubHeader))
+}
+
+// stripCurationLines removes the comment lines ("# ...") and the entries
+// without pronunciation ("word<TAB>") of a curation stub, so that it can be
+// loaded before every word is filled in.
+func stripCurationLines(data []byte) []byte {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		content := bytes.TrimRight(line, "\r\n")
+		content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+		word, pron, found := bytes.Cut(content, []byte("\t"))
+		if bytes.HasPrefix(content, []byte("#")) || (found && len(bytes.TrimSpace(word)) > 0 && len(bytes.TrimSpace(pron)) == 0) {
+			continue
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
+
+// loadDictionaryData merges the dictionary read from r into rep. It is
+// copied to a temporary file named after src without compression suffix, so
+// that name-based format hints of the preloaders still apply.
+func loadDictionaryData(rep *phono.Representation, mode phono.MergeMode, src string, r io.Reader) error {
+	name := path.Base(src)
+	for _, ext := range compressionExtensions {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			name = name[:len(name)-len(ext)]
+			break
+		}
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "dictionary"
+	}
+
+	dir, err := os.MkdirTemp("", "ipadict-dict-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return phono.LoadInto(os.DirFS(dir), rep, mode, name)
+}
+
+// validateCompress checks a --compress / recipe compress value.
+func validateCompress(format string) error {
+	switch compression(format) {
+	case compressionNone, compressionGzip, compressionZstd, compressionXZ:
+		return nil
+	}
+	return fmt.Errorf("invalid --compress value %q (must be \"gzip\", \"zstd\" or \"xz\")", format)
+}
+
+// compressWriter wraps w with a compressor for the --compress format.
+// The returned closer must be called to flush the compressed stream; it does
+// not close w.
+func compressWriter(w io.Writer, format string) (io.Writer, io.Closer, error) {
+	switch compression(format) {
+	case compressionNone:
+		return w, nopCloser{}, nil
+	case compressionGzip:
+		zw := gzip.NewWriter(w)
+		return zw, zw, nil
+	case compressionZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zw, zw, nil
+	case compressionXZ:
+		zw, err := xz.NewWriter(w)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zw, zw, nil
+	}
+	return nil, nil, validateCompress(format)
+}
+
+// nopCloser is the closer returned for uncompressed exports.
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
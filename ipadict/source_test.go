@@ -0,0 +1,366 @@
+// File path: tipatools/ipadict/source_test.go
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+
+	"ipadict/remote"
+)
+
+// bzip2Dict is "chat\tʃa\n" compressed with bzip2, for which the standard
+// library has no writer.
+const bzip2Dict = "425a68393141592653593a1f80fb00000241c4003028400400080000102000310c08203348f818a4f1772453850903a1f80fb0"
+
+func TestSniffCompression(t *testing.T) {
+	tests := []struct {
+		head []byte
+		want compression
+	}{
+		{[]byte{0x1f, 0x8b, 0x08}, compressionGzip},
+		{[]byte("BZh91AY"), compressionBzip2},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, compressionZstd},
+		{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, compressionXZ},
+		{[]byte{0xfd, '7', 'z'}, compressionNone},
+		{[]byte("chat\tʃa\n"), compressionNone},
+		{[]byte("<mediawiki>"), compressionNone},
+		{nil, compressionNone},
+	}
+	for _, tt := range tests {
+		if got := sniffCompression(tt.head); got != tt.want {
+			t.Errorf("sniffCompression(%q) = %q, want %q", tt.head, got, tt.want)
+		}
+	}
+}
+
+// compressed returns data compressed with format.
+func compressed(t *testing.T, format string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, closer, err := compressWriter(&buf, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressRoundTrip(t *testing.T) {
+	data := []byte("chat\tʃa\n")
+	bz, err := hex.DecodeString(bzip2Dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streams := map[compression][]byte{
+		compressionNone:  data,
+		compressionBzip2: bz,
+	}
+	for _, format := range []compression{compressionGzip, compressionZstd, compressionXZ} {
+		streams[format] = compressed(t, string(format), data)
+	}
+	for format, stream := range streams {
+		r, kind, err := decompressReader(bytes.NewReader(stream))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%s: close: %v", format, err)
+		}
+		if kind != format || !bytes.Equal(got, data) {
+			t.Errorf("%s: decompressed %q as %q, want %q", format, got, kind, data)
+		}
+	}
+}
+
+func TestLoadCompressedDictionaries(t *testing.T) {
+	dir := t.TempDir()
+	// The names carry no compression hint: the format is sniffed.
+	files := map[string][]byte{
+		"a.txt": compressed(t, "gzip", []byte("chat\tʃa\n")),
+		"b.txt": compressed(t, "zstd", []byte("chien\tʃjɛ̃\n")),
+		"c.txt": compressed(t, "xz", []byte("chat\tʃɑ\n")),
+	}
+	var paths []string
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	rep := phono.NewRepresentation()
+	if err := loadDictionaries(rep, phono.MergeModeAppend, dir, paths...); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Entries["chat"]) != 2 || len(rep.Entries["chien"]) != 1 {
+		t.Errorf("entries = %v", rep.Entries)
+	}
+}
+
+func TestOpenSourceCloses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "d.zst")
+	if err := os.WriteFile(path, compressed(t, "zstd", []byte("<mediawiki/>")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := openSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(rc); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Both the decoder and the file are closed.
+	src := rc.(readCloser)
+	if _, err := src.Read(make([]byte, 1)); err == nil {
+		t.Error("decoder still readable after Close")
+	}
+	if err := src.src.(*os.File).Close(); err == nil {
+		t.Error("file still open after Close")
+	}
+}
+
+func TestSniffSourceKind(t *testing.T) {
+	var gob bytes.Buffer
+	if err := writeGobDictionary(&gob, map[string][]string{"chat": {"ʃa"}}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		head    []byte
+		want    sourceKind
+		wantErr bool
+	}{
+		{"dump", []byte("<mediawiki xmlns=\"http://www.mediawiki.org/xml/export-0.11/\">"), sourceDump, false},
+		{"dump with declaration", []byte("<?xml version=\"1.0\"?>\n<mediawiki>"), sourceDump, false},
+		{"dump with BOM", []byte("\xef\xbb\xbf\n  <mediawiki>"), sourceDump, false},
+		{"other XML", []byte("<?xml version=\"1.0\"?>\n<lexicon>"), sourceUnknown, true},
+		{"gob", gob.Bytes(), sourceDictionary, false},
+		{"text", []byte("chat\tʃa\nchien\tʃjɛ̃\n"), sourceDictionary, false},
+		{"text with angle bracket", []byte("<3\tlʌv\n"), sourceDictionary, false},
+		{"empty", nil, sourceDictionary, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sniffSourceKind(tt.head)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("kind = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSourceSpec(t *testing.T) {
+	const cliMode = phono.MergeModePrepend // run-wide mode of the merge flags
+	tests := []struct {
+		src      string
+		kind     sourceKind
+		path     string
+		mode     phono.MergeMode // after buildConfig.sourceMergeMode
+		errMatch string          // substring of the expected error, if any
+	}{
+		{"fr.dict.txt", sourceUnknown, "fr.dict.txt", cliMode, ""},
+		{"  dump:fr.xml.bz2 ", sourceDump, "fr.xml.bz2", cliMode, ""},
+		{"dict:replace:overrides.txt", sourceDictionary, "overrides.txt", phono.MergeModeReplace, ""},
+		{"replace:dict:overrides.txt", sourceDictionary, "overrides.txt", phono.MergeModeReplace, ""},
+		{"no-override:fr.txt", sourceUnknown, "fr.txt", phono.MergeModeNoOverride, ""},
+		{"append:x", sourceUnknown, "x", phono.MergeModeAppend, ""},
+		// URLs keep their own colons, after any prefix.
+		{"https://example.com/fr.txt", sourceUnknown, "https://example.com/fr.txt", cliMode, ""},
+		{"prepend:dict:https://example.com:8443/a:b.txt", sourceDictionary, "https://example.com:8443/a:b.txt", phono.MergeModePrepend, ""},
+		// A drive letter or an unknown word is not a prefix.
+		{`C:\dicts\fr.txt`, sourceUnknown, `C:\dicts\fr.txt`, cliMode, ""},
+		{`dict:C:\dicts\fr.txt`, sourceDictionary, `C:\dicts\fr.txt`, cliMode, ""},
+		{"Dict:fr.txt", sourceUnknown, "Dict:fr.txt", cliMode, ""},
+		{"notes:append:fr.txt", sourceUnknown, "notes:append:fr.txt", cliMode, ""},
+		// Repeated or conflicting prefixes.
+		{"dict:dict:fr.txt", sourceUnknown, "", cliMode, "more than one source kind prefix"},
+		{"dump:dict:fr.txt", sourceUnknown, "", cliMode, "more than one source kind prefix"},
+		{"append:append:fr.txt", sourceUnknown, "", cliMode, "more than one merge mode prefix"},
+		{"append:dict:replace:fr.txt", sourceUnknown, "", cliMode, "more than one merge mode prefix"},
+		{"dict:", sourceUnknown, "", cliMode, "missing path"},
+	}
+	cfg := buildConfig{MergeMode: cliMode}
+	for _, tt := range tests {
+		spec, err := parseSourceSpec(tt.src)
+		if tt.errMatch != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.errMatch) {
+				t.Errorf("parseSourceSpec(%q): err = %v, want %q", tt.src, err, tt.errMatch)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSourceSpec(%q): %v", tt.src, err)
+			continue
+		}
+		if spec.Kind != tt.kind || spec.Path != tt.path {
+			t.Errorf("parseSourceSpec(%q) = %+v, want kind %v, path %q", tt.src, spec, tt.kind, tt.path)
+		}
+		if got := cfg.sourceMergeMode(spec); got != tt.mode {
+			t.Errorf("sourceMergeMode(%q) = %v, want %v", tt.src, got, tt.mode)
+		}
+	}
+}
+
+func TestIsGobStream(t *testing.T) {
+	var gob bytes.Buffer
+	if err := writeGobDictionary(&gob, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !isGobStream(gob.Bytes()) {
+		t.Errorf("isGobStream(% x) = false", gob.Bytes()[:8])
+	}
+	for _, head := range []string{"", "\x00", "\x0f", "\x0f\x02", "\xf7\x01", "chat\tʃa\n", "BZh9"} {
+		if isGobStream([]byte(head)) {
+			t.Errorf("isGobStream(%q) = true", head)
+		}
+	}
+}
+
+func TestClassifyRemoteSource(t *testing.T) {
+	var dump strings.Builder
+	dump.WriteString("<mediawiki>\n")
+	for i := 0; dump.Len() < 64<<10; i++ {
+		fmt.Fprintf(&dump, "<page><title>mot%d</title><ns>0</ns><revision><text>{{pron|mo|fr}}</text></revision></page>\n", i)
+	}
+	dump.WriteString("</mediawiki>\n")
+	files := map[string][]byte{
+		"/dump.xml.gz": compressed(t, "gzip", []byte(dump.String())),
+		"/dict.txt":    []byte("chat\tʃa\n"),
+	}
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(files[r.URL.Path])
+	}))
+	defer srv.Close()
+	cacheDir := t.TempDir()
+
+	// A remote dump is streamed from its first byte, without being cached.
+	kind, _, stream, err := classifySource(srv.URL+"/dump.xml.gz", cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind != sourceDump || stream == nil {
+		t.Fatalf("dump: kind = %v, stream = %v", kind, stream)
+	}
+	rc, err := openStream("dump.xml.gz", stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != dump.String() {
+		t.Errorf("streamed dump differs: %d bytes, want %d", len(got), dump.Len())
+	}
+	if _, err := os.Stat(remote.CachePath(cacheDir, srv.URL+"/dump.xml.gz")); !os.IsNotExist(err) {
+		t.Errorf("dump cached: %v", err)
+	}
+
+	// A remote dictionary is cached while it is sniffed, then revalidated.
+	for i := 0; i < 2; i++ {
+		kind, path, stream, err := classifySource(srv.URL+"/dict.txt", cacheDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kind != sourceDictionary || stream != nil {
+			t.Fatalf("dict: kind = %v, stream = %v", kind, stream)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != "chat\tʃa\n" {
+			t.Errorf("cached copy = %q, %v", data, err)
+		}
+	}
+	if requests["/dump.xml.gz"] != 1 || requests["/dict.txt"] != 2 {
+		t.Errorf("requests = %v", requests)
+	}
+}
+
+func TestLoadCurationStub(t *testing.T) {
+	dir := t.TempDir()
+	stub := "# ipadict curation stub\n# Missed words: 3\n# zorglub (2): \"le zorglub\"\nzorglub\tzɔʁɡlyb\nbidule\t\n#hashtag\t\n"
+	plain := "chat\tʃa\n#hashtag\taʃtaɡ\nmot\t\n"
+	files := map[string][]byte{
+		"stub.txt":    []byte(stub),
+		"stub.txt.gz": compressed(t, "gzip", []byte("\xef\xbb\xbf"+stub)),
+		"plain.txt":   []byte(plain),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"stub.txt", "stub.txt.gz"} {
+		rep := phono.NewRepresentation()
+		if err := loadDictionaries(rep, phono.MergeModeAppend, dir, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+		if len(rep.Entries) != 1 || len(rep.Entries["zorglub"]) != 1 {
+			t.Errorf("%s: entries = %v, want the filled-in word only", name, rep.Entries)
+		}
+	}
+
+	// Without the header, "#" lines are entries like any other.
+	rep := phono.NewRepresentation()
+	if err := loadDictionaries(rep, phono.MergeModeAppend, dir, filepath.Join(dir, "plain.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Entries["chat"]) != 1 || len(rep.Entries["#hashtag"]) != 1 {
+		t.Errorf("plain: entries = %v", rep.Entries)
+	}
+}
+
+func TestIsCurationStub(t *testing.T) {
+	tests := []struct {
+		head string
+		want bool
+	}{
+		{"# ipadict curation stub\nchat\t\n", true},
+		{"\xef\xbb\xbf# ipadict curation stub\r\n", true},
+		{"# ipadict curation stub", true},
+		{"# a comment\n# ipadict curation stub\n", false},
+		{"chat\tʃa\n", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isCurationStub(bufio.NewReader(strings.NewReader(tt.head))); got != tt.want {
+			t.Errorf("isCurationStub(%q) = %v, want %v", tt.head, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,496 @@
+// File path: tipatools/ipadict/wikitext/wikitext.go
+
+// Package wikitext implements a streaming tokenizer for MediaWiki template
+// invocations.
+//
+// The tokenizer reads wikitext from an io.Reader and yields every top-level
+// {{...}} template with its parameters. It understands the constructs that
+// break line-oriented scanning of Wiktionary pages:
+//
+//   - templates spanning several lines,
+//   - nested templates ({{pron|{{lien|...}}|fr}}), exposed on each Param,
+//   - internal links whose pipes do not separate parameters ([[a|b]]),
+//   - named parameters (lang=fr),
+//   - HTML comments (<!-- ... -->), which are removed,
+//   - <nowiki> and <pre> blocks, whose content is kept as literal text and
+//     never parsed as markup,
+//   - template parameter references ({{{1}}}), kept as literal text.
+//
+// Malformed input never makes the tokenizer fail. As in MediaWiki, an
+// unterminated construct is plain text: when a template, a <nowiki> or <pre>
+// block or a parameter reference is still open at EOF, the tokenizer rewinds
+// to just after its opening and keeps scanning, so later templates are still
+// found. Only an unterminated comment runs to the end of the text.
+//
+// Rewrite copies a stream while replacing its top-level templates, which
+// lets a caller normalize templates for a line-oriented consumer.
+package wikitext
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Template is a single {{name|param|...}} invocation.
+type Template struct {
+	Name   string  // template name, trimmed
+	Params []Param // parameters in source order
+	Raw    string  // source text including braces, with comments removed
+}
+
+// Param is a template parameter.
+type Param struct {
+	Name      string      // empty for positional parameters
+	Value     string      // raw value; named values are trimmed, positional ones are not
+	Templates []*Template // templates nested in the value, in source order
+}
+
+// Positional returns the values of the positional parameters, in order.
+func (t *Template) Positional() []string {
+	var values []string
+	for _, p := range t.Params {
+		if p.Name == "" {
+			values = append(values, p.Value)
+		}
+	}
+	return values
+}
+
+// Named returns the value of the named parameter name.
+func (t *Template) Named(name string) (string, bool) {
+	for _, p := range t.Params {
+		if p.Name != "" && p.Name == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// Walk calls fn for t and, depth-first, for every template nested in its
+// parameters.
+func (t *Template) Walk(fn func(*Template)) {
+	fn(t)
+	for _, p := range t.Params {
+		for _, nested := range p.Templates {
+			nested.Walk(fn)
+		}
+	}
+}
+
+// errUnterminated reports a construct that is still open at EOF.
+var errUnterminated = errors.New("wikitext: unterminated construct")
+
+// Tokenizer reads top-level templates from a wikitext stream.
+type Tokenizer struct {
+	r   io.Reader
+	buf []byte // input read from r but not consumed yet
+	err error  // read error of r, returned once buf is exhausted
+
+	// Consumed input is recorded while a construct that may have to be
+	// rewound is open (see mark).
+	marks int
+	rec   []byte
+
+	off     int64            // offset of buf in the stream
+	noEnd   map[string]int64 // terminator -> offset from which it is known to be missing
+	noClose int64            // offset from which no "}}" starts, or -1 when unknown
+}
+
+// NewTokenizer returns a Tokenizer reading from r.
+func NewTokenizer(r io.Reader) *Tokenizer {
+	return &Tokenizer{r: r, noEnd: make(map[string]int64), noClose: -1}
+}
+
+// Next returns the next top-level template. It returns io.EOF when the
+// stream is exhausted; any other error comes from the underlying reader.
+func (z *Tokenizer) Next() (*Template, error) {
+	return z.scan(io.Discard)
+}
+
+// ParseString returns all top-level templates found in s.
+func ParseString(s string) []*Template {
+	z := NewTokenizer(strings.NewReader(s))
+	var templates []*Template
+	for {
+		t, err := z.Next()
+		if err != nil {
+			return templates
+		}
+		templates = append(templates, t)
+	}
+}
+
+// Rewrite copies the wikitext of r to w, replacing every top-level template
+// with fn(t); fn returns t.Raw to keep a template unchanged. Comments are
+// dropped, <nowiki> and <pre> blocks are copied unchanged.
+func Rewrite(r io.Reader, w io.Writer, fn func(t *Template) string) error {
+	z := NewTokenizer(r)
+	bw := bufio.NewWriter(w)
+	for {
+		t, err := z.scan(bw)
+		if err == io.EOF {
+			return bw.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := bw.WriteString(fn(t)); err != nil {
+			return err
+		}
+	}
+}
+
+// scan copies the text before the next top-level template to w and returns
+// the template.
+func (z *Tokenizer) scan(w io.Writer) (*Template, error) {
+	for {
+		if tag, ok := z.acceptTag("nowiki"); ok {
+			if err := z.literalBlock(w, tag, "</nowiki>"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if tag, ok := z.acceptTag("pre"); ok {
+			if err := z.literalBlock(w, tag, "</pre>"); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		switch {
+		case z.accept("<!--"):
+			if err := z.skipPast("-->"); err != nil {
+				return nil, err
+			}
+		case z.accept("{{{"):
+			if err := z.literalBlock(w, "{{{", "}}}"); err != nil {
+				return nil, err
+			}
+		case z.accept("{{"):
+			if z.noClose >= 0 && z.off >= z.noClose {
+				// No "}}" is left to close the template.
+				io.WriteString(w, "{{")
+				continue
+			}
+			start, m := z.off, z.mark()
+			t, err := z.template()
+			if errors.Is(err, errUnterminated) {
+				z.closeMissing(start, m)
+				z.rewind(m)
+				io.WriteString(w, "{{")
+				continue
+			}
+			z.release(m)
+			return t, err
+		default:
+			_, text, err := z.readRune()
+			if err != nil {
+				return nil, err
+			}
+			io.WriteString(w, text)
+		}
+	}
+}
+
+// closeMissing remembers where the last "}}" of the stream starts, when the
+// template opened at offset start ran to the end of the stream; m is the
+// mark taken at start. Templates opened after it are then known to be
+// unterminated without being parsed, as literal does for missing
+// terminators: rewinding would otherwise make every "{{" left open rescan
+// the stream to its end.
+func (z *Tokenizer) closeMissing(start int64, m int) {
+	if len(z.buf) > 0 || z.err != io.EOF {
+		return
+	}
+	z.noClose = start + int64(bytes.LastIndex(z.rec[m:], []byte("}}"))) + 1
+}
+
+// literalBlock copies a literal block opened by open and closed by end to w,
+// both included. When end is missing, the block is rewound and only open is
+// copied, as text.
+func (z *Tokenizer) literalBlock(w io.Writer, open, end string) error {
+	m := z.mark()
+	var lit strings.Builder
+	end, err := z.literal(&lit, end)
+	if err != nil {
+		if err != io.EOF {
+			return err
+		}
+		z.rewind(m)
+		io.WriteString(w, open)
+		return nil
+	}
+	z.release(m)
+	io.WriteString(w, open+lit.String()+end)
+	return nil
+}
+
+// template parses a template body; the opening braces are already consumed.
+// It returns errUnterminated when the template is still open at EOF.
+func (z *Tokenizer) template() (*Template, error) {
+	var raw, cur strings.Builder
+	raw.WriteString("{{")
+
+	var parts []rawPart
+	eqAt := -1
+	var nested []*Template
+	linkDepth := 0
+
+	endPart := func() {
+		parts = append(parts, rawPart{text: cur.String(), eqAt: eqAt, templates: nested})
+		cur.Reset()
+		eqAt = -1
+		nested = nil
+	}
+	// literal appends a literal block to the current part, or its opening
+	// as text when the block is unterminated.
+	literal := func(open, end string, keep bool) error {
+		var lit strings.Builder
+		if err := z.literalBlock(&lit, open, end); err != nil {
+			return err
+		}
+		text := lit.String()
+		if keep && text != open {
+			// <nowiki> and <pre> contribute their content only.
+			cur.WriteString(text[len(open) : len(text)-len(end)])
+		} else {
+			cur.WriteString(text)
+		}
+		raw.WriteString(text)
+		return nil
+	}
+
+	for {
+		if tag, ok := z.acceptTag("nowiki"); ok {
+			if err := literal(tag, "</nowiki>", true); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if tag, ok := z.acceptTag("pre"); ok {
+			if err := literal(tag, "</pre>", true); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		switch {
+		case z.accept("<!--"):
+			if err := z.skipPast("-->"); err != nil {
+				return nil, unterminated(err)
+			}
+		case z.accept("{{{"):
+			if err := literal("{{{", "}}}", false); err != nil {
+				return nil, err
+			}
+		case z.accept("{{"):
+			t, err := z.template()
+			if err != nil {
+				return nil, err
+			}
+			nested = append(nested, t)
+			cur.WriteString(t.Raw)
+			raw.WriteString(t.Raw)
+		case z.accept("}}"):
+			raw.WriteString("}}")
+			endPart()
+			return buildTemplate(parts[0].text, parts[1:], raw.String()), nil
+		case z.accept("[["):
+			linkDepth++
+			cur.WriteString("[[")
+			raw.WriteString("[[")
+		case linkDepth > 0 && z.accept("]]"):
+			linkDepth--
+			cur.WriteString("]]")
+			raw.WriteString("]]")
+		default:
+			r, text, err := z.readRune()
+			if err != nil {
+				return nil, unterminated(err)
+			}
+			raw.WriteString(text)
+			switch {
+			case r == '|' && linkDepth == 0:
+				endPart()
+			case r == '=' && linkDepth == 0 && eqAt < 0 && len(parts) > 0:
+				eqAt = cur.Len()
+				cur.WriteString(text)
+			default:
+				cur.WriteString(text)
+			}
+		}
+	}
+}
+
+// rawPart is a '|'-separated section of a template body.
+type rawPart struct {
+	text      string
+	eqAt      int // byte offset of the first top-level '=', or -1
+	templates []*Template
+}
+
+// buildTemplate turns the raw parts of a template into a Template.
+func buildTemplate(name string, parts []rawPart, raw string) *Template {
+	t := &Template{Name: strings.TrimSpace(name), Raw: raw}
+	for _, p := range parts {
+		param := Param{Value: p.text, Templates: p.templates}
+		if p.eqAt >= 0 {
+			param.Name = strings.TrimSpace(p.text[:p.eqAt])
+			param.Value = strings.TrimSpace(p.text[p.eqAt+1:])
+		}
+		t.Params = append(t.Params, param)
+	}
+	return t
+}
+
+// unterminated maps EOF inside a template to errUnterminated.
+func unterminated(err error) error {
+	if err == io.EOF {
+		return errUnterminated
+	}
+	return err
+}
+
+// mark starts recording the consumed input, so that it can be given back by
+// rewind. Every mark is ended by rewind or release.
+func (z *Tokenizer) mark() int {
+	z.marks++
+	return len(z.rec)
+}
+
+// release ends mark m, keeping the input consumed since.
+func (z *Tokenizer) release(m int) {
+	z.marks--
+	if z.marks == 0 {
+		z.rec = z.rec[:0]
+	}
+}
+
+// rewind ends mark m and gives back the input consumed since.
+func (z *Tokenizer) rewind(m int) {
+	z.off -= int64(len(z.rec) - m)
+	z.buf = append(append([]byte(nil), z.rec[m:]...), z.buf...)
+	z.rec = z.rec[:m]
+	z.release(m)
+}
+
+// fill reads from r until buf holds at least n bytes or r fails.
+func (z *Tokenizer) fill(n int) {
+	for len(z.buf) < n && z.err == nil {
+		var chunk [4096]byte
+		k, err := z.r.Read(chunk[:])
+		z.buf = append(z.buf, chunk[:k]...)
+		if err != nil {
+			z.err = err
+		}
+	}
+}
+
+// peek returns the next n bytes without consuming them.
+func (z *Tokenizer) peek(n int) ([]byte, error) {
+	z.fill(n)
+	if len(z.buf) < n {
+		return z.buf, z.err
+	}
+	return z.buf[:n], nil
+}
+
+// discard consumes n bytes.
+func (z *Tokenizer) discard(n int) {
+	if z.marks > 0 {
+		z.rec = append(z.rec, z.buf[:n]...)
+	}
+	z.off += int64(n)
+	z.buf = z.buf[n:]
+}
+
+// readRune consumes the next rune and returns it with its bytes. An invalid
+// UTF-8 byte is read alone, as utf8.RuneError.
+func (z *Tokenizer) readRune() (rune, string, error) {
+	z.fill(utf8.UTFMax)
+	if len(z.buf) == 0 {
+		return 0, "", z.err
+	}
+	r, size := utf8.DecodeRune(z.buf)
+	text := string(z.buf[:size])
+	z.discard(size)
+	return r, text, nil
+}
+
+// accept consumes s if the stream starts with it.
+func (z *Tokenizer) accept(s string) bool {
+	b, err := z.peek(len(s))
+	if err != nil || string(b) != s {
+		return false
+	}
+	z.discard(len(s))
+	return true
+}
+
+// acceptTag consumes an opening <name> or <name ...> tag, case-insensitively,
+// and returns it. Self-closing tags such as <nowiki/> are left alone, since
+// they do not open a literal block.
+func (z *Tokenizer) acceptTag(name string) (string, bool) {
+	b, err := z.peek(len(name) + 1)
+	if err != nil || b[0] != '<' || !strings.EqualFold(string(b[1:]), name) {
+		return "", false
+	}
+	// Look for the closing '>' within a reasonable attribute length.
+	for n := len(name) + 2; n <= len(name)+64; n++ {
+		b, err = z.peek(n)
+		if err != nil {
+			return "", false
+		}
+		c := b[n-1]
+		if n == len(name)+2 && c != '>' && c != ' ' && c != '/' && c != '\t' {
+			return "", false
+		}
+		if c == '>' {
+			if b[n-2] == '/' {
+				return "", false
+			}
+			tag := string(b)
+			z.discard(n)
+			return tag, true
+		}
+	}
+	return "", false
+}
+
+// literal copies text up to the case-insensitive terminator end into w,
+// consumes the terminator and returns it as found in the text.
+//
+// A terminator missing from the rest of the stream is remembered, and later
+// searches for it fail with io.EOF at once: rewinding would otherwise make
+// every opening of an unterminated construct rescan the stream to its end.
+func (z *Tokenizer) literal(w io.Writer, end string) (string, error) {
+	key := strings.ToLower(end)
+	if at, ok := z.noEnd[key]; ok && z.off >= at {
+		return "", io.EOF
+	}
+	start := z.off
+	for {
+		b, err := z.peek(len(end))
+		if err == nil && strings.EqualFold(string(b), end) {
+			found := string(b)
+			z.discard(len(end))
+			return found, nil
+		}
+		_, text, err := z.readRune()
+		if err != nil {
+			if err == io.EOF {
+				z.noEnd[key] = start
+			}
+			return "", err
+		}
+		io.WriteString(w, text)
+	}
+}
+
+// skipPast discards text up to and including end.
+func (z *Tokenizer) skipPast(end string) error {
+	_, err := z.literal(io.Discard, end)
+	return err
+}
@@ -0,0 +1,171 @@
+// File path: tipatools/ipadict/wikitext/wikitext_test.go
+
+package wikitext
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the expected templates of the testdata pages")
+
+// describe renders the templates of a page, nested ones indented, one
+// per line with their parameters.
+func describe(templates []*Template) string {
+	var b strings.Builder
+	var walk func(t *Template, depth int)
+	walk = func(t *Template, depth int) {
+		fmt.Fprintf(&b, "%s%q", strings.Repeat("  ", depth), t.Name)
+		for _, p := range t.Params {
+			if p.Name != "" {
+				fmt.Fprintf(&b, " %s=%q", p.Name, p.Value)
+			} else {
+				fmt.Fprintf(&b, " %q", p.Value)
+			}
+		}
+		b.WriteByte('\n')
+		for _, p := range t.Params {
+			for _, n := range p.Templates {
+				walk(n, depth+1)
+			}
+		}
+	}
+	for _, t := range templates {
+		walk(t, 0)
+	}
+	return b.String()
+}
+
+func TestPages(t *testing.T) {
+	pages, err := filepath.Glob(filepath.Join("testdata", "*.wiki"))
+	if err != nil || len(pages) == 0 {
+		t.Fatalf("no testdata pages: %v", err)
+	}
+	for _, page := range pages {
+		t.Run(filepath.Base(page), func(t *testing.T) {
+			text, err := os.ReadFile(page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := describe(ParseString(string(text)))
+			want := strings.TrimSuffix(page, ".wiki") + ".want"
+			if *update {
+				if err := os.WriteFile(want, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(expected) {
+				t.Errorf("templates of %s:\n%s\nwant:\n%s", page, got, expected)
+			}
+		})
+	}
+}
+
+func TestParseString(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"positional and named", "{{pron|ʃa|lang=fr}}", "\"pron\" \"ʃa\" lang=\"fr\"\n"},
+		{"link pipes", "{{t|[[a|b]]|c}}", "\"t\" \"[[a|b]]\" \"c\"\n"},
+		{"comment", "{{pron|<!-- x -->ʃa|fr}}", "\"pron\" \"ʃa\" \"fr\"\n"},
+		{"nested", "{{a|{{b|1}}}}", "\"a\" \"{{b|1}}\"\n  \"b\" \"1\"\n"},
+		{"parameter reference", "{{a|{{{1}}}}}", "\"a\" \"{{{1}}}\"\n"},
+		{"nowiki content", "{{a|<nowiki>|}}</nowiki>}}", "\"a\" \"|}}\"\n"},
+		{"self-closing nowiki", "<nowiki/>{{a}}", "\"a\"\n"},
+		{"self-closing nowiki in a template", "{{a|x<nowiki />y}}", "\"a\" \"x<nowiki />y\"\n"},
+		{"unterminated template", "{{a|{{b}} {{c}}", "\"b\"\n\"c\"\n"},
+		{"unterminated nested", "{{a|{{b|x}} {{c", "\"b\" \"x\"\n"},
+		{"unterminated nowiki", "<nowiki>{{a}}", "\"a\"\n"},
+		{"unterminated nowiki in a template", "{{a|<nowiki>x}}", "\"a\" \"<nowiki>x\"\n"},
+		{"unterminated reference", "{{{1|{{a}}", "\"a\"\n"},
+		{"unterminated comment", "{{a}}<!-- {{b}}", "\"a\"\n"},
+		{"stray braces", "}} {{a}} }}", "\"a\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describe(ParseString(tt.text)); got != tt.want {
+				t.Errorf("ParseString(%q) =\n%s\nwant:\n%s", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnclosedTemplates(t *testing.T) {
+	// Once a "{{" runs to the end of the text, the ones after the last "}}"
+	// are not parsed again: many of them would otherwise take quadratic time.
+	text := "{{a|{{b}} {{c}}" + strings.Repeat(" {{d|{{e", 50000)
+	z := NewTokenizer(strings.NewReader(text))
+	var got []string
+	for {
+		tmpl, err := z.Next()
+		if err != nil {
+			break
+		}
+		got = append(got, tmpl.Name)
+	}
+	if strings.Join(got, "|") != "b|c" {
+		t.Errorf("templates = %q, want b and c", got)
+	}
+	if want := int64(strings.LastIndex(text, "}}") + 1); z.noClose != want {
+		t.Errorf("noClose = %d, want %d", z.noClose, want)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	text := "a {{pron|ʃa\n|fr}} <!-- {{pron|x|fr}} --> <nowiki>{{pron|y|fr}}</nowiki> {{ open {{m}}"
+	var out strings.Builder
+	err := Rewrite(strings.NewReader(text), &out, func(t *Template) string {
+		if t.Name == "pron" {
+			return "{{pron|" + strings.TrimSpace(t.Positional()[0]) + "|fr}}"
+		}
+		return t.Raw
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a {{pron|ʃa|fr}}  <nowiki>{{pron|y|fr}}</nowiki> {{ open {{m}}"
+	if out.String() != want {
+		t.Errorf("Rewrite = %q, want %q", out.String(), want)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	pages, _ := filepath.Glob(filepath.Join("testdata", "*.wiki"))
+	for _, page := range pages {
+		if text, err := os.ReadFile(page); err == nil {
+			f.Add(string(text))
+		}
+	}
+	f.Add("{{a|{{b|[[c|d]]}}|e=f}}")
+	f.Add("{{{{{{")
+	f.Add("<nowiki><pre>{{{</pre>")
+	f.Fuzz(func(t *testing.T, text string) {
+		templates := ParseString(text)
+		for _, top := range templates {
+			top.Walk(func(tt *Template) {
+				if !strings.HasPrefix(tt.Raw, "{{") || !strings.HasSuffix(tt.Raw, "}}") {
+					t.Fatalf("template raw text %q is not delimited by braces", tt.Raw)
+				}
+			})
+		}
+
+		// Rewriting every template as itself only drops the comments, so a
+		// second pass finds the same templates.
+		var out strings.Builder
+		if err := Rewrite(strings.NewReader(text), &out, func(t *Template) string { return t.Raw }); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(text, "<!--") && out.String() != text {
+			t.Fatalf("Rewrite changed text without comments:\n%q\n%q", text, out.String())
+		}
+	})
+}
@@ -0,0 +1,224 @@
+// File path: tipatools/ipadict/wordkey/wordkey.go
+
+// Package wordkey implements the word-key normalization policies shared by
+// ipadict and phonetize.
+//
+// The same word may reach a dictionary under several keys: "Paris" and
+// "PARIS", or "aujourd’hui" with a typographic apostrophe and "aujourd'hui"
+// with an ASCII one. A Policy maps those variants onto a single key. ipadict
+// applies it at the end of a build (--key-form, --unify-punct, --case);
+// phonetize applies the same policy to the dictionaries it loads and to its
+// input text, so that both tools agree on the keys as long as they are given
+// the same options.
+package wordkey
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Policy describes how word keys are normalized. The zero value keeps keys
+// unchanged.
+type Policy struct {
+	Form  string // Unicode normalization of keys: "", "none", "nfc" or "nfd"
+	Unify bool   // map typographic apostrophes and hyphens to ASCII
+	Case  string // "", "preserve", "fold" or "fold-proper"
+}
+
+// punctVariants maps typographic apostrophes and hyphens to their ASCII
+// form. Every replacement is a single rune, so offsets are preserved.
+var punctVariants = map[rune]rune{
+	'’': '\'', // right single quotation mark
+	'‘': '\'', // left single quotation mark
+	'ʼ': '\'', // modifier letter apostrophe
+	'′': '\'', // prime
+	'＇': '\'', // fullwidth apostrophe
+	'‐': '-',  // hyphen
+	'‑': '-',  // non-breaking hyphen
+	'﹣': '-',  // small hyphen-minus
+	'－': '-',  // fullwidth hyphen-minus
+}
+
+// Enabled reports whether the policy changes any key.
+func (p Policy) Enabled() bool {
+	return (p.Form != "" && p.Form != "none") || p.Unify || (p.Case != "" && p.Case != "preserve")
+}
+
+// Validate checks the policy values.
+func (p Policy) Validate() error {
+	switch p.Form {
+	case "", "none", "nfc", "nfd":
+	default:
+		return fmt.Errorf("invalid key form %q (must be \"nfc\", \"nfd\" or \"none\")", p.Form)
+	}
+	switch p.Case {
+	case "", "preserve", "fold", "fold-proper":
+		return nil
+	}
+	return fmt.Errorf("invalid case policy %q (must be \"preserve\", \"fold\" or \"fold-proper\")", p.Case)
+}
+
+// normalize applies the Unicode normalization form of the policy to s.
+func (p Policy) normalize(s string) string {
+	switch p.Form {
+	case "nfc":
+		return norm.NFC.String(s)
+	case "nfd":
+		return norm.NFD.String(s)
+	}
+	return s
+}
+
+// UnifyPunct replaces typographic apostrophes and hyphens in s by their ASCII
+// form. It keeps the number of runes of s.
+func UnifyPunct(s string) string {
+	return strings.Map(func(r rune) rune {
+		if a, ok := punctVariants[r]; ok {
+			return a
+		}
+		return r
+	}, s)
+}
+
+// Phrase collapses every run of white space in word (including non-breaking
+// spaces) into a single ASCII space, so that phrase keys are spelled the same
+// way whatever their source.
+func Phrase(word string) string {
+	if !strings.ContainsFunc(word, unicode.IsSpace) {
+		return word
+	}
+	return strings.Join(strings.Fields(word), " ")
+}
+
+// Base applies the normalization form and punctuation unification to word,
+// and canonicalizes the spaces of phrases, leaving its case unchanged.
+func (p Policy) Base(word string) string {
+	word = Phrase(p.normalize(word))
+	if p.Unify {
+		word = UnifyPunct(word)
+	}
+	return word
+}
+
+// IsTitleCase reports whether word starts with an upper-case letter and has
+// no upper-case letter other than at the start of its words, as proper
+// nouns usually do ("Paris", "New York").
+func IsTitleCase(word string) bool {
+	first, _ := utf8.DecodeRuneInString(word)
+	if !unicode.IsUpper(first) {
+		return false
+	}
+	for _, w := range strings.Fields(word) {
+		_, size := utf8.DecodeRuneInString(w)
+		if strings.ToLower(w[size:]) != w[size:] {
+			return false
+		}
+	}
+	return true
+}
+
+// TitleCase returns word with the first rune of each of its words
+// upper-cased and the rest lower-cased.
+func TitleCase(word string) string {
+	words := strings.Split(word, " ")
+	for i, w := range words {
+		first, size := utf8.DecodeRuneInString(w)
+		if size == 0 {
+			continue
+		}
+		words[i] = string(unicode.ToUpper(first)) + strings.ToLower(w[size:])
+	}
+	return strings.Join(words, " ")
+}
+
+// KeyMap returns the normalized key of every word of entries.
+//
+// With the "fold-proper" case policy, title-case keys ("Paris", "Marc") are
+// kept as proper nouns; other keys containing upper-case letters ("PARIS")
+// fold onto the title-case key when it exists, and to lower case otherwise.
+func KeyMap[M ~map[string]V, V any](p Policy, entries M) map[string]string {
+	proper := make(map[string]bool)
+	if p.Case == "fold-proper" {
+		for word := range entries {
+			if b := p.Base(word); IsTitleCase(b) {
+				proper[b] = true
+			}
+		}
+	}
+	mapping := make(map[string]string, len(entries))
+	for word := range entries {
+		key := p.Base(word)
+		switch p.Case {
+		case "fold":
+			key = strings.ToLower(key)
+		case "fold-proper":
+			if !IsTitleCase(key) {
+				if t := TitleCase(key); key != strings.ToLower(key) && proper[t] {
+					key = t
+				} else {
+					key = strings.ToLower(key)
+				}
+			}
+		}
+		mapping[word] = key
+	}
+	return mapping
+}
+
+// Rekey merges the entries of words mapped onto the same key. The
+// pronunciations of the word already spelled like the key come first, then
+// those of the other variants in lexical order; duplicates are dropped.
+func Rekey[M ~map[string][]string](entries M, mapping map[string]string) M {
+	words := make([]string, 0, len(entries))
+	for word := range entries {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		ki, kj := mapping[words[i]], mapping[words[j]]
+		if ki != kj {
+			return ki < kj
+		}
+		if (words[i] == ki) != (words[j] == kj) {
+			return words[i] == ki
+		}
+		return words[i] < words[j]
+	})
+
+	out := make(M, len(entries))
+	seen := make(map[string]bool)
+	for _, word := range words {
+		key := mapping[word]
+		for _, pron := range entries[word] {
+			if seen[key+"\t"+pron] {
+				continue
+			}
+			seen[key+"\t"+pron] = true
+			out[key] = append(out[key], pron)
+		}
+	}
+	return out
+}
+
+// Text prepares running text for a lookup with the keys of the policy. It
+// returns the text to scan and the surface text: the input with the
+// normalization form applied, which is what positions in the scanned text
+// refer to. Punctuation unification and case folding only change the
+// scanned copy, rune for rune, so both texts have the same number of runes.
+// Phrase spaces are left as is. With "fold-proper", the text is not folded:
+// dictionaries carry the capitalized spellings instead.
+func (p Policy) Text(text string) (scanned, surface string) {
+	surface = p.normalize(text)
+	scanned = surface
+	if p.Unify {
+		scanned = UnifyPunct(scanned)
+	}
+	if p.Case == "fold" {
+		scanned = strings.Map(unicode.ToLower, scanned)
+	}
+	return scanned, surface
+}
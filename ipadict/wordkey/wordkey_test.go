@@ -0,0 +1,100 @@
+// File path: tipatools/ipadict/wordkey/wordkey_test.go
+
+package wordkey
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestValidate(t *testing.T) {
+	for _, p := range []Policy{{}, {Form: "none"}, {Form: "nfc", Unify: true, Case: "fold-proper"}, {Form: "nfd", Case: "preserve"}} {
+		if err := p.Validate(); err != nil {
+			t.Errorf("%+v: %v", p, err)
+		}
+	}
+	for _, p := range []Policy{{Form: "nfkc"}, {Case: "upper"}} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%+v: accepted", p)
+		}
+	}
+	if (Policy{Form: "none", Case: "preserve"}).Enabled() {
+		t.Error("no-op policy enabled")
+	}
+}
+
+func TestBase(t *testing.T) {
+	p := Policy{Form: "nfc", Unify: true}
+	if got, want := p.Base("aujourd’hui"), "aujourd'hui"; got != want {
+		t.Errorf("Base = %q, want %q", got, want)
+	}
+	if got, want := p.Base("pomme  de\tterre"), "pomme de terre"; got != want {
+		t.Errorf("Base = %q, want %q", got, want)
+	}
+	if got, want := p.Base("garçon"), "garçon"; got != want {
+		t.Errorf("Base = %q, want %q", got, want)
+	}
+}
+
+func TestTitleCase(t *testing.T) {
+	for word, want := range map[string]bool{"Paris": true, "New York": true, "PARIS": false, "paris": false, "McDo": false, "": false} {
+		if got := IsTitleCase(word); got != want {
+			t.Errorf("IsTitleCase(%q) = %v", word, got)
+		}
+	}
+	if got := TitleCase("NEW YORK"); got != "New York" {
+		t.Errorf("TitleCase = %q", got)
+	}
+}
+
+func TestKeyMap(t *testing.T) {
+	entries := map[string][]string{"Paris": nil, "PARIS": nil, "ÉTÉ": nil, "été": nil, "Lyon": nil}
+	tests := []struct {
+		policy Policy
+		want   map[string]string
+	}{
+		{Policy{}, map[string]string{"Paris": "Paris", "PARIS": "PARIS", "ÉTÉ": "ÉTÉ", "été": "été", "Lyon": "Lyon"}},
+		{Policy{Case: "fold"}, map[string]string{"Paris": "paris", "PARIS": "paris", "ÉTÉ": "été", "été": "été", "Lyon": "lyon"}},
+		{Policy{Case: "fold-proper"}, map[string]string{"Paris": "Paris", "PARIS": "Paris", "ÉTÉ": "été", "été": "été", "Lyon": "Lyon"}},
+	}
+	for _, tt := range tests {
+		if got := KeyMap(tt.policy, entries); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: KeyMap = %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestRekey(t *testing.T) {
+	type dict map[string][]string
+	entries := dict{
+		"PARIS": {"paʁis", "paʁi"},
+		"Paris": {"pa.ʁi"},
+		"paris": {"paʁi"},
+	}
+	got := Rekey(entries, KeyMap(Policy{Case: "fold"}, entries))
+	// The variant spelled like the key comes first, then the others in
+	// lexical order, without duplicates.
+	if want := (dict{"paris": {"paʁi", "paʁis", "pa.ʁi"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Rekey = %v, want %v", got, want)
+	}
+}
+
+func TestText(t *testing.T) {
+	p := Policy{Form: "nfc", Unify: true, Case: "fold"}
+	scanned, surface := p.Text("Aujourd’hui  GARÇON")
+	if surface != "Aujourd’hui  GARÇON" {
+		t.Errorf("surface = %q", surface)
+	}
+	if scanned != "aujourd'hui  garçon" {
+		t.Errorf("scanned = %q", scanned)
+	}
+	if utf8.RuneCountInString(scanned) != utf8.RuneCountInString(surface) {
+		t.Error("scanned and surface texts differ in length")
+	}
+
+	// Without folding, "fold-proper" keeps the case of the text.
+	if scanned, _ := (Policy{Case: "fold-proper"}).Text("PARIS"); scanned != "PARIS" {
+		t.Errorf("fold-proper scanned = %q", scanned)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+// Transliteration of the output (--alphabet, --strict-alphabet).
+//
+// The tables are those of ipadict --export-alphabet, in package alphabet.
+// A symbol without a mapping is copied to the output unchanged and
+// reported on standard error, or, with --strict-alphabet, fails the text.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/temporal-IPA/tipa/pkg/g2p"
+
+	"ipadict/alphabet"
+)
+
+// convertResult transliterates the IPA of every Fragment of res to a. It
+// returns the number of occurrences of each unmappable symbol.
+func convertResult(a *alphabet.Alphabet, res *g2p.Result) map[string]int {
+	unmappable := make(map[string]int)
+	for i := range res.Fragments {
+		converted, bad := a.Convert(string(res.Fragments[i].Phonetized))
+		res.Fragments[i].Phonetized = converted
+		for _, sym := range bad {
+			unmappable[sym]++
+		}
+	}
+	return unmappable
+}
+
+// unmappableError reports the symbols of a text without a mapping in an
+// alphabet, with --strict-alphabet.
+type unmappableError struct {
+	Alphabet string
+	Symbols  map[string]int // unmappable symbol -> occurrences
+}
+
+func (e *unmappableError) Error() string {
+	symbols := make([]string, 0, len(e.Symbols))
+	for sym := range e.Symbols {
+		symbols = append(symbols, sym)
+	}
+	sort.Strings(symbols)
+	for i, sym := range symbols {
+		symbols[i] = fmt.Sprintf("%q (U+%04X)", sym, []rune(sym)[0])
+	}
+	return fmt.Sprintf("no %s mapping for %s", e.Alphabet, strings.Join(symbols, ", "))
+}
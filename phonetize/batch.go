@@ -0,0 +1,219 @@
+package main
+
+// Batch mode (--input-dir / --glob, --output-dir, --jobs).
+//
+// The dictionaries are loaded once and shared by a pool of workers; each
+// input file is phonetized into one output file, in the --output format,
+// under --output-dir with the same relative path. A summary with the word
+// coverage of every file and the failures is printed on standard error.
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// batchFile is one input of a batch and the outcome of its processing.
+type batchFile struct {
+	Path    string // input path
+	Rel     string // path relative to the input root, used for the output
+	Output  string
+	Words   int // word tokens
+	Covered int // word tokens covered by a fragment
+	Err     error
+}
+
+// coverage returns the share of covered words, in percent.
+func (f batchFile) coverage() float64 {
+	if f.Words == 0 {
+		return 100
+	}
+	return 100 * float64(f.Covered) / float64(f.Words)
+}
+
+// outputExtensions maps an output mode to the extension of batch outputs.
+// Text outputs get ".ipa.txt" so that they never overwrite a ".txt" input.
+var outputExtensions = map[string]string{
+	"json":   ".json",
+	"txt":    ".ipa.txt",
+	"ssml":   ".ssml",
+	"tokens": ".tokens.json",
+}
+
+// isBatchOutput reports whether name is that of a batch output
+// (talk.ipa.txt, talk.ipa.srt), which is never taken as an input, so that
+// a batch run again on its own directory does not phonetize its outputs.
+func isBatchOutput(name string) bool {
+	return strings.Contains(name, ".ipa.")
+}
+
+// batchInputs lists the files to process: the regular files under dir
+// whose base name matches pattern ("*" when empty), or, without dir, the
+// paths matching pattern. Batch outputs are left out.
+func batchInputs(dir, pattern string) ([]batchFile, error) {
+	var files []batchFile
+	if dir != "" {
+		if pattern == "" {
+			pattern = "*"
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid --glob pattern %q: %w", pattern, err)
+		}
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			if ok, _ := filepath.Match(pattern, d.Name()); !ok || isBatchOutput(d.Name()) {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, batchFile{Path: path, Rel: rel})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --glob pattern %q: %w", pattern, err)
+		}
+		root := globRoot(pattern)
+		for _, path := range paths {
+			if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() || isBatchOutput(fi.Name()) {
+				continue
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				rel = filepath.Base(path)
+			}
+			files = append(files, batchFile{Path: path, Rel: rel})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Rel < files[j].Rel })
+	return files, nil
+}
+
+// globRoot returns the directory part of pattern before its first
+// wildcard ("data/*/a?.txt" -> "data").
+func globRoot(pattern string) string {
+	i := strings.IndexAny(pattern, `*?[\`)
+	if i < 0 {
+		return filepath.Dir(pattern)
+	}
+	return filepath.Dir(pattern[:i+1])
+}
+
+// outputPath returns the output path of rel under dir. Subtitles and
+// TextGrids keep their extension after ".ipa" (talk.srt -> talk.ipa.srt).
+func outputPath(dir, rel, format, mode string) string {
+	ext := filepath.Ext(rel)
+	base := strings.TrimSuffix(rel, ext)
+	if isDocumentFormat(format) {
+		return filepath.Join(dir, base+".ipa"+ext)
+	}
+	return filepath.Join(dir, base+outputExtensions[mode])
+}
+
+// wordCoverage counts the word tokens of surface and those covered by a
+// fragment of res.
+func wordCoverage(res scanResult, surface string) (words, covered int) {
+	for _, sent := range buildTokenResult(surface, res).Sentences {
+		for _, tok := range sent.Tokens {
+			if tok.Kind != tokenWord {
+				continue
+			}
+			words++
+			if len(tok.Fragments) > 0 {
+				covered++
+			}
+		}
+	}
+	return words, covered
+}
+
+// runBatch phonetizes files with jobs workers sharing the dictionaries of
+// s, and writes the outputs under outDir. It returns the files with their
+// outcome.
+func runBatch(s *session, files []batchFile, mode, outDir string, jobs int) []batchFile {
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ws := s.worker()
+			for i := range work {
+				ws.source = files[i].Path
+				files[i] = ws.processFile(files[i], mode, outDir)
+			}
+		}()
+	}
+	for i := range files {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return files
+}
+
+// processFile phonetizes a single batch input.
+func (s *session) processFile(f batchFile, mode, outDir string) batchFile {
+	content, err := os.ReadFile(f.Path)
+	if err != nil {
+		f.Err = err
+		return f
+	}
+	format := detectFormat(s.format, f.Path)
+	out, words, covered, err := s.renderDocument(format, mode, decodeTextFile(content))
+	if err != nil {
+		f.Err = err
+		return f
+	}
+	f.Words, f.Covered = words, covered
+
+	f.Output = outputPath(outDir, f.Rel, format, mode)
+	if err := os.MkdirAll(filepath.Dir(f.Output), 0o755); err != nil {
+		f.Err = err
+		return f
+	}
+	if err := os.WriteFile(f.Output, []byte(out), 0o644); err != nil {
+		f.Err = err
+	}
+	return f
+}
+
+// writeBatchSummary prints one line per file and the totals, and returns
+// the number of failures:
+//
+//	<input>\t<words>\t<covered>\t<coverage %>\t<output or error>
+func writeBatchSummary(w io.Writer, files []batchFile) int {
+	var words, covered, failed int
+	for _, f := range files {
+		if f.Err != nil {
+			failed++
+			fmt.Fprintf(w, "%s\t-\t-\t-\tFAILED: %v\n", f.Path, f.Err)
+			continue
+		}
+		words += f.Words
+		covered += f.Covered
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n",
+			f.Path, f.Words, f.Covered, strconv.FormatFloat(f.coverage(), 'f', 2, 64), f.Output)
+	}
+	total := batchFile{Words: words, Covered: covered}
+	fmt.Fprintf(w, "Files: %d (failed: %d), words: %d, covered: %d (%s%%)\n",
+		len(files), failed, words, covered, strconv.FormatFloat(total.coverage(), 'f', 2, 64))
+	return failed
+}
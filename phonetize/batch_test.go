@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+// writeFiles creates files, given by path relative to dir, with their
+// content.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBatchInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.txt":          "chat",
+		"a.ipa.txt":      "ʃa",
+		"sub/b.srt":      "1\n00:00:01,000 --> 00:00:02,000\nchat\n",
+		"sub/b.ipa.srt":  "1\n00:00:01,000 --> 00:00:02,000\nʃa\n",
+		"sub/notes.json": "{}",
+	})
+	files, err := batchInputs(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rels []string
+	for _, f := range files {
+		rels = append(rels, f.Rel)
+	}
+	want := []string{"a.txt", filepath.Join("sub", "b.srt"), filepath.Join("sub", "notes.json")}
+	if !reflect.DeepEqual(rels, want) {
+		t.Errorf("inputs = %q, want %q", rels, want)
+	}
+
+	files, err = batchInputs("", filepath.Join(dir, "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Rel != "a.txt" {
+		t.Errorf("glob inputs = %+v", files)
+	}
+}
+
+// TestRunBatchConcurrent phonetizes many files with several workers
+// sharing one session; run with -race.
+func TestRunBatchConcurrent(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	inputs := make(map[string]string)
+	for i := 0; i < 32; i++ {
+		inputs[fmt.Sprintf("t%02d.txt", i)] = "Le chat et le garcon. Zorglub!"
+	}
+	writeFiles(t, in, inputs)
+	s := testSession(
+		phono.Dictionary{"le": {"lə"}, "Le": {"lə"}, "chat": {"ʃa"}, "et": {"e"}},
+		phono.Dictionary{"garçon": {"ɡaʁsɔ̃"}},
+	)
+
+	files, err := batchInputs(in, "*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = runBatch(s, files, "txt", out, 4)
+	for _, f := range files {
+		if f.Err != nil {
+			t.Fatalf("%s: %v", f.Path, f.Err)
+		}
+		if f.Words != 6 || f.Covered != 5 {
+			t.Errorf("%s: %d of %d words covered, want 5 of 6", f.Rel, f.Covered, f.Words)
+		}
+		data, err := os.ReadFile(f.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "lə ʃa e lə ɡaʁsɔ̃. Zorglub!\n"; string(data) != want {
+			t.Errorf("%s = %q, want %q", f.Output, data, want)
+		}
+		if !strings.HasSuffix(f.Output, ".ipa.txt") {
+			t.Errorf("output %s", f.Output)
+		}
+	}
+	if s.source != "" {
+		t.Errorf("workers changed the shared session: source = %q", s.source)
+	}
+}
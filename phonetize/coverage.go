@@ -0,0 +1,365 @@
+package main
+
+// Corpus coverage report ("phonetize coverage").
+//
+// The dictionaries are loaded once and every file of the corpus (files
+// and directories given as arguments, filtered by --glob) is scanned
+// without writing any output. Every word token is counted in one class:
+//
+//	main      matched as is in the main dictionary
+//	final     matched as is in the final dictionary
+//	tolerant  matched by ignoring diacritics (--match tolerant)
+//	unknown   phonetized, but no dictionary key matches the text
+//	missed    left as a RawText
+//
+// The report gives the token and type (distinct word) counts of each
+// class, and the --top most frequent missed words; --oov-output exports
+// all of them, most frequent first, as "<word>\t<count>" lines ready for
+// curation, and --harvest-oov writes them as a stub dictionary (see
+// harvest.go). The scan warnings are summed up per file.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Coverage classes, in report order.
+const (
+	classMain     = "main"
+	classFinal    = "final"
+	classTolerant = "tolerant"
+	classUnknown  = "unknown"
+	classMissed   = "missed"
+)
+
+var coverageClasses = []string{classMain, classFinal, classTolerant, classUnknown, classMissed}
+
+// maxContexts is the number of sample contexts kept for a missed word.
+const maxContexts = 3
+
+// contextWidth is the number of runes kept on each side of a word in its
+// sample contexts.
+const contextWidth = 30
+
+// wordStat counts the occurrences of a word type.
+type wordStat struct {
+	Count    int
+	Missed   int      // occurrences left as RawText
+	Class    string   // class of the first covered occurrence, or classMissed
+	Contexts []string // up to maxContexts distinct contexts of missed occurrences
+}
+
+// addContext records ctx as a sample context, unless there are enough.
+func (ws *wordStat) addContext(ctx string) {
+	if len(ws.Contexts) >= maxContexts {
+		return
+	}
+	for _, c := range ws.Contexts {
+		if c == ctx {
+			return
+		}
+	}
+	ws.Contexts = append(ws.Contexts, ctx)
+}
+
+// wordContext returns the text around runes[start:end] on a single line,
+// with "…" where it was cut.
+func wordContext(runes []rune, start, end int) string {
+	from, to := max(0, start-contextWidth), min(len(runes), end+contextWidth)
+	ctx := strings.Join(strings.Fields(string(runes[from:to])), " ")
+	if from > 0 {
+		ctx = "…" + ctx
+	}
+	if to < len(runes) {
+		ctx += "…"
+	}
+	return ctx
+}
+
+// coverageStats accumulates the coverage of a corpus.
+type coverageStats struct {
+	Files  int
+	Failed int
+	Tokens map[string]int // class -> word tokens
+	Words  map[string]*wordStat
+}
+
+// newCoverageStats returns empty statistics.
+func newCoverageStats() *coverageStats {
+	return &coverageStats{Tokens: make(map[string]int), Words: make(map[string]*wordStat)}
+}
+
+// add counts the word tokens of tr.
+func (c *coverageStats) add(tr tokenResult) {
+	runes := []rune(tr.Text)
+	for _, sent := range tr.Sentences {
+		for _, tok := range sent.Tokens {
+			if tok.Kind != tokenWord {
+				continue
+			}
+			class := classMissed
+			if len(tok.Fragments) > 0 {
+				f := tr.Fragments[tok.Fragments[0]]
+				switch {
+				case f.Unknown:
+					class = classUnknown
+				case f.Fallback:
+					class = classTolerant
+				case f.Dictionary == "final":
+					class = classFinal
+				default:
+					class = classMain
+				}
+			}
+			c.Tokens[class]++
+
+			ws := c.Words[tok.Text]
+			if ws == nil {
+				ws = &wordStat{Class: classMissed}
+				c.Words[tok.Text] = ws
+			}
+			ws.Count++
+			if class == classMissed {
+				ws.Missed++
+				ws.addContext(wordContext(runes, tok.RuneStart, tok.RuneEnd))
+			} else if ws.Class == classMissed {
+				ws.Class = class
+			}
+		}
+	}
+}
+
+// merge adds the counts of o to c.
+func (c *coverageStats) merge(o *coverageStats) {
+	c.Files += o.Files
+	c.Failed += o.Failed
+	for class, n := range o.Tokens {
+		c.Tokens[class] += n
+	}
+	for word, st := range o.Words {
+		ws := c.Words[word]
+		if ws == nil {
+			ws = &wordStat{Class: classMissed}
+			c.Words[word] = ws
+		}
+		ws.Count += st.Count
+		ws.Missed += st.Missed
+		if ws.Class == classMissed {
+			ws.Class = st.Class
+		}
+		for _, ctx := range st.Contexts {
+			ws.addContext(ctx)
+		}
+	}
+}
+
+// oov returns the words with missed occurrences, most frequently missed
+// first.
+func (c *coverageStats) oov() []string {
+	var words []string
+	for word, ws := range c.Words {
+		if ws.Missed > 0 {
+			words = append(words, word)
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		mi, mj := c.Words[words[i]].Missed, c.Words[words[j]].Missed
+		if mi != mj {
+			return mi > mj
+		}
+		return words[i] < words[j]
+	})
+	return words
+}
+
+// percent formats n / total in percent.
+func percent(n, total int) string {
+	if total == 0 {
+		return "100.00"
+	}
+	return strconv.FormatFloat(100*float64(n)/float64(total), 'f', 2, 64)
+}
+
+// writeCoverageReport prints the token and type counts of every class and
+// the top most frequent missed words.
+func writeCoverageReport(w io.Writer, c *coverageStats, top int) {
+	types := make(map[string]int)
+	for _, ws := range c.Words {
+		types[ws.Class]++
+	}
+	var tokens int
+	for _, n := range c.Tokens {
+		tokens += n
+	}
+
+	fmt.Fprintf(w, "Files: %d (failed: %d)\n", c.Files, c.Failed)
+	fmt.Fprintf(w, "Tokens: %d, covered: %d (%s%%)\n", tokens, tokens-c.Tokens[classMissed], percent(tokens-c.Tokens[classMissed], tokens))
+	for _, class := range coverageClasses {
+		fmt.Fprintf(w, "  %-9s %d\t%s%%\n", class+":", c.Tokens[class], percent(c.Tokens[class], tokens))
+	}
+	fmt.Fprintf(w, "Types: %d, covered: %d (%s%%)\n", len(c.Words), len(c.Words)-types[classMissed], percent(len(c.Words)-types[classMissed], len(c.Words)))
+	for _, class := range coverageClasses {
+		fmt.Fprintf(w, "  %-9s %d\t%s%%\n", class+":", types[class], percent(types[class], len(c.Words)))
+	}
+
+	oov := c.oov()
+	if top <= 0 || len(oov) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Top %d missed words (of %d):\n", min(top, len(oov)), len(oov))
+	for _, word := range oov[:min(top, len(oov))] {
+		fmt.Fprintf(w, "  %d\t%s\n", c.Words[word].Missed, word)
+	}
+}
+
+// writeOOVList writes every missed word of c to path, most frequent
+// first, as "<word>\t<missed occurrences>" lines.
+func writeOOVList(path string, c *coverageStats) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	for _, word := range c.oov() {
+		fmt.Fprintf(bw, "%s\t%d\n", word, c.Words[word].Missed)
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// coverageInputs lists the corpus files: directories are walked for the
+// files whose name matches pattern ("*" when empty), other paths are taken
+// as is.
+func coverageInputs(paths []string, pattern string) ([]batchFile, error) {
+	var files []batchFile
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, batchFile{Path: path, Rel: path})
+			continue
+		}
+		found, err := batchInputs(path, pattern)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// coverFile scans a single corpus file into c. The warnings of its texts
+// are written to warn once the file is scanned.
+func (s *session) coverFile(path string, c *coverageStats, warn io.Writer) error {
+	s.warnings = &scanWarnings{}
+	defer func() {
+		s.warnings.write(warn, s.logPrefix(), s.alpha)
+		s.warnings = nil
+	}()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	texts, err := documentTexts(detectFormat(s.format, path), decodeTextFile(content))
+	if err != nil {
+		return err
+	}
+	for _, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		tr, _, err := s.tokens(text)
+		if err != nil {
+			return err
+		}
+		c.add(tr)
+	}
+	return nil
+}
+
+// runCoverage loads the dictionaries, scans the corpus given as args with
+// jobs workers and prints the report on out. Unreadable files are
+// reported on standard error and counted as failed; the error returned
+// then gives their number.
+func runCoverage(args []string, out io.Writer) error {
+	if strings.TrimSpace(*flagDictPath) == "" {
+		return fmt.Errorf("missing required flag: --dict <dict path>")
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing corpus: phonetize coverage [flags] <file or directory>...")
+	}
+	if *flagJobs < 1 {
+		return fmt.Errorf("invalid --jobs value %d (must be at least 1)", *flagJobs)
+	}
+	s, err := newSession()
+	if err != nil {
+		return err
+	}
+	files, err := coverageInputs(args, strings.TrimSpace(*flagGlob))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no input files found")
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	total := newCoverageStats()
+	var mu sync.Mutex
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for w := 0; w < min(*flagJobs, len(files)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ws := s.worker()
+			for path := range work {
+				ws.source = path
+				c := newCoverageStats()
+				c.Files = 1
+				if err := ws.coverFile(path, c, os.Stderr); err != nil {
+					fmt.Fprintf(os.Stderr, "phonetize: %s: %v\n", path, err)
+					c = newCoverageStats()
+					c.Files, c.Failed = 1, 1
+				}
+				mu.Lock()
+				total.merge(c)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, f := range files {
+		work <- f.Path
+	}
+	close(work)
+	wg.Wait()
+
+	writeCoverageReport(out, total, *flagTop)
+	if path := strings.TrimSpace(*flagOOVOutput); path != "" {
+		if err := writeOOVList(path, total); err != nil {
+			return fmt.Errorf("failed to write the missed words: %w", err)
+		}
+	}
+	if path := strings.TrimSpace(*flagHarvestOOV); path != "" {
+		if err := s.writeHarvest(path, total, *flagHarvestGuess); err != nil {
+			return fmt.Errorf("failed to write the stub dictionary: %w", err)
+		}
+	}
+	if total.Failed > 0 {
+		return fmt.Errorf("%d of %d files failed", total.Failed, total.Files)
+	}
+	return nil
+}
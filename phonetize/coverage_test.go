@@ -0,0 +1,184 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/g2p"
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+// coverageSession returns a tolerant session over a main and a final
+// dictionary.
+func coverageSession() *session {
+	return testSession(phono.Dictionary{"chat": {"ʃa"}, "garçon": {"ɡaʁsɔ̃"}}, phono.Dictionary{"chien": {"ʃjɛ̃"}})
+}
+
+func TestCoverageStatsAdd(t *testing.T) {
+	s := coverageSession()
+	text := "chat, chien garcon zorglub chat."
+	tr, _, err := s.tokens(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCoverageStats()
+	c.add(tr)
+
+	want := map[string]int{classMain: 2, classFinal: 1, classTolerant: 1, classMissed: 1}
+	if !reflect.DeepEqual(c.Tokens, want) {
+		t.Errorf("Tokens = %v, want %v", c.Tokens, want)
+	}
+	classes := map[string]string{"chat": classMain, "chien": classFinal, "garcon": classTolerant, "zorglub": classMissed}
+	for word, class := range classes {
+		if ws := c.Words[word]; ws == nil || ws.Class != class {
+			t.Errorf("%s: %+v, want class %s", word, ws, class)
+		}
+	}
+	if ws := c.Words["chat"]; ws.Count != 2 || ws.Missed != 0 || ws.Contexts != nil {
+		t.Errorf("chat: %+v", ws)
+	}
+	if ws := c.Words["zorglub"]; ws.Missed != 1 || !reflect.DeepEqual(ws.Contexts, []string{text}) {
+		t.Errorf("zorglub: %+v", ws)
+	}
+}
+
+func TestCoverageStatsAddUnknown(t *testing.T) {
+	// The scanner matched zorglub through a key the matcher cannot find:
+	// it is phonetized, but counted apart from the main dictionary.
+	text := "chat zorglub"
+	res := scanResult{Result: g2p.Result{Fragments: []g2p.Fragment{
+		{Pos: 0, Phonetized: "ʃa"},
+		{Pos: 5, Phonetized: "zɔʁɡlyb"},
+	}}}
+	newMatcher(phono.Dictionary{"chat": {"ʃa"}}, nil).resolve(&res, text)
+
+	c := newCoverageStats()
+	c.add(buildTokenResult(text, res))
+	want := map[string]int{classMain: 1, classUnknown: 1}
+	if !reflect.DeepEqual(c.Tokens, want) {
+		t.Errorf("Tokens = %v, want %v", c.Tokens, want)
+	}
+	if ws := c.Words["zorglub"]; ws.Class != classUnknown || ws.Missed != 0 {
+		t.Errorf("zorglub: %+v", ws)
+	}
+}
+
+func TestCoverageStatsMerge(t *testing.T) {
+	a := &coverageStats{
+		Files:  2,
+		Tokens: map[string]int{classMain: 3, classMissed: 2},
+		Words: map[string]*wordStat{
+			"chat":    {Count: 3, Class: classMain},
+			"zorglub": {Count: 2, Missed: 2, Class: classMissed, Contexts: []string{"a", "b"}},
+		},
+	}
+	b := &coverageStats{
+		Files:  1,
+		Failed: 1,
+		Tokens: map[string]int{classFinal: 1, classMissed: 3},
+		Words: map[string]*wordStat{
+			"chien":   {Count: 1, Class: classFinal},
+			"zorglub": {Count: 3, Missed: 2, Class: classTolerant, Contexts: []string{"b", "c", "d"}},
+		},
+	}
+	total := newCoverageStats()
+	total.merge(a)
+	total.merge(b)
+
+	if total.Files != 3 || total.Failed != 1 {
+		t.Errorf("Files, Failed = %d, %d; want 3, 1", total.Files, total.Failed)
+	}
+	wantTokens := map[string]int{classMain: 3, classFinal: 1, classMissed: 5}
+	if !reflect.DeepEqual(total.Tokens, wantTokens) {
+		t.Errorf("Tokens = %v, want %v", total.Tokens, wantTokens)
+	}
+	// A word missed in one file and covered in another takes the covered
+	// class; its contexts are deduplicated and capped.
+	want := &wordStat{Count: 5, Missed: 4, Class: classTolerant, Contexts: []string{"a", "b", "c"}}
+	if got := total.Words["zorglub"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("zorglub = %+v, want %+v", got, want)
+	}
+	// Merging does not share the word statistics of its input.
+	if total.Words["chat"] == a.Words["chat"] {
+		t.Error("merged word statistics alias their input")
+	}
+	if got := total.oov(); !reflect.DeepEqual(got, []string{"zorglub"}) {
+		t.Errorf("oov = %v", got)
+	}
+}
+
+func TestWriteCoverageReport(t *testing.T) {
+	c := &coverageStats{
+		Files:  3,
+		Failed: 1,
+		Tokens: map[string]int{classMain: 6, classFinal: 2, classTolerant: 1, classMissed: 1},
+		Words: map[string]*wordStat{
+			"chat":    {Count: 6, Class: classMain},
+			"chien":   {Count: 2, Class: classFinal},
+			"garcon":  {Count: 1, Class: classTolerant},
+			"zorglub": {Count: 1, Missed: 1, Class: classMissed},
+		},
+	}
+	var buf strings.Builder
+	writeCoverageReport(&buf, c, 5)
+	want := strings.Join([]string{
+		"Files: 3 (failed: 1)",
+		"Tokens: 10, covered: 9 (90.00%)",
+		"  main:     6\t60.00%",
+		"  final:    2\t20.00%",
+		"  tolerant: 1\t10.00%",
+		"  unknown:  0\t0.00%",
+		"  missed:   1\t10.00%",
+		"Types: 4, covered: 3 (75.00%)",
+		"  main:     1\t25.00%",
+		"  final:    1\t25.00%",
+		"  tolerant: 1\t25.00%",
+		"  unknown:  0\t0.00%",
+		"  missed:   1\t25.00%",
+		"Top 1 missed words (of 1):",
+		"  1\tzorglub",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("report =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// An empty corpus is fully covered, and --top 0 hides the list.
+	buf.Reset()
+	writeCoverageReport(&buf, newCoverageStats(), 0)
+	if got := buf.String(); !strings.HasPrefix(got, "Files: 0 (failed: 0)\nTokens: 0, covered: 0 (100.00%)\n") || strings.Contains(got, "Top") {
+		t.Errorf("empty report =\n%s", got)
+	}
+}
+
+func TestCoverFileWarnings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "talk.srt")
+	srt := "1\n00:00:01,000 --> 00:00:02,000\ngarcon\n\n2\n00:00:03,000 --> 00:00:04,000\nle garcon et le chat\n"
+	if err := os.WriteFile(path, []byte(srt), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := coverageSession()
+	s.format = formatAuto
+	s.report = true
+	s.source = path
+
+	c := newCoverageStats()
+	var warn strings.Builder
+	if err := s.coverFile(path, c, &warn); err != nil {
+		t.Fatal(err)
+	}
+	// One summary for the file, not one line per cue.
+	want := "phonetize: " + path + ": diacritic-insensitive matches: 2 of 3 fragments\n"
+	if warn.String() != want {
+		t.Errorf("warnings = %q, want %q", warn.String(), want)
+	}
+	if s.warnings != nil {
+		t.Error("warnings still collected after the file")
+	}
+	if c.Tokens[classTolerant] != 2 || c.Tokens[classMain] != 1 || c.Tokens[classMissed] != 3 {
+		t.Errorf("Tokens = %v", c.Tokens)
+	}
+}
@@ -0,0 +1,14 @@
+module phonetize
+
+go 1.25
+
+require (
+	github.com/temporal-IPA/tipa v1.0.0
+	golang.org/x/net v0.47.0
+	golang.org/x/text v0.31.0
+	ipadict v0.0.0
+)
+
+// The shared packages (ipadict/alphabet, ipadict/remote, ipadict/wordkey)
+// come from the sibling module.
+replace ipadict => ../ipadict
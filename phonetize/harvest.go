@@ -0,0 +1,111 @@
+package main
+
+// Missed word harvesting (phonetize coverage --harvest-oov).
+//
+// The words left as RawText in the corpus are written as a stub
+// dictionary in the native ipadict text format, most frequent first, so
+// that linguists can fill it in and feed it back with ipadict --preload:
+//
+//	# ipadict curation stub
+//	# ...
+//	# zorglub (12): "…les amis du zorglub et…" | "…"
+//	zorglub<TAB>
+//
+// Only words made of letters are kept (apostrophes and hyphens are allowed
+// inside a word); numbers and symbols are left out. Pronunciations are left
+// empty, or with --harvest-guess set to the transcription of the word
+// case-folded and ignoring diacritics when the dictionaries cover it all
+// ("Bonjour", "porte-avions"). ipadict recognizes the stub by its first
+// line, stubHeader, and then skips the comment lines and the entries still
+// without pronunciation.
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// stubHeader is the first line of a stub dictionary
+// (curationStubHeader in ipadict/source.go).
+const stubHeader = "# ipadict curation stub"
+
+// isHarvestable reports whether word is made of letters, with apostrophes
+// and hyphens only between them.
+func isHarvestable(word string) bool {
+	runes := []rune(word)
+	if len(runes) == 0 || !unicode.IsLetter(runes[0]) {
+		return false
+	}
+	for i, r := range runes {
+		switch {
+		case unicode.IsLetter(r), unicode.IsMark(r):
+		case (r == '\'' || r == '-') && i < len(runes)-1 && runes[i+1] != '\'' && runes[i+1] != '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// guessPronunciation returns the transcription of word looked up
+// case-folded and ignoring diacritics, or "" when some letters are left
+// uncovered.
+func (s *session) guessPronunciation(word string) string {
+	scanned, _ := s.keys.Text(strings.ToLower(word))
+	res := scanWithPhrases(s.det, s.index, scanned, true)
+	if len(res.Fragments) == 0 {
+		return ""
+	}
+	for _, rt := range res.RawTexts {
+		if strings.IndexFunc(rt.Text, unicode.IsLetter) >= 0 {
+			return ""
+		}
+	}
+	var b strings.Builder
+	for _, f := range res.Fragments {
+		b.WriteString(string(f.Phonetized))
+	}
+	return b.String()
+}
+
+// writeHarvest writes the missed words of c to path as a stub dictionary,
+// with guessed pronunciations when guess is set.
+func (s *session) writeHarvest(path string, c *coverageStats, guess bool) error {
+	var words []string
+	for _, word := range c.oov() {
+		if isHarvestable(word) {
+			words = append(words, word)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	fmt.Fprintln(bw, stubHeader)
+	fmt.Fprintf(bw, "# Missed words: %d, most frequent first, with sample contexts.\n", len(words))
+	fmt.Fprintln(bw, "# Fill in the pronunciations (IPA, alternatives separated by \" | \") and")
+	fmt.Fprintln(bw, "# load the file with ipadict --preload; empty entries are skipped.")
+	fmt.Fprintln(bw, "# Keep the first line: it tells ipadict to skip them.")
+	for _, word := range words {
+		ws := c.Words[word]
+		quoted := make([]string, len(ws.Contexts))
+		for i, ctx := range ws.Contexts {
+			quoted[i] = fmt.Sprintf("%q", ctx)
+		}
+		pron := ""
+		if guess {
+			pron = s.guessPronunciation(word)
+		}
+		fmt.Fprintf(bw, "# %s (%d): %s\n", word, ws.Missed, strings.Join(quoted, " | "))
+		fmt.Fprintf(bw, "%s\t%s\n", word, pron)
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsHarvestable(t *testing.T) {
+	tests := []struct {
+		word string
+		want bool
+	}{
+		{"zorglub", true},
+		{"Élodie", true},
+		{"aujourd'hui", true},
+		{"porte-avions", true},
+		{"", false},
+		{"42", false},
+		{"mp3", false},
+		{"-avions", false},
+		{"porte-", false},
+		{"porte--avions", false},
+		{"l'", false},
+	}
+	for _, tt := range tests {
+		if got := isHarvestable(tt.word); got != tt.want {
+			t.Errorf("isHarvestable(%q) = %v, want %v", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestWriteHarvest(t *testing.T) {
+	s := coverageSession()
+	c := newCoverageStats()
+	for _, text := range []string{"le Chat et zorglub", "zorglub 42 zorglub"} {
+		tr, _, err := s.tokens(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.add(tr)
+	}
+
+	for _, guess := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "stub.txt")
+		if err := s.writeHarvest(path, c, guess); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(string(data), "\n")
+		// ipadict only strips the comments of files starting with the header.
+		if lines[0] != stubHeader {
+			t.Fatalf("first line = %q, want %q", lines[0], stubHeader)
+		}
+		var entries []string
+		for _, line := range lines {
+			if line != "" && !strings.HasPrefix(line, "#") {
+				entries = append(entries, line)
+			}
+		}
+		want := []string{"zorglub\t", "Chat\t", "et\t", "le\t"}
+		if guess {
+			want[1] = "Chat\tʃa"
+		}
+		if strings.Join(entries, "\n") != strings.Join(want, "\n") {
+			t.Errorf("guess %v: entries = %q, want %q", guess, entries, want)
+		}
+		if !strings.Contains(string(data), "# zorglub (3): \"le Chat et zorglub\" | \"zorglub 42 zorglub\"\n") {
+			t.Errorf("guess %v: no contexts for zorglub in\n%s", guess, data)
+		}
+	}
+}
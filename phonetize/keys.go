@@ -0,0 +1,81 @@
+package main
+
+// Word-key normalization.
+//
+// The key policy of ipadict (--key-form, --unify-punct, --case, see package
+// wordkey) is applied here at lookup time: the dictionaries are re-keyed
+// with the policy when they are loaded, and the input text is normalized
+// the same way before the scan, so that "aujourd’hui" finds an
+// "aujourd'hui" entry and "PARIS" finds "Paris".
+//
+// Positions refer to the Unicode-normalized input: with --key-form nfc or
+// nfd, Fragment and RawText positions, and the offsets of the tokens
+// output, count the runes of the normalized text, which is the surface text
+// returned by session.scan. Punctuation unification and case folding keep
+// the number of runes, so they do not move positions.
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/temporal-IPA/tipa/pkg/g2p"
+	"github.com/temporal-IPA/tipa/pkg/phono"
+
+	"ipadict/wordkey"
+)
+
+// prepareDictionary re-keys dict with the policy k, exactly like ipadict
+// does at build time. With "fold-proper", the input is not case-folded, so
+// the sentence-initial and upper-case spellings of every key are added as
+// well ("bonjour" also answers "Bonjour" and "BONJOUR") unless the
+// dictionary already has them.
+func prepareDictionary(k wordkey.Policy, dict phono.Dictionary) phono.Dictionary {
+	if dict == nil || !k.Enabled() {
+		return dict
+	}
+	out := wordkey.Rekey(dict, wordkey.KeyMap(k, dict))
+	if k.Case == "fold-proper" {
+		for _, key := range sortedKeys(out) {
+			for _, variant := range []string{upperFirst(key), strings.ToUpper(key)} {
+				if _, ok := out[variant]; !ok {
+					out[variant] = out[key]
+				}
+			}
+		}
+	}
+	return out
+}
+
+// upperFirst returns word with its first rune upper-cased, as at the start
+// of a sentence ("pomme de terre" -> "Pomme de terre").
+func upperFirst(word string) string {
+	first, size := utf8.DecodeRuneInString(word)
+	if size == 0 {
+		return word
+	}
+	return string(unicode.ToUpper(first)) + word[size:]
+}
+
+// sortedKeys returns the keys of dict in lexical order.
+func sortedKeys(dict phono.Dictionary) []string {
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// restoreRawTexts replaces the text of every RawText by the corresponding
+// span of surface, undoing the changes made by wordkey.Policy.Text.
+func restoreRawTexts(res *g2p.Result, surface string) {
+	runes := []rune(surface)
+	for i, rt := range res.RawTexts {
+		end := rt.Pos + utf8.RuneCountInString(rt.Text)
+		if rt.Pos >= 0 && end <= len(runes) {
+			res.RawTexts[i].Text = string(runes[rt.Pos:end])
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+
+	"ipadict/wordkey"
+)
+
+func TestPrepareDictionary(t *testing.T) {
+	dict := phono.Dictionary{
+		"PARIS":       {"paʁis"},
+		"Paris":       {"paʁi"},
+		"aujourd’hui": {"oʒuʁdɥi"},
+		"bonjour":     {"bɔ̃ʒuʁ"},
+	}
+	got := prepareDictionary(wordkey.Policy{Unify: true, Case: "fold-proper"}, dict)
+	want := phono.Dictionary{
+		"Paris":       {"paʁi", "paʁis"},
+		"PARIS":       {"paʁi", "paʁis"},
+		"aujourd'hui": {"oʒuʁdɥi"},
+		"Aujourd'hui": {"oʒuʁdɥi"},
+		"AUJOURD'HUI": {"oʒuʁdɥi"},
+		"bonjour":     {"bɔ̃ʒuʁ"},
+		"Bonjour":     {"bɔ̃ʒuʁ"},
+		"BONJOUR":     {"bɔ̃ʒuʁ"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("prepareDictionary = %v, want %v", got, want)
+	}
+
+	if got := prepareDictionary(wordkey.Policy{}, dict); !reflect.DeepEqual(got, dict) {
+		t.Error("a no-op policy changed the dictionary")
+	}
+}
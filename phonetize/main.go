@@ -5,7 +5,8 @@ package main
 // This tool is a small wrapper around the g2p.Determinist scanner.
 // It loads one mandatory main dictionary and one optional "final"
 // fallback dictionary, then runs the scanner on either a sentence
-// provided on the command line or the contents of a text file.
+// provided on the command line or the contents of a text file, and prints
+// the result as json, txt, ssml or tokens (--output).
 //
 // Example usage:
 //
@@ -15,42 +16,59 @@ package main
 //     --sentence "Bonjour les amis." \
 //     --output txt
 //
-// The --output flag controls what is printed:
-//
-//   - --output json
-//       Prints the full g2p.Result as JSON (fragments + raw_texts).
-//
-//   - --output txt
-//       Rebuilds a linear textual representation by concatenating, in
-//       order, all fragments and raw texts:
-//         * each Fragment contributes its IPA transcription
-//         * each RawText contributes its original surface Text
-//
-//       This effectively produces an "IPA string with holes": anything
-//       the dictionaries could phonetize is printed as IPA; everything
-//       else is preserved verbatim.
+// See README.md for the output formats, the lookup options, the input
+// formats, batch mode and the repl and coverage subcommands.
 
 import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
 	"github.com/temporal-IPA/tipa/pkg/g2p"
 	"github.com/temporal-IPA/tipa/pkg/phono"
+
+	"ipadict/remote"
 )
 
 // command line flags
 var (
-	flagDictPath      = flag.String("load-dict", "", "path to the main phonetic dictionary (required)")
-	flagFinalDictPath = flag.String("load-final-dict", "", "optional path to the fallback phonetic dictionary")
+	flagDictPath      = flag.String("load-dict", "", "path or HTTP/HTTPS URL of the main phonetic dictionary (required)")
+	flagFinalDictPath = flag.String("load-final-dict", "", "optional path or HTTP/HTTPS URL of the fallback phonetic dictionary")
 	flagFilePath      = flag.String("file", "", "path to a text file to phonetize")
 	flagSentence      = flag.String("sentence", "", "sentence to phonetize (mutually exclusive with --file)")
-	flagOutput        = flag.String("output", "json", "output format: json or txt")
+	flagOutput        = flag.String("output", "json", "output format: json, txt, ssml or tokens")
+	flagLang          = flag.String("lang", "fr", "language of the input, used as xml:lang in SSML output and to check --alphabet")
+	flagAlphabet      = flag.String("alphabet", "ipa", "alphabet of the output pronunciations: ipa, x-sampa, arpabet or kirshenbaum")
+	flagStrictAlpha   = flag.Bool("strict-alphabet", false, "fail on IPA symbols without a mapping in --alphabet instead of keeping them and warning")
+	flagCacheDir      = flag.String("cache-dir", remote.DefaultCacheDir(), "cache directory for dictionaries loaded over HTTP/HTTPS")
+	flagKeyForm       = flag.String("key-form", "", "Unicode normalization of dictionary keys and input: nfc, nfd or none")
+	flagUnifyPunct    = flag.Bool("unify-punct", false, "map typographic apostrophes and hyphens to ASCII in dictionary keys and input")
+	flagCase          = flag.String("case", "preserve", "case policy for lookups: preserve, fold or fold-proper")
+	flagPhrases       = flag.Bool("phrases", true, "match multi-word dictionary entries (longest first) before the word-by-word scan")
+	flagInputDir      = flag.String("input-dir", "", "batch mode: phonetize every file under this directory whose name matches --glob")
+	flagGlob          = flag.String("glob", "", "batch mode: file name pattern under --input-dir (default \"*\"), or path pattern of the files to phonetize")
+	flagOutputDir     = flag.String("output-dir", "", "batch mode: directory of the output files (required in batch mode)")
+	flagJobs          = flag.Int("jobs", runtime.NumCPU(), "batch mode: number of files phonetized in parallel")
+	flagInputFormat   = flag.String("input-format", "auto", "input format: auto (from the file extension), text, srt, vtt, textgrid, html or markdown")
+	flagAnnotate      = flag.String("annotate", "ruby", "IPA insertion for html and markdown input: ruby (<ruby> annotations), data (data-ipa attributes) or replace")
+	flagTop           = flag.Int("top", 20, "coverage mode: number of most frequent missed words listed in the report")
+	flagOOVOutput     = flag.String("oov-output", "", "coverage mode: write every missed word and its count, most frequent first, to this file")
+	flagHarvestOOV    = flag.String("harvest-oov", "", "coverage mode: write the missed words (letters only, most frequent first, with sample contexts) to this file as a stub dictionary for ipadict --preload")
+	flagHarvestGuess  = flag.Bool("harvest-guess", false, "coverage mode: fill the --harvest-oov stub with pronunciations guessed from the dictionaries instead of leaving them empty")
+	flagMatch         = flag.String("match", "tolerant", "diacritic matching: strict, tolerant or tolerant-report (tolerant, and report diacritic-insensitive matches on standard error)")
 )
 
+func init() {
+	// Shorter names of the dictionary flags, as used by "phonetize coverage".
+	flag.StringVar(flagDictPath, "dict", "", "alias of --load-dict")
+	flag.StringVar(flagFinalDictPath, "final-dict", "", "alias of --load-final-dict")
+}
+
 // main is the entry point of the phonetize CLI.
 //
 // It parses command line flags, loads the dictionaries using
@@ -59,6 +77,21 @@ var (
 // over the requested input text.
 func main() {
 	configureUsage()
+	if len(os.Args) > 1 && os.Args[1] == "repl" {
+		// flag.CommandLine exits on parse errors.
+		_ = flag.CommandLine.Parse(os.Args[2:])
+		if err := runREPL(os.Stdin, os.Stdout, stdinIsTerminal()); err != nil {
+			failf("%v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "coverage" {
+		_ = flag.CommandLine.Parse(os.Args[2:])
+		if err := runCoverage(flag.Args(), os.Stdout); err != nil {
+			failf("%v", err)
+		}
+		return
+	}
 	flag.Parse()
 
 	// Validate CLI arguments.
@@ -68,8 +101,16 @@ func main() {
 
 	hasFile := strings.TrimSpace(*flagFilePath) != ""
 	hasSentence := strings.TrimSpace(*flagSentence) != ""
+	batch := strings.TrimSpace(*flagInputDir) != "" || strings.TrimSpace(*flagGlob) != ""
 
-	if hasFile == hasSentence {
+	switch {
+	case batch && (hasFile || hasSentence):
+		failf("--input-dir / --glob cannot be combined with --file or --sentence")
+	case batch && strings.TrimSpace(*flagOutputDir) == "":
+		failf("missing required flag in batch mode: --output-dir <dir>")
+	case batch && *flagJobs < 1:
+		failf("invalid --jobs value %d (must be at least 1)", *flagJobs)
+	case !batch && hasFile == hasSentence:
 		// Either both are set, or neither.
 		failf("you must specify exactly one of --file or --sentence")
 	}
@@ -78,50 +119,54 @@ func main() {
 	if outputMode == "" {
 		outputMode = "json"
 	}
-	if outputMode != "json" && outputMode != "txt" {
-		failf("invalid --output value %q (expected \"json\" or \"txt\")", *flagOutput)
+	switch outputMode {
+	case "json", "txt", "ssml", "tokens":
+	default:
+		failf("invalid --output value %q (expected \"json\", \"txt\", \"ssml\" or \"tokens\")", *flagOutput)
 	}
 
-	// Load the main dictionary (required).
-	mainDict, err := loadDictionaryFromPath(*flagDictPath)
+	s, err := newSession()
 	if err != nil {
-		failf("failed to load main dictionary from %q: %v", *flagDictPath, err)
+		failf("%v", err)
+	}
+	if err := s.load(); err != nil {
+		failf("%v", err)
 	}
 
-	// Load the optional final dictionary (may be nil).
-	var finalDict phono.Dictionary
-	if strings.TrimSpace(*flagFinalDictPath) != "" {
-		finalDict, err = loadDictionaryFromPath(*flagFinalDictPath)
+	if batch {
+		files, err := batchInputs(strings.TrimSpace(*flagInputDir), strings.TrimSpace(*flagGlob))
 		if err != nil {
-			failf("failed to load final dictionary from %q: %v", *flagFinalDictPath, err)
+			failf("%v", err)
+		}
+		if len(files) == 0 {
+			failf("no input files found")
 		}
+		files = runBatch(s, files, outputMode, strings.TrimSpace(*flagOutputDir), min(*flagJobs, len(files)))
+		if failed := writeBatchSummary(os.Stderr, files); failed > 0 {
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Build the Determinist g2p processor.
-	//
-	// The scanner is run in tolerant mode so that diacritics may be
-	// ignored when helpful (e.g. "garcon" vs "garçon").
-	d := g2p.NewDeterminist(mainDict, finalDict)
-
 	inputText, err := readInputText(hasFile, *flagFilePath, *flagSentence)
 	if err != nil {
 		failf("%v", err)
 	}
 
-	result := d.Scan(inputText, true)
-
-	switch outputMode {
-	case "json":
-		if err := printJSONResult(result); err != nil {
-			failf("failed to encode result as JSON: %v", err)
-		}
-	case "txt":
-		text := composeText(result)
-		fmt.Println(text)
-	default:
-		// Should never happen thanks to earlier validation.
-		failf("unsupported output mode %q", outputMode)
+	format := formatText
+	if hasFile {
+		format = detectFormat(s.format, *flagFilePath)
+	} else if s.format != formatAuto {
+		format = s.format
+	}
+	if isDocumentFormat(format) && flagIsSet("output") && outputMode != "txt" {
+		failf("--output %s cannot be used with %s input: subtitles, TextGrids, HTML and Markdown are written back in their own format", outputMode, format)
+	}
+	out, _, _, err := s.renderDocument(format, outputMode, inputText)
+	if err != nil {
+		failf("%v", err)
 	}
+	fmt.Print(out)
 }
 
 // configureUsage installs a custom usage message that documents the
@@ -130,7 +175,15 @@ func configureUsage() {
 	flag.Usage = func() {
 		out := flag.CommandLine.Output()
 		fmt.Fprintln(out, "Usage:")
-		fmt.Fprintln(out, "  phonetize --load-dict <dict path> [--load-final-dict <dict path>] (--file <file path> | --sentence \"text\") [--output json|txt]")
+		fmt.Fprintln(out, "  phonetize --load-dict <dict path or URL> [--load-final-dict <dict path or URL>] (--file <file path> | --sentence \"text\") [--output json|txt|ssml|tokens] [--lang <code>] [--alphabet ipa|x-sampa|arpabet|kirshenbaum [--strict-alphabet]] [--cache-dir <dir>] [--key-form nfc|nfd|none] [--unify-punct] [--case preserve|fold|fold-proper] [--phrases=false] [--match strict|tolerant|tolerant-report] [--input-format auto|text|srt|vtt|textgrid|html|markdown] [--annotate ruby|data|replace]")
+		fmt.Fprintln(out, "  phonetize --load-dict <dict path or URL> (--input-dir <dir> [--glob <name pattern>] | --glob <path pattern>) --output-dir <dir> [--jobs N] [output and lookup flags]")
+		fmt.Fprintln(out, "      Batch mode: phonetizes every input file into --output-dir (same relative path, extension from --output) and prints a coverage summary.")
+		fmt.Fprintln(out, "  phonetize repl --load-dict <dict path or URL> [--load-final-dict <dict path or URL>] [lookup flags]")
+		fmt.Fprintln(out, "      Interactive mode: loads the dictionaries once and phonetizes each line read from standard input.")
+		fmt.Fprintln(out, "      Commands: :json, :strict, :tolerant, :lookup WORD, :reload, :help, :quit")
+		fmt.Fprintln(out, "  phonetize coverage --dict <dict path or URL> [--final-dict <dict path or URL>] [--glob <name pattern>] [--top N] [--oov-output <file>] [--harvest-oov <file> [--harvest-guess]] [--jobs N] [lookup flags] <file or directory>...")
+		fmt.Fprintln(out, "      Coverage mode: scans a corpus and reports the token and type coverage of the dictionaries and the most frequent missed words.")
+		fmt.Fprintln(out, "  --dict and --final-dict are accepted everywhere as aliases of --load-dict and --load-final-dict.")
 		fmt.Fprintln(out)
 		fmt.Fprintln(out, "Flags:")
 		flag.PrintDefaults()
@@ -141,12 +194,21 @@ func configureUsage() {
 // phono.LoadPaths with MergeModeAppend.
 //
 // Each dictionary (main and final) is loaded independently: they are
-// not merged together. The path may be absolute or relative.
+// not merged together. The path may be absolute or relative, or an
+// HTTP/HTTPS URL, in which case the dictionary is downloaded into the
+// --cache-dir directory first (see remote.Fetch).
 func loadDictionaryFromPath(path string) (phono.Dictionary, error) {
 	path = strings.TrimSpace(path)
 	if path == "" {
 		return nil, fmt.Errorf("empty dictionary path")
 	}
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		local, err := remote.Fetch(http.DefaultClient, path, *flagCacheDir)
+		if err != nil {
+			return nil, err
+		}
+		path = local
+	}
 
 	// Normalize the path and split it into (directory, file).
 	//
@@ -182,26 +244,20 @@ func readInputText(hasFile bool, filePath, sentence string) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("failed to read input file %q: %w", filePath, err)
 		}
-		return string(content), nil
+		return decodeTextFile(content), nil
 	}
 	// Direct sentence input.
 	return sentence, nil
 }
 
-// printJSONResult marshals the g2p.Result into indented JSON and
-// writes it to standard output.
-func printJSONResult(res g2p.Result) error {
-	encoded, err := json.MarshalIndent(res, "", "  ")
+// marshalJSON returns v as indented JSON, with a trailing newline for
+// nicer shells.
+func marshalJSON(v any) (string, error) {
+	encoded, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
-		return err
+		return "", err
 	}
-	_, err = os.Stdout.Write(encoded)
-	if err != nil {
-		return err
-	}
-	// Trailing newline for nicer shells.
-	_, err = os.Stdout.Write([]byte("\n"))
-	return err
+	return string(encoded) + "\n", nil
 }
 
 // composeText rebuilds a linear textual representation from a g2p.Result.
@@ -264,6 +320,17 @@ func composeText(res g2p.Result) string {
 	return b.String()
 }
 
+// flagIsSet reports whether the flag name was given on the command line.
+func flagIsSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
 // failf prints a formatted error message to standard error and exits
 // the process with a non-zero status code.
 func failf(format string, args ...any) {
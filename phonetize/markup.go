@@ -0,0 +1,291 @@
+package main
+
+// HTML and Markdown documents (--input-format html|markdown).
+//
+// Only the visible text of a document is phonetized; the markup is copied
+// byte for byte. In HTML, text inside <script>, <style>, <code>, <pre>,
+// <kbd>, <samp>, <textarea>, <template> and the <head> is skipped. In
+// Markdown, code blocks and spans, link destinations, URLs, raw HTML tags,
+// reference definitions, front matter, block and emphasis markers are
+// skipped.
+//
+// --annotate selects how the IPA is inserted:
+//
+//	ruby     <ruby>chat<rt>ʃa</rt></ruby>
+//	data     <span data-ipa="ʃa">chat</span>
+//	replace  the text is replaced by its IPA (txt composition)
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// Annotation styles.
+const (
+	annotateRuby    = "ruby"
+	annotateData    = "data"
+	annotateReplace = "replace"
+)
+
+// validateAnnotate checks an --annotate value.
+func validateAnnotate(style string) error {
+	switch style {
+	case annotateRuby, annotateData, annotateReplace:
+		return nil
+	}
+	return fmt.Errorf("invalid --annotate value %q (expected \"ruby\", \"data\" or \"replace\")", style)
+}
+
+// skippedElements hold no phonetizable text.
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "code": true, "pre": true, "kbd": true,
+	"samp": true, "textarea": true, "template": true, "head": true,
+	"noscript": true, "svg": true, "math": true,
+}
+
+// annotate phonetizes text and returns it with the IPA inserted in the
+// session annotation style, and its word coverage. The text of the
+// document, annotated or not, is copied as written, so that character
+// references such as &nbsp; survive. With escaped, text is the raw content
+// of an HTML text node: it is decoded for the scan, and the IPA replacing
+// it is escaped too.
+func (s *session) annotate(text string, escaped bool) (string, int, int, error) {
+	if strings.TrimSpace(text) == "" {
+		return text, 0, 0, nil
+	}
+	decoded, offsets := text, []int(nil)
+	if escaped {
+		decoded, offsets = unescapeOffsets(text)
+	}
+	res, surface, _, err := s.scan(decoded)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	words, covered := wordCoverage(res, surface)
+
+	// source returns the runes [start, end) of the surface text as
+	// written in the document. A --key-form normalization that changed
+	// the text breaks the mapping: the surface text is escaped instead.
+	runes := []rune(surface)
+	source := func(start, end int) string {
+		switch {
+		case surface != decoded:
+			if escaped {
+				return html.EscapeString(string(runes[start:end]))
+			}
+			return string(runes[start:end])
+		case offsets != nil:
+			return text[offsets[start]:offsets[end]]
+		}
+		return string(runes[start:end])
+	}
+
+	var b strings.Builder
+	prev := 0
+	for _, f := range fragmentSpans(res) {
+		if f.RuneStart < prev || f.RuneEnd > len(runes) {
+			continue
+		}
+		b.WriteString(source(prev, f.RuneStart))
+		word, ipa := source(f.RuneStart, f.RuneEnd), html.EscapeString(f.IPA)
+		switch s.annotation {
+		case annotateReplace:
+			if !escaped {
+				ipa = f.IPA
+			}
+			b.WriteString(ipa)
+		case annotateData:
+			fmt.Fprintf(&b, `<span data-ipa="%s">%s</span>`, ipa, word)
+		default:
+			fmt.Fprintf(&b, "<ruby>%s<rt>%s</rt></ruby>", word, ipa)
+		}
+		prev = f.RuneEnd
+	}
+	b.WriteString(source(prev, len(runes)))
+	return b.String(), words, covered, nil
+}
+
+// htmlEntity matches a character reference at the start of a string.
+var htmlEntity = regexp.MustCompile(`^&(?:#[0-9]+|#[xX][0-9a-fA-F]+|[A-Za-z][A-Za-z0-9]*);?`)
+
+// unescapeOffsets decodes the character references of an HTML text node.
+// It returns the decoded text and, for every rune of it, the byte offset
+// in raw of the character reference or rune it comes from, followed by
+// len(raw). The runes of a reference that decodes to several runes all
+// point at the reference.
+func unescapeOffsets(raw string) (string, []int) {
+	var b strings.Builder
+	var offsets []int
+	for i := 0; i < len(raw); {
+		if raw[i] == '&' {
+			if ref := htmlEntity.FindString(raw[i:]); ref != "" {
+				if dec := html.UnescapeString(ref); dec != ref {
+					for _, r := range dec {
+						b.WriteRune(r)
+						offsets = append(offsets, i)
+					}
+					i += len(ref)
+					continue
+				}
+			}
+		}
+		r, size := utf8.DecodeRuneInString(raw[i:])
+		b.WriteRune(r)
+		offsets = append(offsets, i)
+		i += size
+	}
+	return b.String(), append(offsets, len(raw))
+}
+
+// htmlParts splits an HTML document into its visible text nodes and the
+// markup, both copied byte for byte: text nodes keep their character
+// references (see annotate).
+func htmlParts(doc string) ([]docPart, error) {
+	z := xhtml.NewTokenizer(strings.NewReader(doc))
+	var parts []docPart
+	skip := 0
+	for {
+		tt := z.Next()
+		switch tt {
+		case xhtml.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			return parts, nil
+		case xhtml.StartTagToken, xhtml.EndTagToken:
+			name, _ := z.TagName()
+			if skippedElements[string(name)] {
+				if tt == xhtml.StartTagToken {
+					skip++
+				} else if skip > 0 {
+					skip--
+				}
+			}
+		case xhtml.TextToken:
+			if skip == 0 {
+				parts = append(parts, docPart{Text: string(z.Raw()), Phonetize: true})
+				continue
+			}
+		}
+		parts = append(parts, docPart{Text: string(z.Raw())})
+	}
+}
+
+// renderHTML phonetizes the visible text nodes of an HTML document.
+func (s *session) renderHTML(doc string) (string, int, int, error) {
+	parts, err := htmlParts(doc)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return renderParts(parts, func(text string) (string, int, int, error) {
+		return s.annotate(text, true)
+	})
+}
+
+// Markdown syntax kept verbatim.
+var (
+	mdBlockMarker = regexp.MustCompile(`^[ \t]*(?:(?:#{1,6}|>|[-*+]|\d+[.)])[ \t]+|>)*`)
+	mdRefDef      = regexp.MustCompile(`^[ \t]{0,3}\[[^\]]+\]:[ \t]`)
+	mdFence       = regexp.MustCompile("^[ \t]{0,3}(```+|~~~+)")
+	mdRule        = regexp.MustCompile(`^[ \t]*([-*_=])([ \t]*[-*_=])*[ \t]*$`)
+	mdInline      = regexp.MustCompile("(`+)[^`]*?`+|\\]\\([^)]*\\)|<[^>\\s][^>]*>|https?://[^\\s)>\\]]+|\\{[^}]*\\}")
+	mdListItem    = regexp.MustCompile(`^[ \t]{0,3}(?:[-*+]|\d+[.)])(?:[ \t]|$)`)
+	mdEmphasis    = regexp.MustCompile(`\*+|~~+|_+`)
+)
+
+// emphasisParts splits text around its emphasis markers. Runs of "*" and
+// "~~" are syntax; runs of "_" are too, unless they join two letters or
+// digits, as in snake_case, where Markdown keeps them as text.
+func emphasisParts(text string) []docPart {
+	alnum := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	var parts []docPart
+	prev := 0
+	for _, loc := range mdEmphasis.FindAllStringIndex(text, -1) {
+		if text[loc[0]] == '_' {
+			before, _ := utf8.DecodeLastRuneInString(text[:loc[0]])
+			after, _ := utf8.DecodeRuneInString(text[loc[1]:])
+			if alnum(before) && alnum(after) {
+				continue
+			}
+		}
+		parts = append(parts, docPart{Text: text[prev:loc[0]], Phonetize: true}, docPart{Text: text[loc[0]:loc[1]]})
+		prev = loc[1]
+	}
+	return append(parts, docPart{Text: text[prev:], Phonetize: true})
+}
+
+// markdownParts splits a Markdown document into text and syntax.
+func markdownParts(doc string) []docPart {
+	var parts []docPart
+	lines := strings.SplitAfter(doc, "\n")
+	fence := ""
+	frontMatter := len(lines) > 0 && strings.TrimRight(lines[0], "\r\n") == "---"
+	prevBlank := true
+	// inList is set inside a list, where indented lines after a blank line
+	// continue the item instead of starting a code block.
+	inList := false
+	for i, line := range lines {
+		content := strings.TrimRight(line, "\r\n")
+		verbatim := false
+		switch {
+		case frontMatter:
+			verbatim = true
+			if i > 0 && (content == "---" || content == "...") {
+				frontMatter = false
+			}
+		case fence != "":
+			verbatim = true
+			if strings.HasPrefix(strings.TrimSpace(content), fence) {
+				fence = ""
+			}
+		case mdFence.MatchString(content):
+			verbatim = true
+			fence = mdFence.FindStringSubmatch(content)[1]
+		case prevBlank && !inList && (strings.HasPrefix(content, "    ") || strings.HasPrefix(content, "\t")):
+			// Indented code block; it continues while lines stay indented.
+			verbatim = true
+			parts = append(parts, docPart{Text: line})
+			continue
+		case mdRefDef.MatchString(content), mdRule.MatchString(content):
+			verbatim = true
+		}
+		prevBlank = strings.TrimSpace(content) == ""
+		switch {
+		case mdListItem.MatchString(content):
+			inList = true
+		case !prevBlank && !strings.HasPrefix(content, " ") && !strings.HasPrefix(content, "\t"):
+			inList = false
+		}
+		if verbatim {
+			parts = append(parts, docPart{Text: line})
+			continue
+		}
+
+		marker := mdBlockMarker.FindString(content)
+		parts = append(parts, docPart{Text: marker})
+		rest := content[len(marker):]
+		prev := 0
+		for _, loc := range mdInline.FindAllStringIndex(rest, -1) {
+			parts = append(parts, emphasisParts(rest[prev:loc[0]])...)
+			parts = append(parts, docPart{Text: rest[loc[0]:loc[1]]})
+			prev = loc[1]
+		}
+		parts = append(parts, emphasisParts(rest[prev:])...)
+		parts = append(parts, docPart{Text: line[len(content):]})
+	}
+	return parts
+}
+
+// renderMarkdown phonetizes the text of a Markdown document.
+func (s *session) renderMarkdown(doc string) (string, int, int, error) {
+	return renderParts(markdownParts(doc), func(text string) (string, int, int, error) {
+		return s.annotate(text, false)
+	})
+}
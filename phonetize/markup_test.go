@@ -0,0 +1,140 @@
+package main
+
+import (
+	"html"
+	"strings"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+// markupDict is the dictionary of the markup tests.
+var markupDict = phono.Dictionary{"chat": {"ʃa"}, "chien": {"ʃjɛ̃"}, "l'eau": {"lo"}}
+
+func TestRenderHTMLKeepsEntities(t *testing.T) {
+	tests := []struct {
+		annotation string
+		doc, want  string
+	}{
+		{
+			annotateRuby,
+			"<p>le&nbsp;chat &amp; le chien</p>",
+			"<p>le&nbsp;<ruby>chat<rt>ʃa</rt></ruby> &amp; le <ruby>chien<rt>ʃjɛ̃</rt></ruby></p>",
+		},
+		{
+			// A reference inside an annotated word keeps its raw form.
+			annotateRuby,
+			"<p>l&#39;eau &lt;3</p>",
+			"<p><ruby>l&#39;eau<rt>lo</rt></ruby> &lt;3</p>",
+		},
+		{
+			annotateData,
+			"<p>&laquo;&#160;chat&#xA0;&raquo;</p>",
+			`<p>&laquo;&#160;<span data-ipa="ʃa">chat</span>&#xA0;&raquo;</p>`,
+		},
+		{
+			annotateReplace,
+			"<p>le&nbsp;chat &amp; AT&T</p>",
+			"<p>le&nbsp;ʃa &amp; AT&T</p>",
+		},
+	}
+	for _, tt := range tests {
+		s := testSession(markupDict, nil)
+		s.annotation = tt.annotation
+		got, _, _, err := s.renderHTML(tt.doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: renderHTML(%q) =\n%q, want\n%q", tt.annotation, tt.doc, got, tt.want)
+		}
+	}
+}
+
+func TestUnescapeOffsets(t *testing.T) {
+	raw := "a&nbsp;b&amp c&unknown; é&#x263A;"
+	text, offsets := unescapeOffsets(raw)
+	if want := "a b& c&unknown; é☺"; text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+	runes := []rune(text)
+	if len(offsets) != len(runes)+1 || offsets[len(runes)] != len(raw) {
+		t.Fatalf("%d offsets for %d runes", len(offsets), len(runes))
+	}
+	// Every rune maps back to its source: a reference decodes to the rune.
+	for i, r := range runes {
+		if got := []rune(html.UnescapeString(raw[offsets[i]:offsets[i+1]])); len(got) != 1 || got[0] != r {
+			t.Errorf("rune %d %q comes from %q", i, r, raw[offsets[i]:offsets[i+1]])
+		}
+	}
+}
+
+func TestMarkdownParts(t *testing.T) {
+	doc := strings.Join([]string{
+		"- un **chat** et un _chien_",
+		"",
+		"    le chat, suite de l'élément",
+		"",
+		"un paragraphe avec snake_case et ~~chien~~",
+		"",
+		"    code chat",
+		"",
+	}, "\n")
+	var text, verbatim []string
+	for _, p := range markdownParts(doc) {
+		if p.Text == "" {
+			continue
+		}
+		if p.Phonetize {
+			text = append(text, p.Text)
+		} else {
+			verbatim = append(verbatim, p.Text)
+		}
+	}
+	joined := strings.Join(text, "|")
+	for _, want := range []string{"chat", "chien", "le chat, suite de l'élément", "un paragraphe avec snake_case et "} {
+		if !containsPart(text, want) {
+			t.Errorf("%q not phonetized in %q", want, joined)
+		}
+	}
+	for _, want := range []string{"**", "_", "~~", "    code chat\n"} {
+		if !containsPart(verbatim, want) {
+			t.Errorf("%q not verbatim in %q", want, verbatim)
+		}
+	}
+	if strings.ContainsAny(joined, "*~") || strings.Contains(joined, "code") {
+		t.Errorf("syntax phonetized: %q", joined)
+	}
+
+	// The parts add up to the document.
+	var b strings.Builder
+	for _, p := range markdownParts(doc) {
+		b.WriteString(p.Text)
+	}
+	if b.String() != doc {
+		t.Errorf("parts join to %q, want %q", b.String(), doc)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	s := testSession(markupDict, nil)
+	s.annotation = annotateReplace
+	doc := "1. le **chat**\n\n   le chien\n\nfin\n\n    code chat\n"
+	got, _, _, err := s.renderMarkdown(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1. le **ʃa**\n\n   le ʃjɛ̃\n\nfin\n\n    code chat\n"; got != want {
+		t.Errorf("renderMarkdown = %q, want %q", got, want)
+	}
+}
+
+// containsPart reports whether parts has an element equal to want.
+func containsPart(parts []string, want string) bool {
+	for _, p := range parts {
+		if p == want {
+			return true
+		}
+	}
+	return false
+}
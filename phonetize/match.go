@@ -0,0 +1,240 @@
+package main
+
+// Match reporting (--match).
+//
+// In tolerant mode the scanner may ignore diacritics to find a word
+// ("garcon" answers "garçon"), which also produces wrong matches in
+// languages where diacritics tell words apart ("ou" vs "où", "a" vs "à").
+// The g2p.Result does not say which key matched, nor where a fragment
+// ends, so both are recovered right after the scan, from the text of each
+// fragment and its IPA: an exact dictionary key with that pronunciation,
+// or else such a key that is equal to the text once diacritics are
+// removed, in which case the fragment is flagged as a fallback. The
+// dictionary holding the key is recorded at the same time.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/temporal-IPA/tipa/pkg/g2p"
+	"github.com/temporal-IPA/tipa/pkg/phono"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Match modes.
+const (
+	matchStrict         = "strict"
+	matchTolerant       = "tolerant"
+	matchTolerantReport = "tolerant-report"
+)
+
+// validateMatch checks a --match value.
+func validateMatch(mode string) error {
+	switch mode {
+	case matchStrict, matchTolerant, matchTolerantReport:
+		return nil
+	}
+	return fmt.Errorf("invalid --match value %q (expected \"strict\", \"tolerant\" or \"tolerant-report\")", mode)
+}
+
+// matchInfo tells which dictionary key produced a fragment. When no key
+// matches the text of the fragment, as is or without diacritics, the key
+// is unknown rather than guessed.
+type matchInfo struct {
+	Key      string `json:"key,omitempty"`
+	Fallback bool   `json:"fallback"`          // matched by ignoring diacritics
+	Unknown  bool   `json:"unknown,omitempty"` // no key matches the text of the fragment
+}
+
+// matcher recovers the dictionary keys of fragments.
+type matcher struct {
+	dicts  []phono.Dictionary
+	once   sync.Once
+	folded map[string][]string // key without diacritics -> keys, built on first use
+}
+
+// newMatcher returns a matcher over the given dictionaries, in lookup
+// order. Nil dictionaries are skipped.
+func newMatcher(dicts ...phono.Dictionary) *matcher {
+	m := &matcher{}
+	for _, d := range dicts {
+		if d != nil {
+			m.dicts = append(m.dicts, d)
+		}
+	}
+	return m
+}
+
+// lookup returns the key that text, phonetized as ipa, was matched with,
+// and the index of the dictionary holding it, in lookup order. A key only
+// matches when ipa is one of its pronunciations: text itself, or else a
+// key equal to text without diacritics, the first in order when several
+// qualify ("côte" and "coté" both answer "cote", their IPA tells them
+// apart). When no key matches, the match is unknown and the index -1.
+func (m *matcher) lookup(text, ipa string) (matchInfo, int) {
+	for i, d := range m.dicts {
+		if slices.Contains(d[text], ipa) {
+			return matchInfo{Key: text}, i
+		}
+	}
+	m.once.Do(func() {
+		m.folded = make(map[string][]string)
+		for _, d := range m.dicts {
+			for key := range d {
+				f := stripDiacritics(key)
+				m.folded[f] = append(m.folded[f], key)
+			}
+		}
+		for _, keys := range m.folded {
+			sort.Strings(keys)
+		}
+	})
+	for _, key := range m.folded[stripDiacritics(text)] {
+		for i, d := range m.dicts {
+			if slices.Contains(d[key], ipa) {
+				return matchInfo{Key: key, Fallback: true}, i
+			}
+		}
+	}
+	return matchInfo{Unknown: true}, -1
+}
+
+// stripDiacritics removes the combining marks of s ("garçon" -> "garcon").
+func stripDiacritics(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return norm.NFC.String(b.String())
+}
+
+// fragmentMatch is what phonetize knows about a fragment of a scan beyond
+// the g2p.Fragment: where its text ends, and the entry it was matched with.
+type fragmentMatch struct {
+	End  int // rune offset just past the text of the fragment
+	Dict int // index of the dictionary of the entry, in lookup order, or -1
+	matchInfo
+}
+
+// resolve records the match of every fragment of res, scanned from text,
+// in res.Matches. Phrases carry their own. The scanner only reports where
+// the other fragments start: their text is the longest run of words from
+// there, before the next segment, that is a dictionary key, as is or
+// without diacritics.
+func (m *matcher) resolve(res *scanResult, text string) {
+	runes := []rune(text)
+	starts := make([]int, 0, len(res.Fragments)+len(res.RawTexts))
+	for _, f := range res.Fragments {
+		starts = append(starts, f.Pos)
+	}
+	for _, rt := range res.RawTexts {
+		starts = append(starts, rt.Pos)
+	}
+	sort.Ints(starts)
+
+	res.Matches = make([]fragmentMatch, len(res.Fragments))
+	for i, f := range res.Fragments {
+		if sp := res.phrase(i); sp != nil {
+			res.Matches[i] = fragmentMatch{End: sp.End, Dict: sp.Dict, matchInfo: matchInfo{Key: sp.Key, Fallback: sp.Fallback}}
+			continue
+		}
+		start := min(max(f.Pos, 0), len(runes))
+		bound := len(runes)
+		if j := sort.SearchInts(starts, f.Pos+1); j < len(starts) {
+			bound = max(start, min(starts[j], bound))
+		}
+		res.Matches[i] = m.resolveWord(runes, start, bound, string(f.Phonetized))
+	}
+}
+
+// resolveWord matches the fragment of runes starting at start, which ends
+// at bound at the latest and was phonetized as ipa.
+func (m *matcher) resolveWord(runes []rune, start, bound int, ipa string) fragmentMatch {
+	words := tokenizeWords(runes[start:bound])
+	if len(words) > 0 && words[0].Start == 0 {
+		for j := len(words) - 1; j >= 0; j-- {
+			end := start + words[j].End
+			if info, dict := m.lookup(string(runes[start:end]), ipa); dict >= 0 {
+				return fragmentMatch{End: end, Dict: dict, matchInfo: info}
+			}
+		}
+	}
+	text := strings.TrimRightFunc(string(runes[start:bound]), unicode.IsSpace)
+	info, dict := m.lookup(text, ipa)
+	return fragmentMatch{End: start + utf8.RuneCountInString(text), Dict: dict, matchInfo: info}
+}
+
+// jsonFragment is a g2p.Fragment with the key it was matched with.
+type jsonFragment struct {
+	g2p.Fragment
+	matchInfo
+}
+
+// MarshalJSON encodes the fragment as g2p does, with the fields of its
+// match added. Spelling it out keeps a MarshalJSON method of g2p.Fragment
+// from being promoted and leaving the match out.
+func (f jsonFragment) MarshalJSON() ([]byte, error) {
+	frag, err := json.Marshal(f.Fragment)
+	if err != nil {
+		return nil, err
+	}
+	info, err := json.Marshal(f.matchInfo)
+	if err != nil {
+		return nil, err
+	}
+	frag = bytes.TrimSpace(frag)
+	if len(frag) < 2 || frag[0] != '{' || frag[len(frag)-1] != '}' {
+		return nil, fmt.Errorf("fragment at %d is not encoded as a JSON object: %s", f.Pos, frag)
+	}
+	var b bytes.Buffer
+	b.Write(frag[:len(frag)-1])
+	if len(frag) > 2 {
+		b.WriteByte(',')
+	}
+	b.Write(info[1:])
+	return b.Bytes(), nil
+}
+
+// jsonResult is the document printed by --output json: the g2p.Result
+// with match information on every fragment.
+type jsonResult struct {
+	Fragments []jsonFragment `json:"fragments"`
+	RawTexts  []g2p.RawText  `json:"raw_texts"`
+}
+
+// newJSONResult attaches its match information to every fragment of res.
+func newJSONResult(res scanResult) jsonResult {
+	out := jsonResult{RawTexts: res.RawTexts}
+	for i, f := range res.Fragments {
+		out.Fragments = append(out.Fragments, jsonFragment{Fragment: f, matchInfo: res.Matches[i].matchInfo})
+	}
+	return out
+}
+
+// reportFallbacks prints the fragments of res matched by ignoring
+// diacritics, with their text in surface, on lines starting with prefix,
+// and returns their number.
+func reportFallbacks(w io.Writer, prefix string, res scanResult, surface string) int {
+	runes := []rune(surface)
+	n := 0
+	for i, m := range res.Matches {
+		if !m.Fallback {
+			continue
+		}
+		n++
+		f := res.Fragments[i]
+		fmt.Fprintf(w, "%sfallback at %d: %q matched %q /%s/\n",
+			prefix, f.Pos, string(runes[f.Pos:m.End]), m.Key, string(f.Phonetized))
+	}
+	return n
+}
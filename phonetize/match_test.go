@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/g2p"
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+func TestMatcherResolve(t *testing.T) {
+	main := phono.Dictionary{"chat": {"ʃa"}, "garçon": {"ɡaʁsɔ̃"}, "pomme de terre": {"pɔm də tɛʁ"}}
+	final := phono.Dictionary{"chien": {"ʃjɛ̃"}, "pomme": {"pɔm"}}
+	m := newMatcher(main, final)
+
+	// The fragments are not followed by a raw text each: their ends must
+	// not be taken from the next segment.
+	text := "chat  garcon, chien pomme de terre."
+	res := scanResult{Result: g2p.Result{
+		Fragments: []g2p.Fragment{
+			{Pos: 0, Phonetized: "ʃa"},
+			{Pos: 6, Phonetized: "ɡaʁsɔ̃"},
+			{Pos: 14, Phonetized: "ʃjɛ̃"},
+			{Pos: 20, Phonetized: "pɔm də tɛʁ"},
+		},
+		RawTexts: []g2p.RawText{{Pos: 12, Text: ","}, {Pos: 34, Text: "."}},
+	}}
+	m.resolve(&res, text)
+	want := []fragmentMatch{
+		{End: 4, Dict: 0, matchInfo: matchInfo{Key: "chat"}},
+		{End: 12, Dict: 0, matchInfo: matchInfo{Key: "garçon", Fallback: true}},
+		{End: 19, Dict: 1, matchInfo: matchInfo{Key: "chien"}},
+		{End: 34, Dict: 0, matchInfo: matchInfo{Key: "pomme de terre"}},
+	}
+	if !reflect.DeepEqual(res.Matches, want) {
+		t.Errorf("Matches = %+v, want %+v", res.Matches, want)
+	}
+}
+
+func TestMatcherResolvePhrases(t *testing.T) {
+	main := phono.Dictionary{"pomme": {"pɔm"}}
+	final := phono.Dictionary{"pomme de terre": {"pɔm də tɛʁ"}}
+	text := "une pomme de terre"
+	res := scanWithPhrases(g2p.NewDeterminist(main, final), buildPhraseIndex(main, final), text, false)
+	newMatcher(main, final).resolve(&res, text)
+	if len(res.Matches) != 1 {
+		t.Fatalf("Matches = %+v, want one phrase", res.Matches)
+	}
+	want := fragmentMatch{End: 18, Dict: 1, matchInfo: matchInfo{Key: "pomme de terre"}}
+	if res.Matches[0] != want {
+		t.Errorf("phrase match = %+v, want %+v", res.Matches[0], want)
+	}
+}
+
+func TestBuildTokenResultDictionaries(t *testing.T) {
+	main := phono.Dictionary{"chat": {"ʃa"}}
+	final := phono.Dictionary{"chien": {"ʃjɛ̃"}}
+	text := "chat chien"
+	res := scanWithPhrases(g2p.NewDeterminist(main, final), nil, text, false)
+	newMatcher(main, final).resolve(&res, text)
+
+	tr := buildTokenResult(text, res)
+	var got [][2]string
+	for _, f := range tr.Fragments {
+		got = append(got, [2]string{f.Text, f.Dictionary})
+	}
+	want := [][2]string{{"chat", "main"}, {"chien", "final"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fragments = %v, want %v", got, want)
+	}
+}
+
+func TestBuildTokenResultPhrase(t *testing.T) {
+	main := phono.Dictionary{"une": {"yn"}, "cuite": {"kɥit"}}
+	final := phono.Dictionary{"pomme de terre": {"pɔm də tɛʁ"}}
+	text := "une pomme de terre cuite."
+	res := scanWithPhrases(g2p.NewDeterminist(main, final), buildPhraseIndex(main, final), text, false)
+	newMatcher(main, final).resolve(&res, text)
+
+	tr := buildTokenResult(text, res)
+	type tokenIPA struct {
+		Text      string
+		IPA       string
+		Fragments []int
+	}
+	var got []tokenIPA
+	for _, s := range tr.Sentences {
+		for _, tok := range s.Tokens {
+			got = append(got, tokenIPA{tok.Text, tok.IPA, tok.Fragments})
+		}
+	}
+	// The phrase is listed by the tokens it spans, white space included,
+	// and its IPA is carried by its first word.
+	want := []tokenIPA{
+		{"une", "yn", []int{0}},
+		{" ", "", nil},
+		{"pomme", "pɔm də tɛʁ", []int{1}},
+		{" ", "", []int{1}},
+		{"de", "", []int{1}},
+		{" ", "", []int{1}},
+		{"terre", "", []int{1}},
+		{" ", "", nil},
+		{"cuite", "kɥit", []int{2}},
+		{".", "", nil},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokens = %+v, want %+v", got, want)
+	}
+}
+
+func TestMatcherLookup(t *testing.T) {
+	m := newMatcher(
+		phono.Dictionary{"où": {"u"}, "ou": {"u"}, "garçon": {"ɡaʁsɔ̃"}, "côte": {"kot"}, "coté": {"kɔte", "kote"}, "chat": {"ʃa"}},
+		phono.Dictionary{"élève": {"elɛv"}, "chat": {"tʃat"}},
+	)
+	tests := []struct {
+		text, ipa string
+		want      matchInfo
+		dict      int
+	}{
+		{"où", "u", matchInfo{Key: "où"}, 0},
+		{"ou", "u", matchInfo{Key: "ou"}, 0},
+		{"garcon", "ɡaʁsɔ̃", matchInfo{Key: "garçon", Fallback: true}, 0},
+		{"eleve", "elɛv", matchInfo{Key: "élève", Fallback: true}, 1},
+		// Folded homographs: the IPA tells which one the scanner took.
+		{"cote", "kot", matchInfo{Key: "côte", Fallback: true}, 0},
+		{"cote", "kɔte", matchInfo{Key: "coté", Fallback: true}, 0},
+		{"Côte", "kot", matchInfo{Unknown: true}, -1},
+		{"cote", "kɔt", matchInfo{Unknown: true}, -1},
+		// The same key in both dictionaries.
+		{"chat", "tʃat", matchInfo{Key: "chat"}, 1},
+		{"chat", "ʃat", matchInfo{Unknown: true}, -1},
+		{"zorglub", "zɔʁɡlyb", matchInfo{Unknown: true}, -1},
+		{"", "", matchInfo{Unknown: true}, -1},
+	}
+	for _, tt := range tests {
+		if got, dict := m.lookup(tt.text, tt.ipa); got != tt.want || dict != tt.dict {
+			t.Errorf("lookup(%q, %q) = %+v, %d; want %+v, %d", tt.text, tt.ipa, got, dict, tt.want, tt.dict)
+		}
+	}
+}
+
+func TestMatcherResolveHomographs(t *testing.T) {
+	main := phono.Dictionary{"côte": {"kot"}, "coté": {"kɔte"}}
+	text := "cote cote"
+	res := scanResult{Result: g2p.Result{Fragments: []g2p.Fragment{
+		{Pos: 0, Phonetized: "kɔte"},
+		{Pos: 5, Phonetized: "kot"},
+	}}}
+	newMatcher(main, nil).resolve(&res, text)
+	want := []fragmentMatch{
+		{End: 4, Dict: 0, matchInfo: matchInfo{Key: "coté", Fallback: true}},
+		{End: 9, Dict: 0, matchInfo: matchInfo{Key: "côte", Fallback: true}},
+	}
+	if !reflect.DeepEqual(res.Matches, want) {
+		t.Errorf("Matches = %+v, want %+v", res.Matches, want)
+	}
+}
+
+func TestNewJSONResult(t *testing.T) {
+	main := phono.Dictionary{"chat": {"ʃa"}, "garçon": {"ɡaʁsɔ̃"}}
+	text := "chat garcon zorglub"
+	// The scanner matched zorglub through a key the matcher cannot find.
+	res := scanResult{Result: g2p.Result{Fragments: []g2p.Fragment{
+		{Pos: 0, Phonetized: "ʃa"},
+		{Pos: 5, Phonetized: "ɡaʁsɔ̃"},
+		{Pos: 12, Phonetized: "zɔʁɡlyb"},
+	}}}
+	newMatcher(main, nil).resolve(&res, text)
+
+	var got []matchInfo
+	for _, f := range newJSONResult(res).Fragments {
+		got = append(got, f.matchInfo)
+	}
+	want := []matchInfo{{Key: "chat"}, {Key: "garçon", Fallback: true}, {Unknown: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("matches = %+v, want %+v", got, want)
+	}
+	// An unknown match has no key, rather than the text of the fragment.
+	encoded, err := json.Marshal(got[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(encoded) != `{"fallback":false,"unknown":true}` {
+		t.Errorf("unknown match encoded as %s", encoded)
+	}
+
+	tr := buildTokenResult(text, res)
+	if f := tr.Fragments[2]; !f.Unknown || f.Key != "" || f.Dictionary != "" || f.Text != "zorglub" {
+		t.Errorf("unknown token fragment = %+v", f)
+	}
+}
+
+func TestJSONResultRoundTrip(t *testing.T) {
+	main := phono.Dictionary{"chat": {"ʃa"}, "garçon": {"ɡaʁsɔ̃"}}
+	text := "chat, garcon zorglub"
+	res := scanResult{Result: g2p.Result{
+		Fragments: []g2p.Fragment{
+			{Pos: 0, Phonetized: "ʃa"},
+			{Pos: 6, Phonetized: "ɡaʁsɔ̃"},
+			{Pos: 13, Phonetized: "zɔʁɡlyb"},
+		},
+		RawTexts: []g2p.RawText{{Pos: 4, Text: ", "}},
+	}}
+	newMatcher(main, nil).resolve(&res, text)
+
+	encoded, err := json.Marshal(newJSONResult(res))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fragments decode as g2p fragments, and carry their match.
+	var result g2p.Result
+	if err := json.Unmarshal(encoded, &result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, res.Result) {
+		t.Errorf("g2p.Result = %+v, want %+v", result, res.Result)
+	}
+	var matches struct {
+		Fragments []matchInfo `json:"fragments"`
+	}
+	if err := json.Unmarshal(encoded, &matches); err != nil {
+		t.Fatal(err)
+	}
+	want := []matchInfo{{Key: "chat"}, {Key: "garçon", Fallback: true}, {Unknown: true}}
+	if !reflect.DeepEqual(matches.Fragments, want) {
+		t.Errorf("matches = %+v, want %+v in %s", matches.Fragments, want, encoded)
+	}
+}
+
+func TestReportFallbacks(t *testing.T) {
+	main := phono.Dictionary{"garçon": {"ɡaʁsɔ̃"}, "chat": {"ʃa"}}
+	text := "chat garcon"
+	res := scanWithPhrases(g2p.NewDeterminist(main, nil), nil, text, true)
+	newMatcher(main, nil).resolve(&res, text)
+
+	var buf strings.Builder
+	if n := reportFallbacks(&buf, "phonetize: talk.srt: ", res, text); n != 1 {
+		t.Errorf("reported %d fallbacks, want 1", n)
+	}
+	if want := "phonetize: talk.srt: fallback at 5: \"garcon\" matched \"garçon\" /ɡaʁsɔ̃/\n"; buf.String() != want {
+		t.Errorf("report = %q, want %q", buf.String(), want)
+	}
+}
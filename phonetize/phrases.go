@@ -0,0 +1,268 @@
+package main
+
+// Phrase (multi-word) entries.
+//
+// Dictionaries built by ipadict keep locutions such as "pomme de terre" or
+// "New York" as entries whose key contains spaces. Their pronunciation is
+// not the concatenation of the pronunciations of their words, so they are
+// matched before the word-by-word scan: the longest phrase starting at each
+// word wins, and is reported as a single Fragment. In tolerant mode, a
+// phrase may also be found by ignoring diacritics, like words. The text
+// between phrases is scanned by the g2p.Determinist as usual.
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/temporal-IPA/tipa/pkg/g2p"
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+// phrase is a multi-word dictionary entry.
+type phrase struct {
+	Key    string   // the dictionary key
+	Words  []string // the words of the key
+	Folded []string // the words of the key without diacritics
+	Pron   string   // first pronunciation of the entry
+	Dict   int      // index of the dictionary of the entry, in lookup order
+}
+
+// phraseIndex maps the first word of every phrase to the phrases starting
+// with it, longest first, as is and without diacritics.
+type phraseIndex struct {
+	exact  map[string][]phrase
+	folded map[string][]phrase
+}
+
+// phraseSpan is a phrase matched in the input, in rune offsets.
+type phraseSpan struct {
+	Start, End int
+	phrase
+	Fallback bool // matched by ignoring diacritics
+}
+
+// wordToken is a word of the input, in rune offsets.
+type wordToken struct {
+	Start, End int
+	Text       string
+}
+
+// buildPhraseIndex collects the phrase entries of dicts, or returns nil when
+// they have none. When a phrase is present in several dictionaries, the
+// first one wins.
+func buildPhraseIndex(dicts ...phono.Dictionary) *phraseIndex {
+	idx := &phraseIndex{exact: make(map[string][]phrase), folded: make(map[string][]phrase)}
+	seen := make(map[string]bool)
+	for i, dict := range dicts {
+		for key, prons := range dict {
+			words := strings.Fields(key)
+			if len(words) < 2 || len(prons) == 0 {
+				continue
+			}
+			norm := strings.Join(words, " ")
+			if seen[norm] {
+				continue
+			}
+			seen[norm] = true
+			folded := make([]string, len(words))
+			for j, w := range words {
+				folded[j] = stripDiacritics(w)
+			}
+			ph := phrase{Key: key, Words: words, Folded: folded, Pron: prons[0], Dict: i}
+			idx.exact[words[0]] = append(idx.exact[words[0]], ph)
+			idx.folded[folded[0]] = append(idx.folded[folded[0]], ph)
+		}
+	}
+	if len(idx.exact) == 0 {
+		return nil
+	}
+	for _, m := range []map[string][]phrase{idx.exact, idx.folded} {
+		for first, phrases := range m {
+			sort.Slice(phrases, func(i, j int) bool {
+				if len(phrases[i].Words) != len(phrases[j].Words) {
+					return len(phrases[i].Words) > len(phrases[j].Words)
+				}
+				if phrases[i].Dict != phrases[j].Dict {
+					return phrases[i].Dict < phrases[j].Dict
+				}
+				return phrases[i].Key < phrases[j].Key
+			})
+			m[first] = phrases
+		}
+	}
+	return idx
+}
+
+// isWordRune reports whether r belongs to a word: letters, combining marks,
+// digits, apostrophes and hyphens.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || r == '\'' || r == '-'
+}
+
+// tokenizeWords splits runes into word tokens.
+func tokenizeWords(runes []rune) []wordToken {
+	var tokens []wordToken
+	start := -1
+	for i, r := range runes {
+		switch {
+		case isWordRune(r) && start < 0:
+			start = i
+		case !isWordRune(r) && start >= 0:
+			tokens = append(tokens, wordToken{Start: start, End: i, Text: string(runes[start:i])})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, wordToken{Start: start, End: len(runes), Text: string(runes[start:])})
+	}
+	return tokens
+}
+
+// onlySpaces reports whether runes is non-empty and made of white space.
+func onlySpaces(runes []rune) bool {
+	if len(runes) == 0 {
+		return false
+	}
+	for _, r := range runes {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns the phrases found in runes, left to right, without overlap.
+// The words of a phrase must be separated by white space only. The longest
+// phrase starting at a word wins; with tolerant, a phrase whose words only
+// match once diacritics are removed is used when no phrase matches as is.
+func (idx *phraseIndex) match(runes []rune, tolerant bool) []phraseSpan {
+	tokens := tokenizeWords(runes)
+	texts := make([]string, len(tokens))
+	for i, t := range tokens {
+		texts[i] = t.Text
+	}
+	var folded []string
+	if tolerant {
+		folded = make([]string, len(tokens))
+		for i, t := range texts {
+			folded[i] = stripDiacritics(t)
+		}
+	}
+
+	var spans []phraseSpan
+	for i := 0; i < len(tokens); {
+		ph, ok := longestPhrase(runes, tokens, texts, i, idx.exact[texts[i]], false)
+		fallback := false
+		if !ok && tolerant {
+			ph, ok = longestPhrase(runes, tokens, folded, i, idx.folded[folded[i]], true)
+			fallback = ok
+		}
+		if !ok {
+			i++
+			continue
+		}
+		n := len(ph.Words)
+		spans = append(spans, phraseSpan{Start: tokens[i].Start, End: tokens[i+n-1].End, phrase: ph, Fallback: fallback})
+		i += n
+	}
+	return spans
+}
+
+// longestPhrase returns the first of candidates, sorted longest first,
+// whose words are texts[i:], separated by white space only in runes. With
+// folded, texts are compared with the words of the phrases without
+// diacritics.
+func longestPhrase(runes []rune, tokens []wordToken, texts []string, i int, candidates []phrase, folded bool) (phrase, bool) {
+	for _, ph := range candidates {
+		words := ph.Words
+		if folded {
+			words = ph.Folded
+		}
+		n := len(words)
+		if i+n > len(tokens) {
+			continue
+		}
+		ok := true
+		for j := 1; j < n && ok; j++ {
+			ok = texts[i+j] == words[j] &&
+				onlySpaces(runes[tokens[i+j-1].End:tokens[i+j].Start])
+		}
+		if ok {
+			return ph, true
+		}
+	}
+	return phrase{}, false
+}
+
+// scanResult is a g2p.Result with the phrase matched by each fragment and,
+// once resolved by the session matcher (see matcher.resolve), the end and
+// the entry of every fragment.
+type scanResult struct {
+	g2p.Result
+	Phrases []*phraseSpan   // per fragment of Result; nil for words found by the scanner
+	Matches []fragmentMatch // per fragment of Result
+}
+
+// phrase returns the phrase matched by fragment i, or nil.
+func (r scanResult) phrase(i int) *phraseSpan {
+	if i < len(r.Phrases) {
+		return r.Phrases[i]
+	}
+	return nil
+}
+
+// phraseAt returns the phrase matched by the fragment at rune offset pos,
+// or nil.
+func (r scanResult) phraseAt(pos int) *phraseSpan {
+	for _, sp := range r.Phrases {
+		if sp != nil && sp.Start == pos {
+			return sp
+		}
+	}
+	return nil
+}
+
+// scanWithPhrases runs d on text, matching the phrases of idx first. Each
+// phrase becomes one Fragment; the text around phrases is scanned by d and
+// its positions shifted back to offsets in text.
+func scanWithPhrases(d *g2p.Determinist, idx *phraseIndex, text string, tolerant bool) scanResult {
+	if idx == nil {
+		return scanResult{Result: d.Scan(text, tolerant)}
+	}
+	runes := []rune(text)
+	spans := idx.match(runes, tolerant)
+	if len(spans) == 0 {
+		return scanResult{Result: d.Scan(text, tolerant)}
+	}
+
+	var res scanResult
+	prev := 0
+	for i := range spans {
+		sp := &spans[i]
+		appendShifted(&res, d, string(runes[prev:sp.Start]), prev, tolerant)
+		res.Fragments = append(res.Fragments, g2p.Fragment{Pos: sp.Start, Phonetized: sp.Pron})
+		res.Phrases = append(res.Phrases, sp)
+		prev = sp.End
+	}
+	appendShifted(&res, d, string(runes[prev:]), prev, tolerant)
+	return res
+}
+
+// appendShifted scans part, which starts at rune offset pos of the full
+// text, and appends its fragments and raw texts to res.
+func appendShifted(res *scanResult, d *g2p.Determinist, part string, pos int, tolerant bool) {
+	if part == "" {
+		return
+	}
+	r := d.Scan(part, tolerant)
+	for _, f := range r.Fragments {
+		f.Pos += pos
+		res.Fragments = append(res.Fragments, f)
+		res.Phrases = append(res.Phrases, nil)
+	}
+	for _, rt := range r.RawTexts {
+		rt.Pos += pos
+		res.RawTexts = append(res.RawTexts, rt)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/g2p"
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+var phraseDict = phono.Dictionary{
+	"pomme":          {"pɔm"},
+	"de":             {"də"},
+	"terre":          {"tɛʁ"},
+	"cuite":          {"kɥit"},
+	"pomme de":       {"pɔm.də"},
+	"pomme de terre": {"pɔm də tɛʁ"},
+	"de terre":       {"də.tɛʁ"},
+	"à peu près":     {"a pø pʁɛ"},
+	"a peu":          {"a.pø"},
+}
+
+// spanTexts returns the text of every span of runes.
+func spanTexts(runes []rune, spans []phraseSpan) []string {
+	var texts []string
+	for _, sp := range spans {
+		texts = append(texts, string(runes[sp.Start:sp.End]))
+	}
+	return texts
+}
+
+func TestPhraseMatchLongest(t *testing.T) {
+	idx := buildPhraseIndex(phraseDict)
+	tests := []struct {
+		text     string
+		tolerant bool
+		want     []string
+	}{
+		{"une pomme de terre cuite", false, []string{"pomme de terre"}},
+		{"pomme de pomme", false, []string{"pomme de"}},
+		{"pomme de terre de terre", false, []string{"pomme de terre", "de terre"}},
+		// Phrase words are separated by white space only.
+		{"pomme\n de  terre", false, []string{"pomme\n de  terre"}},
+		{"pomme, de terre", false, []string{"de terre"}},
+		{"pommes de terre", false, []string{"de terre"}},
+		// Diacritics are only ignored in tolerant mode, and an exact
+		// phrase wins over a longer one found by ignoring them.
+		{"à peu pres", false, nil},
+		{"à peu pres", true, []string{"à peu pres"}},
+		{"a peu pres", true, []string{"a peu"}},
+	}
+	for _, tt := range tests {
+		runes := []rune(tt.text)
+		got := spanTexts(runes, idx.match(runes, tt.tolerant))
+		if len(got) != len(tt.want) {
+			t.Errorf("%q (tolerant %v): spans = %q, want %q", tt.text, tt.tolerant, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q (tolerant %v): spans = %q, want %q", tt.text, tt.tolerant, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestBuildPhraseIndex(t *testing.T) {
+	if idx := buildPhraseIndex(phono.Dictionary{"chat": {"ʃa"}}, nil); idx != nil {
+		t.Errorf("index without phrases = %+v", idx)
+	}
+
+	// The first dictionary wins.
+	final := phono.Dictionary{"pomme de terre": {"pɔm.də.tɛʁ"}, "New York": {"nju jɔʁk"}}
+	idx := buildPhraseIndex(phraseDict, final)
+	runes := []rune("pomme de terre à New York")
+	spans := idx.match(runes, false)
+	if len(spans) != 2 {
+		t.Fatalf("spans = %+v", spans)
+	}
+	if sp := spans[0]; sp.Key != "pomme de terre" || sp.Pron != "pɔm də tɛʁ" || sp.Dict != 0 || sp.Fallback {
+		t.Errorf("first span = %+v", sp)
+	}
+	if sp := spans[1]; sp.Key != "New York" || sp.Dict != 1 {
+		t.Errorf("second span = %+v", sp)
+	}
+}
+
+func TestScanWithPhrases(t *testing.T) {
+	d := g2p.NewDeterminist(phraseDict, nil)
+	res := scanWithPhrases(d, buildPhraseIndex(phraseDict), "Une pomme de terre cuite.", false)
+
+	want := []g2p.Fragment{
+		{Pos: 4, Phonetized: "pɔm də tɛʁ"},
+		{Pos: 19, Phonetized: "kɥit"},
+	}
+	if len(res.Fragments) != len(want) {
+		t.Fatalf("fragments = %+v", res.Fragments)
+	}
+	for i, f := range want {
+		if res.Fragments[i] != f {
+			t.Errorf("fragment %d = %+v, want %+v", i, res.Fragments[i], f)
+		}
+	}
+	if len(res.Phrases) != len(res.Fragments) {
+		t.Fatalf("phrases = %d, fragments = %d", len(res.Phrases), len(res.Fragments))
+	}
+	if sp := res.phrase(0); sp == nil || sp.Start != 4 || sp.End != 18 || sp.Key != "pomme de terre" {
+		t.Errorf("phrase of the first fragment = %+v", sp)
+	}
+	if sp := res.phrase(1); sp != nil {
+		t.Errorf("phrase of a scanned word = %+v", sp)
+	}
+	if composeText(res.Result) != "Une pɔm də tɛʁ kɥit." {
+		t.Errorf("text = %q", composeText(res.Result))
+	}
+
+	// Without an index, the scanner runs alone.
+	res = scanWithPhrases(d, nil, "pomme de terre", false)
+	if len(res.Fragments) != 3 || res.Phrases != nil {
+		t.Errorf("scan without phrases = %+v", res)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+// Interactive mode ("phonetize repl").
+//
+// The dictionaries are loaded once; every line read from standard input is
+// phonetized and printed as the txt output followed by a breakdown of its
+// fragments, with the dictionary ("main" or "final") that matched each
+// word. Lines starting with ":" are commands:
+//
+//	:json           toggle the --output tokens JSON instead of the breakdown
+//	:strict         exact lookups only
+//	:tolerant       allow diacritic-insensitive lookups (default)
+//	:lookup WORD    print the entries of WORD in both dictionaries
+//	:reload         reload the dictionaries from disk or their URLs
+//	:help           list the commands
+//	:quit           leave (end of input works too)
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+const replHelp = `Type a sentence to phonetize it, or a command:
+  :json          toggle JSON token output
+  :strict        exact lookups only
+  :tolerant      allow diacritic-insensitive lookups
+  :lookup WORD   show the dictionary entries of WORD
+  :reload        reload the dictionaries
+  :help          show this help
+  :quit          leave`
+
+// repl is the state of an interactive session.
+type repl struct {
+	s    *session
+	out  io.Writer
+	json bool
+}
+
+// runREPL loads the dictionaries and serves lines from in until end of
+// input or :quit.
+func runREPL(in io.Reader, out io.Writer, interactive bool) error {
+	if strings.TrimSpace(*flagDictPath) == "" {
+		return fmt.Errorf("missing required flag: --load-dict <dict path>")
+	}
+	s, err := newSession()
+	if err != nil {
+		return err
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+	r := &repl{s: s, out: out}
+	if interactive {
+		fmt.Fprintf(out, "phonetize: %s\n", r.describe())
+		fmt.Fprintln(out, "Type :help for commands.")
+	}
+	return r.serve(in, interactive)
+}
+
+// serve reads lines from in until end of input or :quit. A line that cannot
+// be phonetized is reported on out and the session goes on; only read and
+// write failures end it.
+func (r *repl) serve(in io.Reader, interactive bool) error {
+	out := r.out
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for {
+		if interactive {
+			fmt.Fprint(out, "> ")
+		}
+		if !sc.Scan() {
+			break
+		}
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			if quit := r.command(line); quit {
+				return nil
+			}
+			continue
+		}
+		if err := r.phonetize(line); err != nil {
+			return err
+		}
+	}
+	if interactive {
+		fmt.Fprintln(out)
+	}
+	return sc.Err()
+}
+
+// describe summarizes the loaded dictionaries and the lookup mode.
+func (r *repl) describe() string {
+	desc := fmt.Sprintf("main dictionary %s (%d entries)", r.s.mainPath, len(r.s.mainDict))
+	if r.s.finalDict != nil {
+		desc += fmt.Sprintf(", final dictionary %s (%d entries)", r.s.finalPath, len(r.s.finalDict))
+	}
+	mode := "strict"
+	if r.s.tolerant {
+		mode = "tolerant"
+	}
+	return desc + ", " + mode + " matching"
+}
+
+// command runs a ":" command and reports whether the REPL should stop.
+func (r *repl) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case ":quit", ":q", ":exit":
+		return true
+	case ":help", ":h":
+		fmt.Fprintln(r.out, replHelp)
+	case ":json":
+		r.json = !r.json
+		fmt.Fprintf(r.out, "JSON output: %t\n", r.json)
+	case ":strict":
+		r.s.tolerant = false
+		fmt.Fprintln(r.out, "Strict matching: diacritics must match.")
+	case ":tolerant":
+		r.s.tolerant = true
+		fmt.Fprintln(r.out, "Tolerant matching: diacritics may be ignored.")
+	case ":lookup":
+		if arg == "" {
+			fmt.Fprintln(r.out, "usage: :lookup WORD")
+			break
+		}
+		r.lookup(arg)
+	case ":reload":
+		if err := r.s.load(); err != nil {
+			fmt.Fprintf(r.out, "reload failed: %v\n", err)
+			break
+		}
+		fmt.Fprintf(r.out, "Reloaded %s\n", r.describe())
+	default:
+		fmt.Fprintf(r.out, "unknown command %q (type :help)\n", name)
+	}
+	return false
+}
+
+// lookup prints the entries of word in both dictionaries, looked up with
+// the same key as the scanner would use.
+func (r *repl) lookup(word string) {
+	key, _ := r.s.keys.Text(word)
+	if key != word {
+		fmt.Fprintf(r.out, "key: %s\n", key)
+	}
+	found := false
+	for _, d := range []struct {
+		name string
+		dict phono.Dictionary
+	}{{"main", r.s.mainDict}, {"final", r.s.finalDict}} {
+		if prons, ok := d.dict[key]; ok {
+			fmt.Fprintf(r.out, "%-6s %s\n", d.name+":", strings.Join(prons, " | "))
+			found = true
+		}
+	}
+	if !found {
+		fmt.Fprintf(r.out, "%s: not found\n", word)
+	}
+}
+
+// phonetize prints the txt output of line and its fragment breakdown, or
+// the token JSON when :json is on. A line that cannot be phonetized (with
+// --strict-alphabet, for instance) is reported on r.out; the returned error
+// is a write failure.
+func (r *repl) phonetize(line string) error {
+	tokens, res, err := r.s.tokens(line)
+	if err != nil {
+		_, err = fmt.Fprintf(r.out, "error: %v\n", err)
+		return err
+	}
+	if r.json {
+		encoded, err := marshalJSON(tokens)
+		if err != nil {
+			_, err = fmt.Fprintf(r.out, "error: %v\n", err)
+			return err
+		}
+		_, err = io.WriteString(r.out, encoded)
+		return err
+	}
+	fmt.Fprintln(r.out, composeText(res.Result))
+
+	width := 0
+	for _, f := range tokens.Fragments {
+		width = max(width, utf8.RuneCountInString(f.Text))
+	}
+	for _, sent := range tokens.Sentences {
+		for _, tok := range sent.Tokens {
+			if tok.Kind == tokenWord && len(tok.Fragments) == 0 {
+				width = max(width, utf8.RuneCountInString(tok.Text))
+			}
+		}
+	}
+
+	printed := make(map[int]bool)
+	for _, sent := range tokens.Sentences {
+		for _, tok := range sent.Tokens {
+			if tok.Kind != tokenWord {
+				continue
+			}
+			if len(tok.Fragments) == 0 {
+				fmt.Fprintf(r.out, "  %s  ?  (no match)\n", pad(tok.Text, width))
+				continue
+			}
+			for _, i := range tok.Fragments {
+				if printed[i] {
+					continue
+				}
+				printed[i] = true
+				f := tokens.Fragments[i]
+				source := f.Dictionary
+				switch {
+				case f.Unknown:
+					source = "no dictionary key matches"
+				case f.Fallback:
+					source += ", matched " + f.Key + " ignoring diacritics"
+				}
+				fmt.Fprintf(r.out, "  %s  %s  (%s)\n", pad(f.Text, width), f.IPA, source)
+			}
+		}
+	}
+	return nil
+}
+
+// pad right-pads s with spaces to width runes.
+func pad(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// stdinIsTerminal reports whether standard input is an interactive
+// terminal, in which case the REPL prints a banner and prompts.
+func stdinIsTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
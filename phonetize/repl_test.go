@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+
+	"ipadict/alphabet"
+)
+
+func TestREPLWritesToOut(t *testing.T) {
+	var buf bytes.Buffer
+	r := &repl{s: testSession(phono.Dictionary{"chat": {"ʃa"}}, phono.Dictionary{"chien": {"ʃjɛ̃"}}), out: &buf}
+
+	if err := r.phonetize("chat chien"); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.HasPrefix(out, "ʃa ʃjɛ̃\n") || !strings.Contains(out, "final") {
+		t.Errorf("breakdown = %q", out)
+	}
+
+	buf.Reset()
+	r.command(":json")
+	buf.Reset()
+	if err := r.phonetize("chat"); err != nil {
+		t.Fatal(err)
+	}
+	var tokens tokenResult
+	if err := json.Unmarshal(buf.Bytes(), &tokens); err != nil {
+		t.Fatalf(":json output is not the token JSON: %v\n%s", err, buf.String())
+	}
+	if len(tokens.Fragments) != 1 || tokens.Fragments[0].IPA != "ʃa" {
+		t.Errorf("tokens = %+v", tokens)
+	}
+}
+
+func TestREPLContinuesAfterLineError(t *testing.T) {
+	a, err := alphabet.Lookup("x-sampa", "fr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := testSession(phono.Dictionary{"chat": {"ʃa"}, "rouge": {"ʁuʒ☃"}}, nil)
+	s.alpha = a
+	s.strict = true
+	var buf bytes.Buffer
+	r := &repl{s: s, out: &buf}
+
+	// rouge has a symbol x-sampa cannot map: the line fails, the next one
+	// is still phonetized.
+	if err := r.serve(strings.NewReader("rouge\nchat\n"), false); err != nil {
+		t.Fatalf("serve = %v, want the session to go on", err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "error: ") || !strings.Contains(out, "U+2603") {
+		t.Errorf("no error reported for rouge in %q", out)
+	}
+	if !strings.Contains(out, "\nSa\n") {
+		t.Errorf("chat not phonetized after the error: %q", out)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+// A session holds the dictionaries and lookup options of a phonetize run.
+//
+// The one-shot CLI creates a session, scans its input once and exits; the
+// REPL keeps the session alive across lines, so dictionaries are only
+// loaded again on :reload.
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/temporal-IPA/tipa/pkg/g2p"
+	"github.com/temporal-IPA/tipa/pkg/phono"
+
+	"ipadict/alphabet"
+	"ipadict/wordkey"
+)
+
+// session is a loaded set of dictionaries with the options used to scan
+// text against them.
+type session struct {
+	mainPath   string
+	finalPath  string
+	keys       wordkey.Policy
+	alpha      *alphabet.Alphabet // nil for IPA
+	strict     bool               // fail on symbols without a mapping in alpha
+	lang       string
+	phrases    bool
+	tolerant   bool          // ignore diacritics when a word is not found as is
+	report     bool          // report diacritic-insensitive matches on standard error
+	format     string        // input format: auto, text, srt, vtt, textgrid, html or markdown
+	annotation string        // IPA insertion in HTML and Markdown: ruby, data or replace
+	source     string        // file being processed, named in warnings; "" for a single input
+	warnings   *scanWarnings // when set, scan counts its warnings there instead of printing them
+
+	mainDict  phono.Dictionary
+	finalDict phono.Dictionary
+	det       *g2p.Determinist
+	index     *phraseIndex
+	matcher   *matcher
+}
+
+// newSession validates the lookup flags and returns an unloaded session.
+func newSession() (*session, error) {
+	lang := strings.ToLower(strings.TrimSpace(*flagLang))
+	alpha, err := alphabet.Lookup(*flagAlphabet, lang)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := wordkey.Policy{
+		Form:  strings.ToLower(strings.TrimSpace(*flagKeyForm)),
+		Unify: *flagUnifyPunct,
+		Case:  strings.ToLower(strings.TrimSpace(*flagCase)),
+	}
+	if keys.Form == "none" {
+		keys.Form = ""
+	}
+	if err := keys.Validate(); err != nil {
+		return nil, err
+	}
+
+	match := strings.ToLower(strings.TrimSpace(*flagMatch))
+	if err := validateMatch(match); err != nil {
+		return nil, err
+	}
+
+	format := strings.ToLower(strings.TrimSpace(*flagInputFormat))
+	if err := validateInputFormat(format); err != nil {
+		return nil, err
+	}
+
+	annotation := strings.ToLower(strings.TrimSpace(*flagAnnotate))
+	if err := validateAnnotate(annotation); err != nil {
+		return nil, err
+	}
+
+	return &session{
+		mainPath:   strings.TrimSpace(*flagDictPath),
+		finalPath:  strings.TrimSpace(*flagFinalDictPath),
+		keys:       keys,
+		alpha:      alpha,
+		strict:     *flagStrictAlpha,
+		lang:       strings.TrimSpace(*flagLang),
+		phrases:    *flagPhrases,
+		tolerant:   match != matchStrict,
+		report:     match == matchTolerantReport,
+		format:     format,
+		annotation: annotation,
+	}, nil
+}
+
+// load (re)loads the dictionaries, re-keys them with the lookup policy
+// and builds the scanners.
+func (s *session) load() error {
+	// Load the main dictionary (required).
+	mainDict, err := loadDictionaryFromPath(s.mainPath)
+	if err != nil {
+		return fmt.Errorf("failed to load main dictionary from %q: %w", s.mainPath, err)
+	}
+
+	// Load the optional final dictionary (may be nil).
+	var finalDict phono.Dictionary
+	if s.finalPath != "" {
+		finalDict, err = loadDictionaryFromPath(s.finalPath)
+		if err != nil {
+			return fmt.Errorf("failed to load final dictionary from %q: %w", s.finalPath, err)
+		}
+	}
+
+	// Re-key both dictionaries with the lookup policy.
+	s.mainDict = prepareDictionary(s.keys, mainDict)
+	s.finalDict = prepareDictionary(s.keys, finalDict)
+
+	s.det = g2p.NewDeterminist(s.mainDict, s.finalDict)
+	s.matcher = newMatcher(s.mainDict, s.finalDict)
+	s.index = nil
+	if s.phrases {
+		s.index = buildPhraseIndex(s.mainDict, s.finalDict)
+	}
+	return nil
+}
+
+// scan phonetizes text. It returns the result, resolved, with positions
+// relative to the returned surface text (text in the --key-form
+// normalization), and the text that was actually scanned.
+// Pronunciations are converted to the session alphabet; symbols without a
+// mapping, and diacritic-insensitive matches with --match tolerant-report,
+// are reported on standard error, or counted in s.warnings when it is
+// set. With --strict-alphabet, symbols without a mapping are an
+// *unmappableError instead.
+func (s *session) scan(text string) (res scanResult, surface, scanned string, err error) {
+	scanned, surface = s.keys.Text(text)
+	res = scanWithPhrases(s.det, s.index, scanned, s.tolerant)
+	s.matcher.resolve(&res, scanned)
+	if s.keys.Enabled() {
+		restoreRawTexts(&res.Result, surface)
+	}
+	w := s.warnings
+	if w == nil {
+		w = &scanWarnings{}
+	}
+	if s.report {
+		// Collected warnings only keep the count of the fallbacks.
+		var out io.Writer = os.Stderr
+		if s.warnings != nil {
+			out = io.Discard
+		}
+		w.Fallbacks += reportFallbacks(out, s.logPrefix(), res, surface)
+		w.Fragments += len(res.Fragments)
+	}
+	if s.alpha != nil {
+		unmappable := convertResult(s.alpha, &res.Result)
+		if s.strict && len(unmappable) > 0 {
+			return res, surface, scanned, &unmappableError{Alphabet: s.alpha.Name, Symbols: unmappable}
+		}
+		w.addUnmappable(unmappable)
+	}
+	if s.warnings == nil {
+		w.write(os.Stderr, s.logPrefix(), s.alpha)
+	}
+	return res, surface, scanned, nil
+}
+
+// scanWarnings counts the warnings of one or more scans.
+type scanWarnings struct {
+	Fallbacks  int            // diacritic-insensitive matches (--match tolerant-report)
+	Fragments  int            // fragments of the reported scans
+	Unmappable map[string]int // IPA symbol -> occurrences without a mapping in the alphabet
+}
+
+// addUnmappable counts the symbols of unmappable.
+func (w *scanWarnings) addUnmappable(unmappable map[string]int) {
+	if len(unmappable) == 0 {
+		return
+	}
+	if w.Unmappable == nil {
+		w.Unmappable = make(map[string]int)
+	}
+	for sym, n := range unmappable {
+		w.Unmappable[sym] += n
+	}
+}
+
+// write prints the warnings on out, on lines starting with prefix. The
+// fallback count is only printed when a scan reported fallbacks.
+func (w *scanWarnings) write(out io.Writer, prefix string, alpha *alphabet.Alphabet) {
+	if w.Fragments > 0 {
+		fmt.Fprintf(out, "%sdiacritic-insensitive matches: %d of %d fragments\n", prefix, w.Fallbacks, w.Fragments)
+	}
+	symbols := make([]string, 0, len(w.Unmappable))
+	for sym := range w.Unmappable {
+		symbols = append(symbols, sym)
+	}
+	sort.Strings(symbols)
+	for _, sym := range symbols {
+		fmt.Fprintf(out, "%swarning: %q (U+%04X) has no %s mapping (%d occurrences)\n", prefix, sym, []rune(sym)[0], alpha.Name, w.Unmappable[sym])
+	}
+}
+
+// worker returns a copy of the loaded session for a goroutine of a batch:
+// it shares the dictionaries and the matcher, which are only read once
+// built, but has a scanner of its own, since g2p.Determinist does not
+// document Scan as safe for concurrent use.
+func (s *session) worker() *session {
+	w := *s
+	w.det = g2p.NewDeterminist(s.mainDict, s.finalDict)
+	return &w
+}
+
+// logPrefix returns the prefix of the messages printed on standard error,
+// naming the file being processed, if any.
+func (s *session) logPrefix() string {
+	if s.source == "" {
+		return "phonetize: "
+	}
+	return "phonetize: " + s.source + ": "
+}
+
+// tokens phonetizes text and regroups the result into sentences and
+// tokens, attributing every fragment to the main or final dictionary. The
+// scan result is returned as well.
+func (s *session) tokens(text string) (tokenResult, scanResult, error) {
+	res, surface, _, err := s.scan(text)
+	if err != nil {
+		return tokenResult{}, res, err
+	}
+	return buildTokenResult(surface, res), res, nil
+}
+
+// render phonetizes text and formats the result in the given output mode
+// (json, txt, ssml or tokens). The scan result and the surface text its
+// positions refer to are returned as well.
+func (s *session) render(mode, text string) (string, scanResult, string, error) {
+	if mode == "tokens" {
+		tokens, res, err := s.tokens(text)
+		if err != nil {
+			return "", res, "", err
+		}
+		out, err := marshalJSON(tokens)
+		if err != nil {
+			return "", res, tokens.Text, fmt.Errorf("failed to encode tokens as JSON: %w", err)
+		}
+		return out, res, tokens.Text, nil
+	}
+
+	res, surface, _, err := s.scan(text)
+	if err != nil {
+		return "", res, surface, err
+	}
+	switch mode {
+	case "json":
+		out, err := marshalJSON(newJSONResult(res))
+		if err != nil {
+			return "", res, surface, fmt.Errorf("failed to encode result as JSON: %w", err)
+		}
+		return out, res, surface, nil
+	case "txt":
+		return composeText(res.Result) + "\n", res, surface, nil
+	case "ssml":
+		return composeSSML(res, surface, s.lang, s.alphabetName()) + "\n", res, surface, nil
+	}
+	// Should never happen thanks to earlier validation.
+	return "", res, surface, fmt.Errorf("unsupported output mode %q", mode)
+}
+
+// alphabetName returns the name of the session alphabet, or "" for IPA.
+func (s *session) alphabetName() string {
+	if s.alpha == nil {
+		return ""
+	}
+	return s.alpha.Name
+}
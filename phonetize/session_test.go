@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/g2p"
+	"github.com/temporal-IPA/tipa/pkg/phono"
+
+	"ipadict/alphabet"
+)
+
+// testSession returns a loaded session on main and final, with the
+// default lookup flags.
+func testSession(main, final phono.Dictionary) *session {
+	return &session{
+		lang:      "fr",
+		phrases:   true,
+		tolerant:  true,
+		mainDict:  main,
+		finalDict: final,
+		det:       g2p.NewDeterminist(main, final),
+		index:     buildPhraseIndex(main, final),
+		matcher:   newMatcher(main, final),
+	}
+}
+
+func TestScanStrictAlphabet(t *testing.T) {
+	a, err := alphabet.Lookup("x-sampa", "fr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := testSession(phono.Dictionary{"chat": {"ʃa"}, "rouge": {"ʁuʒ☃"}}, nil)
+	s.alpha = a
+
+	// Unmappable symbols are kept by default.
+	out, _, _, err := s.render("txt", "chat rouge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Sa RuZ☃\n"; out != want {
+		t.Errorf("txt = %q, want %q", out, want)
+	}
+
+	s.strict = true
+	if _, _, _, err := s.render("txt", "chat"); err != nil {
+		t.Errorf("strict render of mappable text: %v", err)
+	}
+	_, _, _, err = s.renderDocument(formatSRT, "txt", "1\n00:00:01,000 --> 00:00:02,000\nchat rouge\n")
+	var unmappable *unmappableError
+	if !errors.As(err, &unmappable) || unmappable.Symbols["☃"] != 1 {
+		t.Fatalf("strict render = %v, want an unmappable error for ☃", err)
+	}
+	if !strings.Contains(err.Error(), "U+2603") {
+		t.Errorf("error %q does not name the symbol", err)
+	}
+}
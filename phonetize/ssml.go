@@ -0,0 +1,51 @@
+package main
+
+// SSML output (--output ssml).
+//
+// Every Fragment becomes a <phoneme alphabet="ipa" ph="..."> element around
+// its surface text, and every RawText is kept as (escaped) text, so TTS
+// engines read unknown words and punctuation as usual.
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// composeSSML renders res, computed on text, as an SSML <speak> document
+// in language lang. alpha is the alphabet of the fragments ("" for IPA).
+func composeSSML(res scanResult, text, lang, alpha string) string {
+	phAlphabet := "ipa"
+	if alpha != "" {
+		phAlphabet = alpha
+		if !strings.HasPrefix(alpha, "x-") {
+			phAlphabet = "x-" + alpha
+		}
+	}
+
+	runes := []rune(text)
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<speak version="1.1" xmlns="http://www.w3.org/2001/10/synthesis" xml:lang="`)
+	xml.EscapeText(&b, []byte(lang))
+	b.WriteString(`">`)
+
+	prev := 0
+	for _, f := range fragmentSpans(res) {
+		if f.RuneStart > prev {
+			xml.EscapeText(&b, []byte(string(runes[prev:f.RuneStart])))
+		}
+		b.WriteString(`<phoneme alphabet="` + phAlphabet + `" ph="`)
+		xml.EscapeText(&b, []byte(f.IPA))
+		b.WriteString(`">`)
+		xml.EscapeText(&b, []byte(string(runes[f.RuneStart:f.RuneEnd])))
+		b.WriteString(`</phoneme>`)
+		prev = f.RuneEnd
+	}
+	if prev < len(runes) {
+		xml.EscapeText(&b, []byte(string(runes[prev:])))
+	}
+
+	b.WriteString("</speak>")
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/g2p"
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+// ssmlSpeak is the part of an SSML document checked by the tests.
+type ssmlSpeak struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2001/10/synthesis speak"`
+	Lang    string   `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Text    string   `xml:",chardata"`
+	Phoneme []struct {
+		Alphabet string `xml:"alphabet,attr"`
+		Ph       string `xml:"ph,attr"`
+		Text     string `xml:",chardata"`
+	} `xml:"phoneme"`
+}
+
+// resolvedScan scans text with dict and resolves the result.
+func resolvedScan(dict phono.Dictionary, text string) scanResult {
+	res := scanWithPhrases(g2p.NewDeterminist(dict, nil), nil, text, false)
+	newMatcher(dict, nil).resolve(&res, text)
+	return res
+}
+
+func TestComposeSSMLEscaping(t *testing.T) {
+	dict := phono.Dictionary{"chat": {`ʃa"<&`}, "l'eau": {"lo"}}
+	text := `Tom & Jerry: "chat" <3 l'eau`
+	doc := composeSSML(resolvedScan(dict, text), text, `fr"FR`, "")
+
+	for _, raw := range []string{" & ", "<3", `"chat"`, `ʃa"<&`} {
+		if strings.Contains(doc, raw) {
+			t.Errorf("%q written unescaped in %s", raw, doc)
+		}
+	}
+	var speak ssmlSpeak
+	if err := xml.Unmarshal([]byte(doc), &speak); err != nil {
+		t.Fatalf("invalid SSML document: %v\n%s", err, doc)
+	}
+	if speak.Lang != `fr"FR` {
+		t.Errorf("xml:lang = %q", speak.Lang)
+	}
+	if want := `Tom & Jerry: "" <3 `; speak.Text != want {
+		t.Errorf("text = %q, want %q", speak.Text, want)
+	}
+	var got [][3]string
+	for _, p := range speak.Phoneme {
+		got = append(got, [3]string{p.Alphabet, p.Ph, p.Text})
+	}
+	want := [][3]string{{"ipa", `ʃa"<&`, "chat"}, {"ipa", "lo", "l'eau"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("phonemes = %q, want %q", got, want)
+	}
+}
+
+func TestComposeSSMLAlphabet(t *testing.T) {
+	dict := phono.Dictionary{"chat": {"Sa"}}
+	for alpha, want := range map[string]string{"": "ipa", "sampa": "x-sampa", "x-sampa": "x-sampa"} {
+		doc := composeSSML(resolvedScan(dict, "chat"), "chat", "fr", alpha)
+		if !strings.Contains(doc, `<phoneme alphabet="`+want+`" ph="Sa">chat</phoneme>`) {
+			t.Errorf("alphabet %q: %s", alpha, doc)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+// Subtitle and transcript documents (--input-format).
+//
+// SRT, WebVTT and Praat TextGrid inputs are not scanned as a whole: only
+// their text portions are phonetized, with the txt composition (IPA with
+// the unknown words kept verbatim), and the document is written back in
+// the same format with its timing untouched:
+//
+//   - SRT / WebVTT: the text lines of every cue are replaced by their IPA.
+//     Cue numbers, identifiers, timing lines, WebVTT headers, NOTE, STYLE
+//     and REGION blocks are kept as is, and so is inline markup (<i>,
+//     <v Speaker>, <00:01.000>, {\an8}).
+//   - TextGrid: an IPA tier named "<tier>-ipa" is added after every tier,
+//     with the same intervals or points (see textgrid.go).
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"strings"
+)
+
+// Input formats.
+const (
+	formatAuto     = "auto"
+	formatText     = "text"
+	formatSRT      = "srt"
+	formatVTT      = "vtt"
+	formatTextGrid = "textgrid"
+	formatHTML     = "html"
+	formatMarkdown = "markdown"
+)
+
+// validateInputFormat checks an --input-format value.
+func validateInputFormat(format string) error {
+	switch format {
+	case formatAuto, formatText, formatSRT, formatVTT, formatTextGrid, formatHTML, formatMarkdown:
+		return nil
+	}
+	return fmt.Errorf("invalid --input-format value %q (expected \"auto\", \"text\", \"srt\", \"vtt\", \"textgrid\", \"html\" or \"markdown\")", format)
+}
+
+// detectFormat resolves the "auto" input format from the extension of
+// path; anything but .srt, .vtt, .TextGrid, .html / .htm and .md /
+// .markdown is plain text.
+func detectFormat(format, path string) string {
+	if format != formatAuto {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".srt":
+		return formatSRT
+	case ".vtt":
+		return formatVTT
+	case ".textgrid":
+		return formatTextGrid
+	case ".html", ".htm", ".xhtml":
+		return formatHTML
+	case ".md", ".markdown":
+		return formatMarkdown
+	}
+	return formatText
+}
+
+// isDocumentFormat reports whether format is written back in its own
+// format rather than in the --output format.
+func isDocumentFormat(format string) bool {
+	switch format {
+	case formatSRT, formatVTT, formatTextGrid, formatHTML, formatMarkdown:
+		return true
+	}
+	return false
+}
+
+// docPart is a piece of a document: text to phonetize, or markup and
+// structure to copy verbatim.
+type docPart struct {
+	Text      string
+	Phonetize bool
+}
+
+// cueParts splits an SRT or WebVTT document into parts. The lines that
+// follow a timing line ("00:00:01,000 --> 00:00:02,500"), up to the next
+// blank line, are cue text; everything else is copied verbatim.
+func cueParts(doc string) []docPart {
+	var parts []docPart
+	inCue := false
+	for _, line := range strings.SplitAfter(doc, "\n") {
+		content := strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.TrimSpace(content) == "":
+			inCue = false
+		case strings.Contains(content, "-->"):
+			inCue = true
+		case inCue:
+			parts = append(parts, splitMarkup(content)...)
+			parts = append(parts, docPart{Text: line[len(content):]})
+			continue
+		}
+		parts = append(parts, docPart{Text: line})
+	}
+	return parts
+}
+
+// splitMarkup splits a cue text line into text and inline markup: HTML-like
+// tags (<i>, </i>, <v Roger>, <00:00:01.000>) and SSA override blocks
+// ({\an8}).
+func splitMarkup(line string) []docPart {
+	var parts []docPart
+	for line != "" {
+		i := strings.IndexAny(line, "<{")
+		if i < 0 {
+			parts = append(parts, docPart{Text: line, Phonetize: true})
+			break
+		}
+		closing := ">"
+		if line[i] == '{' {
+			closing = "}"
+		}
+		j := strings.Index(line[i:], closing)
+		if j < 0 {
+			parts = append(parts, docPart{Text: line, Phonetize: true})
+			break
+		}
+		if i > 0 {
+			parts = append(parts, docPart{Text: line[:i], Phonetize: true})
+		}
+		parts = append(parts, docPart{Text: line[i : i+j+1]})
+		line = line[i+j+1:]
+	}
+	return parts
+}
+
+// phonetizeText returns the txt composition of text, and its word
+// coverage.
+func (s *session) phonetizeText(text string) (string, int, int, error) {
+	if strings.TrimSpace(text) == "" {
+		return text, 0, 0, nil
+	}
+	res, surface, _, err := s.scan(text)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	words, covered := wordCoverage(res, surface)
+	return composeText(res.Result), words, covered, nil
+}
+
+// renderParts concatenates parts, passing the text ones through
+// phonetize, and returns the document with its word coverage. It stops at
+// the first error of phonetize.
+func renderParts(parts []docPart, phonetize func(string) (string, int, int, error)) (string, int, int, error) {
+	var b strings.Builder
+	var words, covered int
+	for _, p := range parts {
+		if !p.Phonetize {
+			b.WriteString(p.Text)
+			continue
+		}
+		text, w, c, err := phonetize(p.Text)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		b.WriteString(text)
+		words += w
+		covered += c
+	}
+	return b.String(), words, covered, nil
+}
+
+// renderDocument phonetizes an input in the given format. Plain text is
+// rendered in the output mode; subtitles, TextGrids, HTML and Markdown are
+// written back in their own format. It returns the output and the word coverage.
+func (s *session) renderDocument(format, mode, text string) (string, int, int, error) {
+	switch format {
+	case formatSRT, formatVTT:
+		return renderParts(cueParts(text), s.phonetizeText)
+	case formatTextGrid:
+		return s.renderTextGrid(text)
+	case formatHTML:
+		return s.renderHTML(text)
+	case formatMarkdown:
+		return s.renderMarkdown(text)
+	}
+	out, res, surface, err := s.render(mode, text)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	words, covered := wordCoverage(res, surface)
+	return out, words, covered, nil
+}
+
+// documentTexts returns the portions of an input in the given format that
+// are phonetized: the cue lines of subtitles, the intervals of TextGrids,
+// the visible text of HTML and Markdown, or the whole of plain text.
+func documentTexts(format, doc string) ([]string, error) {
+	var parts []docPart
+	switch format {
+	case formatSRT, formatVTT:
+		parts = cueParts(doc)
+	case formatMarkdown:
+		parts = markdownParts(doc)
+	case formatHTML:
+		var err error
+		if parts, err = htmlParts(doc); err != nil {
+			return nil, err
+		}
+	case formatTextGrid:
+		tg, err := parseTextGrid(doc)
+		if err != nil {
+			return nil, err
+		}
+		var texts []string
+		for _, tier := range tg.Tiers {
+			for _, it := range tier.Items {
+				texts = append(texts, it.Text)
+			}
+		}
+		return texts, nil
+	default:
+		return []string{doc}, nil
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Phonetize {
+			if format == formatHTML {
+				p.Text = html.UnescapeString(p.Text)
+			}
+			texts = append(texts, p.Text)
+		}
+	}
+	return texts, nil
+}
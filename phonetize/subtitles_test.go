@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+// phonetizedTexts returns the parts to phonetize, and checks that the
+// parts put together give doc back.
+func phonetizedTexts(t *testing.T, doc string, parts []docPart) []string {
+	t.Helper()
+	var b strings.Builder
+	var texts []string
+	for _, p := range parts {
+		b.WriteString(p.Text)
+		if p.Phonetize {
+			texts = append(texts, p.Text)
+		}
+	}
+	if b.String() != doc {
+		t.Errorf("parts give %q, want %q", b.String(), doc)
+	}
+	return texts
+}
+
+func TestCuePartsVTT(t *testing.T) {
+	doc := readFixture(t, "cues.vtt")
+	got := phonetizedTexts(t, doc, cueParts(doc))
+	// Headers, STYLE and NOTE blocks, identifiers and inline tags are kept.
+	want := []string{"le chat", " et le ", "chien", "chat", "chien"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cue texts = %q, want %q", got, want)
+	}
+}
+
+func TestCuePartsSRT(t *testing.T) {
+	doc := readFixture(t, "cues.srt")
+	got := phonetizedTexts(t, doc, cueParts(doc))
+	want := []string{"le chat", "et le chien", "chat"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cue texts = %q, want %q", got, want)
+	}
+}
+
+func TestRenderCues(t *testing.T) {
+	s := testSession(phono.Dictionary{"le": {"lə"}, "chat": {"ʃa"}, "et": {"e"}, "chien": {"ʃjɛ̃"}}, nil)
+	tests := []struct {
+		fixture, format, want string
+	}{
+		{"cues.srt", formatSRT, "1\r\n00:00:01,000 --> 00:00:02,500\r\n<i>lə ʃa</i>\r\ne lə ʃjɛ̃\r\n\r\n2\r\n00:00:02,500 --> 00:00:04,000\r\nʃa\r\n"},
+		{"cues.vtt", formatVTT, strings.NewReplacer(
+			"<v Léa>le chat</v> et le <i>chien</i>", "<v Léa>lə ʃa</v> e lə <i>ʃjɛ̃</i>",
+			"{\\an8}chat\n", "{\\an8}ʃa\n",
+			"<00:00:03.000>chien", "<00:00:03.000>ʃjɛ̃",
+		).Replace(readFixture(t, "cues.vtt"))},
+	}
+	for _, tt := range tests {
+		out, words, covered, err := s.renderDocument(tt.format, "txt", readFixture(t, tt.fixture))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.fixture, err)
+		}
+		if out != tt.want {
+			t.Errorf("%s rendered as\n%q\nwant\n%q", tt.fixture, out, tt.want)
+		}
+		if words == 0 || covered != words {
+			t.Errorf("%s: %d of %d words covered", tt.fixture, covered, words)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+// Praat TextGrid documents.
+//
+// Both the long ("xmin = 0") and the short text formats are read, in UTF-8
+// or UTF-16 (Praat's default for non-ASCII text). A TextGrid file is a
+// sequence of values, strings in double quotes ("" escapes a quote) and
+// numbers, interleaved with labels in the long format; the reader keeps
+// the values only. Times are kept as written, so the output has exactly
+// the timing of the input. The output is always in the long format, UTF-8.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// textGrid is a parsed TextGrid.
+type textGrid struct {
+	XMin, XMax string
+	Tiers      []tgTier
+}
+
+// tgTier is an interval tier or a point (text) tier.
+type tgTier struct {
+	Class      string // "IntervalTier" or "TextTier"
+	Name       string
+	XMin, XMax string
+	Items      []tgItem
+}
+
+// tgItem is an interval (XMin, XMax, Text) or a point (XMin, Text).
+type tgItem struct {
+	XMin, XMax string
+	Text       string
+}
+
+// decodeTextFile returns the content of a text file as UTF-8, decoding
+// UTF-16 when the file starts with a byte order mark.
+func decodeTextFile(data []byte) string {
+	var order binary.ByteOrder
+	switch {
+	case len(data) >= 2 && data[0] == 0xFE && data[1] == 0xFF:
+		order = binary.BigEndian
+	case len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE:
+		order = binary.LittleEndian
+	default:
+		return strings.TrimPrefix(string(data), "\ufeff")
+	}
+	units := make([]uint16, 0, len(data)/2)
+	for i := 2; i+1 < len(data); i += 2 {
+		units = append(units, order.Uint16(data[i:]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// tgValues returns the values of a TextGrid file: quoted strings
+// (unquoted) and bare words such as numbers and <exists>. Labels of the
+// long format ("xmin =", "item [1]:", "intervals: size =") are skipped.
+func tgValues(doc string) ([]string, error) {
+	var values []string
+	for i := 0; i < len(doc); {
+		r, size := utf8.DecodeRuneInString(doc[i:])
+		switch {
+		case r == '"':
+			var b strings.Builder
+			j := i + 1
+			for {
+				k := strings.IndexByte(doc[j:], '"')
+				if k < 0 {
+					return nil, errors.New("unterminated string")
+				}
+				b.WriteString(doc[j : j+k])
+				j += k + 1
+				if j < len(doc) && doc[j] == '"' {
+					b.WriteByte('"')
+					j++
+					continue
+				}
+				break
+			}
+			values = append(values, b.String())
+			i = j
+		case r == '[':
+			k := strings.IndexByte(doc[i:], ']')
+			if k < 0 {
+				return nil, errors.New("unterminated index")
+			}
+			i += k + 1
+		case r == '!':
+			// Comment up to the end of the line.
+			k := strings.IndexByte(doc[i:], '\n')
+			if k < 0 {
+				k = len(doc) - i
+			}
+			i += k
+		case unicode.IsSpace(r) || r == '=' || r == ':':
+			i += size
+		default:
+			j := i
+			for j < len(doc) && !strings.ContainsRune(" \t\r\n=:[\"", rune(doc[j])) {
+				j++
+			}
+			word := doc[i:j]
+			if isTGValue(word) {
+				values = append(values, word)
+			}
+			i = j
+		}
+	}
+	return values, nil
+}
+
+// isTGValue reports whether a bare word is a value (a number or a flag
+// such as <exists>) rather than a label.
+func isTGValue(word string) bool {
+	if strings.HasPrefix(word, "<") {
+		return true
+	}
+	_, err := strconv.ParseFloat(word, 64)
+	return err == nil
+}
+
+// parseTextGrid reads a TextGrid in the long or short text format.
+func parseTextGrid(doc string) (*textGrid, error) {
+	values, err := tgValues(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TextGrid: %w", err)
+	}
+	pos := 0
+	next := func() (string, error) {
+		if pos >= len(values) {
+			return "", errors.New("invalid TextGrid: unexpected end of file")
+		}
+		pos++
+		return values[pos-1], nil
+	}
+	nextInt := func() (int, error) {
+		v, err := next()
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid TextGrid: expected a count, got %q", v)
+		}
+		return n, nil
+	}
+	nextN := func(n int) ([]string, error) {
+		out := make([]string, n)
+		for i := range out {
+			v, err := next()
+			if err != nil {
+				return nil, err
+			}
+			out[i] = v
+		}
+		return out, nil
+	}
+
+	head, err := nextN(2)
+	if err != nil {
+		return nil, err
+	}
+	if head[0] != "ooTextFile" || head[1] != "TextGrid" {
+		return nil, errors.New("invalid TextGrid: missing ooTextFile / TextGrid header")
+	}
+	tg := &textGrid{}
+	bounds, err := nextN(2)
+	if err != nil {
+		return nil, err
+	}
+	tg.XMin, tg.XMax = bounds[0], bounds[1]
+	flag, err := next()
+	if err != nil {
+		return nil, err
+	}
+	if flag != "<exists>" {
+		return tg, nil
+	}
+	ntiers, err := nextInt()
+	if err != nil {
+		return nil, err
+	}
+	for t := 0; t < ntiers; t++ {
+		head, err := nextN(4)
+		if err != nil {
+			return nil, err
+		}
+		tier := tgTier{Class: head[0], Name: head[1], XMin: head[2], XMax: head[3]}
+		if tier.Class != "IntervalTier" && tier.Class != "TextTier" {
+			return nil, fmt.Errorf("invalid TextGrid: unknown tier class %q", tier.Class)
+		}
+		n, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			var item tgItem
+			switch tier.Class {
+			case "IntervalTier":
+				v, err := nextN(3)
+				if err != nil {
+					return nil, err
+				}
+				item = tgItem{XMin: v[0], XMax: v[1], Text: v[2]}
+			case "TextTier":
+				v, err := nextN(2)
+				if err != nil {
+					return nil, err
+				}
+				item = tgItem{XMin: v[0], Text: v[1]}
+			}
+			tier.Items = append(tier.Items, item)
+		}
+		tg.Tiers = append(tg.Tiers, tier)
+	}
+	return tg, nil
+}
+
+// tgQuote quotes a TextGrid string.
+func tgQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// String writes the TextGrid in the long text format.
+func (tg *textGrid) String() string {
+	var b strings.Builder
+	b.WriteString("File type = \"ooTextFile\"\nObject class = \"TextGrid\"\n\n")
+	fmt.Fprintf(&b, "xmin = %s \nxmax = %s \n", tg.XMin, tg.XMax)
+	if len(tg.Tiers) == 0 {
+		b.WriteString("tiers? <absent> \n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "tiers? <exists> \nsize = %d \nitem []: \n", len(tg.Tiers))
+	for i, tier := range tg.Tiers {
+		fmt.Fprintf(&b, "    item [%d]:\n", i+1)
+		fmt.Fprintf(&b, "        class = %s \n        name = %s \n", tgQuote(tier.Class), tgQuote(tier.Name))
+		fmt.Fprintf(&b, "        xmin = %s \n        xmax = %s \n", tier.XMin, tier.XMax)
+		if tier.Class == "TextTier" {
+			fmt.Fprintf(&b, "        points: size = %d \n", len(tier.Items))
+			for j, it := range tier.Items {
+				fmt.Fprintf(&b, "        points [%d]:\n", j+1)
+				fmt.Fprintf(&b, "            number = %s \n            mark = %s \n", it.XMin, tgQuote(it.Text))
+			}
+			continue
+		}
+		fmt.Fprintf(&b, "        intervals: size = %d \n", len(tier.Items))
+		for j, it := range tier.Items {
+			fmt.Fprintf(&b, "        intervals [%d]:\n", j+1)
+			fmt.Fprintf(&b, "            xmin = %s \n            xmax = %s \n            text = %s \n", it.XMin, it.XMax, tgQuote(it.Text))
+		}
+	}
+	return b.String()
+}
+
+// renderTextGrid adds an IPA tier after every tier of a TextGrid and
+// returns the document with its word coverage.
+func (s *session) renderTextGrid(doc string) (string, int, int, error) {
+	tg, err := parseTextGrid(doc)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	var words, covered int
+	tiers := make([]tgTier, 0, 2*len(tg.Tiers))
+	for _, tier := range tg.Tiers {
+		ipa := tier
+		ipa.Name = tier.Name + "-ipa"
+		ipa.Items = make([]tgItem, len(tier.Items))
+		for i, it := range tier.Items {
+			text, w, c, err := s.phonetizeText(it.Text)
+			if err != nil {
+				return "", 0, 0, err
+			}
+			it.Text = text
+			ipa.Items[i] = it
+			words += w
+			covered += c
+		}
+		tiers = append(tiers, tier, ipa)
+	}
+	tg.Tiers = tiers
+	return tg.String(), words, covered, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/temporal-IPA/tipa/pkg/phono"
+)
+
+// readFixture returns the content of a file of testdata.
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// fixtureGrid is the TextGrid of testdata/long.TextGrid and
+// testdata/short.TextGrid.
+var fixtureGrid = &textGrid{
+	XMin: "0", XMax: "2.7153125",
+	Tiers: []tgTier{
+		{Class: "IntervalTier", Name: "words", XMin: "0", XMax: "2.7153125", Items: []tgItem{
+			{XMin: "0", XMax: "0.41000000000000003", Text: ""},
+			{XMin: "0.41000000000000003", XMax: "1.5", Text: `le "chat" sourit`},
+			{XMin: "1.5", XMax: "2.7153125", Text: "garçon"},
+		}},
+		{Class: "TextTier", Name: "events", XMin: "0", XMax: "2.7153125", Items: []tgItem{
+			{XMin: "1.25", Text: "chat"},
+		}},
+	},
+}
+
+func TestParseTextGrid(t *testing.T) {
+	for _, name := range []string{"long.TextGrid", "short.TextGrid"} {
+		tg, err := parseTextGrid(readFixture(t, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(tg, fixtureGrid) {
+			t.Errorf("%s: parsed %+v, want %+v", name, tg, fixtureGrid)
+		}
+	}
+}
+
+func TestParseTextGridErrors(t *testing.T) {
+	for _, doc := range []string{
+		"",
+		`File type = "ooTextFile"` + "\n" + `Object class = "Table"` + "\n",
+		`"ooTextFile" "TextGrid" 0 1 <exists> 1 "IntervalTier" "words" 0 1 1 0 1 "unterminated`,
+		`"ooTextFile" "TextGrid" 0 1 <exists> 1 "PointTier" "words" 0 1 0`,
+		`"ooTextFile" "TextGrid" 0 1 <exists> 2 "IntervalTier" "words" 0 1 0`,
+	} {
+		if _, err := parseTextGrid(doc); err == nil {
+			t.Errorf("parseTextGrid(%q) succeeded", doc)
+		}
+	}
+}
+
+func TestTextGridRoundTrip(t *testing.T) {
+	long := readFixture(t, "long.TextGrid")
+	for _, name := range []string{"long.TextGrid", "short.TextGrid"} {
+		tg, err := parseTextGrid(readFixture(t, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tg.String(); got != long {
+			t.Errorf("%s written back as\n%s\nwant\n%s", name, got, long)
+		}
+	}
+}
+
+// encodeUTF16 returns s in UTF-16 with a byte order mark.
+func encodeUTF16(s string, order binary.ByteOrder) []byte {
+	units := utf16.Encode([]rune("\ufeff" + s))
+	data := make([]byte, 2*len(units))
+	for i, u := range units {
+		order.PutUint16(data[2*i:], u)
+	}
+	return data
+}
+
+func TestDecodeTextFile(t *testing.T) {
+	short := readFixture(t, "short.TextGrid")
+	inputs := map[string][]byte{
+		"UTF-8":     []byte(short),
+		"UTF-8 BOM": []byte("\ufeff" + short),
+		"UTF-16LE":  encodeUTF16(short, binary.LittleEndian),
+		"UTF-16BE":  encodeUTF16(short, binary.BigEndian),
+	}
+	for name, data := range inputs {
+		doc := decodeTextFile(data)
+		if doc != short {
+			t.Errorf("%s: decoded %q", name, doc[:min(len(doc), 40)])
+			continue
+		}
+		if tg, err := parseTextGrid(doc); err != nil || !reflect.DeepEqual(tg, fixtureGrid) {
+			t.Errorf("%s: parsed %+v, %v", name, tg, err)
+		}
+	}
+}
+
+func TestRenderTextGrid(t *testing.T) {
+	s := testSession(phono.Dictionary{"le": {"lə"}, "chat": {"ʃa"}, "sourit": {"suʁi"}, "garçon": {"ɡaʁsɔ̃"}}, nil)
+	long := readFixture(t, "long.TextGrid")
+	out, words, covered, err := s.renderTextGrid(decodeTextFile(encodeUTF16(long, binary.LittleEndian)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if words != 5 || covered != 5 {
+		t.Errorf("coverage %d of %d words, want 5 of 5", covered, words)
+	}
+
+	// The input tiers are written back byte for byte, timing included.
+	words1 := long[strings.Index(long, "        class = \"IntervalTier\""):strings.Index(long, "    item [2]:")]
+	if !strings.Contains(out, words1) {
+		t.Errorf("words tier not kept as is:\n%s", out)
+	}
+
+	tg, err := parseTextGrid(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tier := range tg.Tiers {
+		names = append(names, tier.Name)
+	}
+	if want := []string{"words", "words-ipa", "events", "events-ipa"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("tiers = %q, want %q", names, want)
+	}
+	ipa := tg.Tiers[1]
+	for i, it := range fixtureGrid.Tiers[0].Items {
+		if ipa.Items[i].XMin != it.XMin || ipa.Items[i].XMax != it.XMax {
+			t.Errorf("interval %d of the IPA tier: %s-%s, want %s-%s", i+1, ipa.Items[i].XMin, ipa.Items[i].XMax, it.XMin, it.XMax)
+		}
+	}
+	var texts []string
+	for _, it := range ipa.Items {
+		texts = append(texts, it.Text)
+	}
+	if want := []string{"", `lə "ʃa" suʁi`, "ɡaʁsɔ̃"}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("IPA texts = %q, want %q", texts, want)
+	}
+	if pt := tg.Tiers[3].Items[0]; pt.XMin != "1.25" || pt.Text != "ʃa" {
+		t.Errorf("IPA point = %+v", pt)
+	}
+}
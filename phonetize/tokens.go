@@ -0,0 +1,207 @@
+package main
+
+// Token-level output (--output tokens).
+//
+// The g2p.Result only carries rune offsets of fragments and raw texts.
+// This output regroups the input into sentences and tokens (words,
+// punctuation, white space), each with rune and UTF-8 byte offsets, and
+// links every token to the fragments that cover it. Each fragment also
+// records which dictionary produced it, "main" or "final", and the key it
+// was matched with (see match.go).
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token kinds.
+const (
+	tokenWord        = "word"
+	tokenPunctuation = "punctuation"
+	tokenWhitespace  = "whitespace"
+)
+
+// dictionaryNames are the names of the dictionaries of a session, in
+// lookup order.
+var dictionaryNames = []string{"main", "final"}
+
+// span holds rune and byte offsets of a piece of the input; ends are
+// exclusive.
+type span struct {
+	RuneStart int `json:"rune_start"`
+	RuneEnd   int `json:"rune_end"`
+	ByteStart int `json:"byte_start"`
+	ByteEnd   int `json:"byte_end"`
+}
+
+// tokenFragment is a fragment of the result with its full span.
+type tokenFragment struct {
+	span
+	Text       string `json:"text"`
+	IPA        string `json:"ipa"`
+	Dictionary string `json:"dictionary"` // "main" or "final", "" when the match is unknown
+	matchInfo
+}
+
+// token is a word, punctuation or white space run of the input.
+type token struct {
+	span
+	Kind      string `json:"kind"`
+	Text      string `json:"text"`
+	IPA       string `json:"ipa,omitempty"`       // IPA of the fragments starting in the token
+	Fragments []int  `json:"fragments,omitempty"` // indices of the overlapping fragments
+}
+
+// sentence is a run of tokens ending with terminal punctuation (and the
+// white space that follows it) or at the end of the input.
+type sentence struct {
+	span
+	Text   string  `json:"text"`
+	Tokens []token `json:"tokens"`
+}
+
+// tokenResult is the document printed by --output tokens.
+type tokenResult struct {
+	Text      string          `json:"text"`
+	Fragments []tokenFragment `json:"fragments"`
+	Sentences []sentence      `json:"sentences"`
+}
+
+// offsets converts rune offsets of a text to byte offsets.
+type offsets []int
+
+// newOffsets returns the byte offset of every rune of text, plus the
+// length of text.
+func newOffsets(text string) offsets {
+	o := make(offsets, 0, utf8.RuneCountInString(text)+1)
+	for i := range text {
+		o = append(o, i)
+	}
+	return append(o, len(text))
+}
+
+// span returns the span of runes [start, end).
+func (o offsets) span(start, end int) span {
+	return span{RuneStart: start, RuneEnd: end, ByteStart: o[start], ByteEnd: o[end]}
+}
+
+// fragmentSpans returns the fragments of res, which must be resolved, with
+// their text span and match, sorted by position.
+func fragmentSpans(res scanResult) []tokenFragment {
+	frags := make([]tokenFragment, 0, len(res.Fragments))
+	for i, f := range res.Fragments {
+		m := res.Matches[i]
+		tf := tokenFragment{
+			span:      span{RuneStart: f.Pos, RuneEnd: m.End},
+			IPA:       string(f.Phonetized),
+			matchInfo: m.matchInfo,
+		}
+		if m.Dict >= 0 {
+			tf.Dictionary = dictionaryNames[m.Dict]
+		}
+		frags = append(frags, tf)
+	}
+	sort.SliceStable(frags, func(i, j int) bool { return frags[i].RuneStart < frags[j].RuneStart })
+	return frags
+}
+
+// buildTokenResult regroups res, resolved on text, into sentences and
+// tokens. A fragment is listed by every token it overlaps, but its IPA goes
+// to the token it starts in only: the IPA of a phrase ("pomme de terre") is
+// carried by its first word, the tokens after it have none of their own.
+func buildTokenResult(text string, res scanResult) tokenResult {
+	runes := []rune(text)
+	off := newOffsets(text)
+
+	frags := fragmentSpans(res)
+	for i := range frags {
+		f := &frags[i]
+		f.span = off.span(f.RuneStart, f.RuneEnd)
+		f.Text = string(runes[f.RuneStart:f.RuneEnd])
+	}
+
+	out := tokenResult{Text: text, Fragments: frags}
+	var cur *sentence
+	// Fragments are sorted and do not overlap: next is the first one that
+	// may still reach the current token or a later one.
+	next := 0
+	for _, tok := range splitTokens(runes) {
+		tok.span = off.span(tok.RuneStart, tok.RuneEnd)
+		for next < len(frags) && frags[next].RuneEnd <= tok.RuneStart {
+			next++
+		}
+		var ipa strings.Builder
+		for i := next; i < len(frags) && frags[i].RuneStart < tok.RuneEnd; i++ {
+			f := frags[i]
+			if f.RuneEnd <= tok.RuneStart {
+				continue
+			}
+			tok.Fragments = append(tok.Fragments, i)
+			if f.RuneStart >= tok.RuneStart {
+				ipa.WriteString(f.IPA)
+			}
+		}
+		tok.IPA = ipa.String()
+
+		if cur == nil {
+			out.Sentences = append(out.Sentences, sentence{span: tok.span})
+			cur = &out.Sentences[len(out.Sentences)-1]
+		}
+		// White space after terminal punctuation still belongs to the
+		// sentence; the next non-space token starts a new one.
+		if tok.Kind != tokenWhitespace && endsSentence(cur.Tokens) {
+			out.Sentences = append(out.Sentences, sentence{span: tok.span})
+			cur = &out.Sentences[len(out.Sentences)-1]
+		}
+		cur.Tokens = append(cur.Tokens, tok)
+		cur.span = off.span(cur.RuneStart, tok.RuneEnd)
+	}
+	for i := range out.Sentences {
+		s := &out.Sentences[i]
+		s.Text = string(runes[s.RuneStart:s.RuneEnd])
+	}
+	return out
+}
+
+// endsSentence reports whether the sentence made of tokens is complete:
+// its last non-space token is terminal punctuation.
+func endsSentence(tokens []token) bool {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if tokens[i].Kind == tokenWhitespace {
+			continue
+		}
+		return tokens[i].Kind == tokenPunctuation && strings.ContainsAny(tokens[i].Text, ".!?…")
+	}
+	return false
+}
+
+// splitTokens splits runes into word, white space and punctuation tokens.
+// Consecutive punctuation marks form a single token ("...", "?!").
+func splitTokens(runes []rune) []token {
+	kindOf := func(r rune) string {
+		switch {
+		case isWordRune(r):
+			return tokenWord
+		case unicode.IsSpace(r):
+			return tokenWhitespace
+		}
+		return tokenPunctuation
+	}
+	var tokens []token
+	for i := 0; i < len(runes); {
+		kind := kindOf(runes[i])
+		j := i + 1
+		for j < len(runes) && kindOf(runes[j]) == kind {
+			j++
+		}
+		tokens = append(tokens, token{
+			span: span{RuneStart: i, RuneEnd: j},
+			Kind: kind,
+			Text: string(runes[i:j]),
+		})
+		i = j
+	}
+	return tokens
+}